@@ -0,0 +1,94 @@
+package dashboards
+
+import (
+	"assignment2/util"
+	"context"
+	"fmt"
+	"time"
+)
+
+// BuildComparison populates the dashboard of a comparison registration. Every country in the registration is
+// populated with the same features, and the countries are compared to each other.
+//
+// Parameters:
+// - ctx: cancels the requests to the upstream services. Handlers should pass the request's context.
+// - reg: the registration to populate the dashboard for. The registration must have at least one ISO code in IsoCodes.
+// - lang: the language of the countries' names, the capitals and the currency names. See util.NegotiateLanguage.
+//
+// Returns:
+// - The populated comparison dashboard is returned.
+// - An error is returned if one of the upstream services failed. The callee should check for this error.
+func BuildComparison(ctx context.Context, reg util.Registration, lang string) (util.ComparisonDashboardResponse, error) {
+	if len(reg.IsoCodes) == 0 {
+		return util.ComparisonDashboardResponse{}, fmt.Errorf("the registration has no countries to compare")
+	}
+
+	response := util.ComparisonDashboardResponse{
+		Name:      reg.Country,
+		IsoCodes:  reg.IsoCodes,
+		Countries: make([]util.DashboardResponse, 0, len(reg.IsoCodes)),
+	}
+
+	for _, isoCode := range reg.IsoCodes {
+		features, country, err := buildFeatures(ctx, isoCode, reg.Features, lang)
+		if err != nil {
+			return util.ComparisonDashboardResponse{}, fmt.Errorf("unable to populate %v: %w", isoCode, err)
+		}
+
+		response.Countries = append(response.Countries, util.DashboardResponse{
+			Name:          CountryName(country, lang),
+			Isocode:       isoCode,
+			Features:      features,
+			LastRetrieval: time.Now().Format("2006-01-02 15:04"),
+		})
+	}
+
+	response.Comparisons = compare(response.Countries, reg.Features)
+	response.LastRetrieval = time.Now().Format("2006-01-02 15:04")
+
+	return response, nil
+}
+
+// compare derives comparisons between the populated countries. Only features that are enabled are compared.
+func compare(countries []util.DashboardResponse, enabled util.Features) util.DashboardComparisons {
+	var comparisons util.DashboardComparisons
+
+	if enabled.Population {
+		comparisons.HighestPopulation, comparisons.LowestPopulation = findExtremes(countries,
+			func(f util.DashboardFeatures) float64 { return float64(f.Population) })
+	}
+	if enabled.Area {
+		comparisons.LargestArea, comparisons.SmallestArea = findExtremes(countries,
+			func(f util.DashboardFeatures) float64 { return f.Area })
+	}
+	if enabled.Temperature {
+		comparisons.HighestTemperature, comparisons.LowestTemperature = findExtremes(countries,
+			func(f util.DashboardFeatures) float64 { return f.Temperature })
+		difference := comparisons.HighestTemperature.Value - comparisons.LowestTemperature.Value
+		comparisons.TemperatureDifference = &difference
+	}
+	if enabled.Precipitation {
+		comparisons.HighestPrecipitation, comparisons.LowestPrecipitation = findExtremes(countries,
+			func(f util.DashboardFeatures) float64 { return f.Precipitation })
+		difference := comparisons.HighestPrecipitation.Value - comparisons.LowestPrecipitation.Value
+		comparisons.PrecipitationDifference = &difference
+	}
+
+	return comparisons
+}
+
+// findExtremes finds the countries with the highest and the lowest value of a feature.
+// If two countries have the same value, the first one is kept.
+func findExtremes(countries []util.DashboardResponse, value func(util.DashboardFeatures) float64) (*util.CountryValue, *util.CountryValue) {
+	var highest, lowest *util.CountryValue
+	for _, country := range countries {
+		v := value(country.Features)
+		if highest == nil || v > highest.Value {
+			highest = &util.CountryValue{IsoCode: country.Isocode, Value: v}
+		}
+		if lowest == nil || v < lowest.Value {
+			lowest = &util.CountryValue{IsoCode: country.Isocode, Value: v}
+		}
+	}
+	return highest, lowest
+}
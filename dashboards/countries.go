@@ -0,0 +1,76 @@
+package dashboards
+
+import (
+	"assignment2/upstream"
+	"assignment2/util"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownCountry is returned when a country does not exist in REST Countries.
+var ErrUnknownCountry = errors.New("unknown country")
+
+// ErrInconsistentCountry is returned when a country's name and ISO code refer to different countries.
+var ErrInconsistentCountry = errors.New("the country and the ISO code do not match")
+
+// ResolveCountry looks up a country by its name, its ISO code or both, and checks that they are consistent.
+//
+// Parameters:
+// - ctx: cancels the requests to REST Countries. Handlers should pass the request's context.
+// - name: the country's name. Both the common and the official names, and alternative spellings, are accepted.
+// - isoCode: the country's ISO 3166-1 alpha-2 or alpha-3 code.
+//
+// Returns:
+// - The country is returned if it was found. Callers should normalize to the country's common name and cca2.
+// - ErrUnknownCountry or ErrInconsistentCountry is returned (wrapped) if the country is invalid. Other errors mean
+// that REST Countries could not be reached.
+func ResolveCountry(ctx context.Context, name string, isoCode string) (util.Country, error) {
+	name = strings.TrimSpace(name)
+	isoCode = strings.TrimSpace(isoCode)
+
+	if name == "" && isoCode == "" {
+		return util.Country{}, fmt.Errorf("%w: a country or an ISO code is required", ErrUnknownCountry)
+	}
+
+	// Only the name is known
+	if isoCode == "" {
+		countries, err := GetCountryByName(ctx, name)
+		if errors.Is(err, upstream.ErrNotFound) {
+			return util.Country{}, fmt.Errorf("%w: no country is named %q", ErrUnknownCountry, name)
+		}
+		if err != nil {
+			return util.Country{}, err
+		}
+		return countries[0], nil
+	}
+
+	country, err := GetCountry(ctx, isoCode)
+	if errors.Is(err, upstream.ErrNotFound) {
+		return util.Country{}, fmt.Errorf("%w: no country has the ISO code %q", ErrUnknownCountry, isoCode)
+	}
+	if err != nil {
+		return util.Country{}, err
+	}
+
+	if name != "" && !hasName(country, name) {
+		return util.Country{}, fmt.Errorf("%w: %q is not the country with ISO code %q (%v)",
+			ErrInconsistentCountry, name, isoCode, country.Name.Common)
+	}
+
+	return country, nil
+}
+
+// hasName tells whether a country is known by the name. The name is matched case-insensitively.
+func hasName(country util.Country, name string) bool {
+	if strings.EqualFold(country.Name.Common, name) || strings.EqualFold(country.Name.Official, name) {
+		return true
+	}
+	for _, spelling := range country.AltSpellings {
+		if strings.EqualFold(spelling, name) {
+			return true
+		}
+	}
+	return false
+}
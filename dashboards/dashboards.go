@@ -0,0 +1,206 @@
+// dashboards package populates dashboards from registrations. It retrieves information about countries, weather
+// forecasts and exchange rates from the upstream APIs (or the stub services), and keeps only the features that a
+// registration has asked for.
+//
+// Handlers and background workers should build dashboards through this package, so all dashboards are populated
+// the exact same way.
+package dashboards
+
+import (
+	"assignment2/util"
+	"context"
+	"sort"
+	"time"
+)
+
+// Build populates the dashboard of a single-country registration.
+//
+// Parameters:
+// - ctx: cancels the requests to the upstream services. Handlers should pass the request's context.
+// - reg: the registration to populate the dashboard for.
+// - lang: the language of the country's name, the capital and the currency names. See util.NegotiateLanguage.
+//
+// Returns:
+// - The populated dashboard is returned.
+// - An error is returned if one of the upstream services failed. The callee should check for this error.
+func Build(ctx context.Context, reg util.Registration, lang string) (util.DashboardResponse, error) {
+	features, country, err := buildFeatures(ctx, reg.IsoCode, reg.Features, lang)
+	if err != nil {
+		return util.DashboardResponse{}, err
+	}
+
+	// Registrations without a country name, and dashboards in other languages, use the name from REST Countries
+	name := reg.Country
+	if name == "" || lang != util.LANGUAGE_DEFAULT {
+		name = CountryName(country, lang)
+	}
+
+	return util.DashboardResponse{
+		Name:          name,
+		Isocode:       reg.IsoCode,
+		Features:      features,
+		LastRetrieval: time.Now().Format("2006-01-02 15:04"),
+	}, nil
+}
+
+// BuildAny populates the dashboard of any registration. Comparison registrations get a comparison dashboard (see
+// BuildComparison), and other registrations a single dashboard (see Build).
+func BuildAny(ctx context.Context, reg util.Registration, lang string) (any, error) {
+	if reg.IsComparison() {
+		return BuildComparison(ctx, reg, lang)
+	}
+	return Build(ctx, reg, lang)
+}
+
+// buildFeatures retrieves information about a country from the upstream services, and returns the features
+// which are enabled. The country itself is also returned, so callers can use information that is not a feature.
+// The capital and the currency names are translated to the language.
+func buildFeatures(ctx context.Context, isoCode string, enabled util.Features, lang string) (util.DashboardFeatures, util.Country, error) {
+	var features util.DashboardFeatures
+
+	// Find info about the country using REST Countries API or the Stub service.
+	country, err := GetCountry(ctx, isoCode)
+	if err != nil {
+		return features, country, err
+	}
+
+	// Find the coordinates of the given contry:
+	var latitude, longitude float64
+	if len(country.LatitudeAndLongitude) == 2 {
+		latitude = country.LatitudeAndLongitude[0]
+		longitude = country.LatitudeAndLongitude[1]
+	}
+
+	// The weather forecast is only needed for the weather features
+	if enabled.Temperature || enabled.Precipitation {
+		weatherForecast, err := GetWeather(ctx, latitude, longitude)
+		if err != nil {
+			return features, country, err
+		}
+
+		// Find mean-values for temperature and precipitation
+		if enabled.Temperature {
+			features.Temperature = findMean(weatherForecast.Hourly.Temperature)
+		}
+		if enabled.Precipitation {
+			features.Precipitation = findMean(weatherForecast.Hourly.Precipitation)
+		}
+	}
+
+	// Find the currency rates for the target currencies.
+	features.TargetCurrencies = make(map[string]float64)
+	if len(enabled.TargetCurrencies) > 0 {
+		currency, err := GetCurrency(ctx, findCurrencyCode(country))
+		if err != nil {
+			return features, country, err
+		}
+		for _, val := range enabled.TargetCurrencies {
+			features.TargetCurrencies[val] = currency.Rates[val]
+		}
+		features.CurrencyNames = currencyNames(country, append([]string{findCurrencyCode(country)}, enabled.TargetCurrencies...), lang)
+	}
+
+	// Fix the coordinates
+	if enabled.Coordinates {
+		features.Coordinates.Latitude = latitude
+		features.Coordinates.Longitude = longitude
+	}
+
+	// Fix the other features:
+	if enabled.Area {
+		features.Area = country.Area
+	}
+	if enabled.Capital && len(country.CapitalCity) > 0 {
+		features.Capital = capitalName(country.CapitalCity[0], lang)
+	}
+	if enabled.Population {
+		features.Population = country.Population
+	}
+	if enabled.Languages {
+		features.Languages = findLanguages(country.Languages)
+	}
+	if enabled.Timezones {
+		features.Timezones = country.Timezones
+	}
+	if enabled.Region {
+		features.Region = country.Region
+		features.Subregion = country.Subregion
+	}
+	if enabled.Borders {
+		features.Borders = country.Borders
+	}
+	if enabled.CallingCodes {
+		features.CallingCodes = findCallingCodes(country.CallingCode)
+	}
+	if enabled.Flag {
+		features.Flag = &country.Flags
+	}
+	if enabled.DrivingSide {
+		features.DrivingSide = country.Car.Side
+	}
+	if enabled.TopLevelDomains {
+		features.TopLevelDomains = country.TopLevelDomains
+	}
+
+	// The computed features use the values found above
+	if len(enabled.Computed) > 0 {
+		features.Computed = computeFeatures(enabled.Computed, features)
+	}
+
+	return features, country, nil
+}
+
+// findCurrencyCode finds the currency code of a country.
+// If the country has more than one currency, the first valid code is used.
+func findCurrencyCode(country util.Country) string {
+	codes := make([]string, 0, len(country.Currencies))
+	for key := range country.Currencies {
+		if key != "" && len(key) == 3 {
+			codes = append(codes, key)
+		}
+	}
+	if len(codes) == 0 {
+		return ""
+	}
+
+	// Map iteration order is random. Sort the codes so the same currency is always used.
+	sort.Strings(codes)
+	return codes[0]
+}
+
+// findMean is a function that calculates the mean value of a list
+// containing floats, and returns it as a float64
+func findMean(list []float64) float64 {
+	if len(list) == 0 {
+		return 0
+	}
+	var sum float64 = 0
+	for _, value := range list {
+		sum += value
+	}
+	return sum / float64(len(list))
+}
+
+// findLanguages returns the names of the languages spoken in a country, sorted alphabetically.
+// REST Countries keys the languages by their ISO 639-3 code, which is not needed in the dashboard.
+func findLanguages(languages map[string]string) []string {
+	names := make([]string, 0, len(languages))
+	for _, name := range languages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// findCallingCodes combines the root of a country's IDD code with each of its suffixes.
+// Example: root "+4" and suffixes ["7"] returns ["+47"].
+func findCallingCodes(idd util.CallingCode) []string {
+	if len(idd.Suffixes) == 0 && idd.Root != "" {
+		return []string{idd.Root}
+	}
+	codes := make([]string, 0, len(idd.Suffixes))
+	for _, suffix := range idd.Suffixes {
+		codes = append(codes, idd.Root+suffix)
+	}
+	return codes
+}
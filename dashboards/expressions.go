@@ -0,0 +1,260 @@
+package dashboards
+
+import (
+	"assignment2/models"
+	"assignment2/util"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Limits of computed features, so a registration can't make its dashboard expensive to build.
+const (
+	MAX_COMPUTED_FEATURES = 10
+	MAX_EXPRESSION_LENGTH = 200
+)
+
+// Features only expressions may use, in addition to those in 'models.FEATURE_*'.
+const (
+	FEATURE_LATITUDE  = "coordinates.latitude"
+	FEATURE_LONGITUDE = "coordinates.longitude"
+)
+
+// computedName is the format of a computed feature's name.
+var computedName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// ValidateComputed ensures that the computed features of a registration are valid. A computed feature is a name and
+// an arithmetic expression over the registration's other features.
+//
+// # Rules
+//
+// - Names start with a letter, followed by letters, digits or underscores.
+// - Expressions only contain numbers, parentheses, the operators + - * / and the names of numeric features.
+// - Numeric features are temperature, precipitation, population, area, coordinates.latitude, coordinates.longitude
+// and targetCurrencies.<CODE>. A feature must be enabled in the registration to be used.
+//
+// # Example
+//
+// {"density": "population / area", "eurPerUsd": "targetCurrencies.EUR / targetCurrencies.USD"}
+func ValidateComputed(features util.Features) error {
+	if len(features.Computed) > MAX_COMPUTED_FEATURES {
+		return fmt.Errorf("a registration may have at most %d computed features", MAX_COMPUTED_FEATURES)
+	}
+
+	// Sort the names, so the same error is always returned first
+	names := make([]string, 0, len(features.Computed))
+	for name := range features.Computed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !computedName.MatchString(name) {
+			return fmt.Errorf("the computed feature name '%v' must start with a letter, followed by letters, digits "+
+				"or underscores", name)
+		}
+
+		expression := features.Computed[name]
+		if len(expression) > MAX_EXPRESSION_LENGTH {
+			return fmt.Errorf("the expression of '%v' is longer than %d characters", name, MAX_EXPRESSION_LENGTH)
+		}
+
+		node, err := parser.ParseExpr(expression)
+		if err != nil {
+			return fmt.Errorf("the expression of '%v' is invalid: %v", name, err)
+		}
+		if err := checkExpression(node, features); err != nil {
+			return fmt.Errorf("the expression of '%v' is invalid: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// checkExpression walks an expression, and ensures that it only contains numbers, arithmetic and enabled features.
+func checkExpression(node ast.Expr, enabled util.Features) error {
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		if n.Kind != token.INT && n.Kind != token.FLOAT {
+			return fmt.Errorf("'%v' is not a number", n.Value)
+		}
+		// Go literals like 0x10 and 1e400 are parsed as numbers, but can't be evaluated
+		if _, err := strconv.ParseFloat(n.Value, 64); err != nil {
+			return fmt.Errorf("'%v' is not a decimal number, or is out of range", n.Value)
+		}
+		return nil
+	case *ast.ParenExpr:
+		return checkExpression(n.X, enabled)
+	case *ast.UnaryExpr:
+		if n.Op != token.ADD && n.Op != token.SUB {
+			return fmt.Errorf("the operator '%v' is not allowed", n.Op)
+		}
+		return checkExpression(n.X, enabled)
+	case *ast.BinaryExpr:
+		if n.Op != token.ADD && n.Op != token.SUB && n.Op != token.MUL && n.Op != token.QUO {
+			return fmt.Errorf("the operator '%v' is not allowed", n.Op)
+		}
+		if err := checkExpression(n.X, enabled); err != nil {
+			return err
+		}
+		return checkExpression(n.Y, enabled)
+	case *ast.Ident, *ast.SelectorExpr:
+		name, _ := featureName(n)
+		if !featureEnabled(name, enabled) {
+			return fmt.Errorf("'%v' is not a numeric feature enabled in the registration", name)
+		}
+		return nil
+	default:
+		return fmt.Errorf("only numbers, features, parentheses and the operators + - * / are allowed")
+	}
+}
+
+// featureName returns the feature an identifier refers to. Example: targetCurrencies.EUR
+func featureName(node ast.Expr) (string, bool) {
+	switch n := node.(type) {
+	case *ast.Ident:
+		return n.Name, true
+	case *ast.SelectorExpr:
+		if x, ok := n.X.(*ast.Ident); ok {
+			return x.Name + "." + n.Sel.Name, true
+		}
+	}
+	return "", false
+}
+
+// featureEnabled checks whether a numeric feature is enabled.
+func featureEnabled(name string, enabled util.Features) bool {
+	switch name {
+	case models.FEATURE_TEMPERATURE:
+		return enabled.Temperature
+	case models.FEATURE_PRECIPITATION:
+		return enabled.Precipitation
+	case models.FEATURE_POPULATION:
+		return enabled.Population
+	case models.FEATURE_AREA:
+		return enabled.Area
+	case FEATURE_LATITUDE, FEATURE_LONGITUDE:
+		return enabled.Coordinates
+	}
+
+	currency, ok := strings.CutPrefix(name, models.FEATURE_CURRENCY_PREFIX)
+	for _, target := range enabled.TargetCurrencies {
+		if ok && target == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// featureValue finds the value of a numeric feature in a dashboard. It returns false if the dashboard has no value
+// for the feature.
+func featureValue(name string, features util.DashboardFeatures) (float64, bool) {
+	switch name {
+	case models.FEATURE_TEMPERATURE:
+		return features.Temperature, true
+	case models.FEATURE_PRECIPITATION:
+		return features.Precipitation, true
+	case models.FEATURE_POPULATION:
+		return float64(features.Population), true
+	case models.FEATURE_AREA:
+		return features.Area, true
+	case FEATURE_LATITUDE:
+		return features.Coordinates.Latitude, true
+	case FEATURE_LONGITUDE:
+		return features.Coordinates.Longitude, true
+	}
+
+	currency, ok := strings.CutPrefix(name, models.FEATURE_CURRENCY_PREFIX)
+	if !ok {
+		return 0, false
+	}
+	// Currencies without a rate are 0 in dashboards
+	rate := features.TargetCurrencies[currency]
+	return rate, rate != 0
+}
+
+// computeFeatures evaluates the computed features of a registration over the dashboard's features. A computed
+// feature that can't be evaluated, for example because of a division by zero, is nil.
+func computeFeatures(computed map[string]string, features util.DashboardFeatures) map[string]*float64 {
+	out := make(map[string]*float64, len(computed))
+	for name, expression := range computed {
+		out[name] = nil
+
+		node, err := parser.ParseExpr(expression)
+		if err != nil {
+			log.Printf("Failed to parse the computed feature %v: %v\n", name, err)
+			continue
+		}
+
+		value, err := evaluate(node, features)
+		if err != nil {
+			continue
+		}
+		out[name] = &value
+	}
+	return out
+}
+
+// evaluate calculates the value of an expression. The expression must have been checked by checkExpression.
+func evaluate(node ast.Expr, features util.DashboardFeatures) (float64, error) {
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		return strconv.ParseFloat(n.Value, 64)
+	case *ast.ParenExpr:
+		return evaluate(n.X, features)
+	case *ast.UnaryExpr:
+		x, err := evaluate(n.X, features)
+		if n.Op == token.SUB {
+			x = -x
+		}
+		return x, err
+	case *ast.BinaryExpr:
+		x, err := evaluate(n.X, features)
+		if err != nil {
+			return 0, err
+		}
+		y, err := evaluate(n.Y, features)
+		if err != nil {
+			return 0, err
+		}
+
+		var result float64
+		switch n.Op {
+		case token.ADD:
+			result = x + y
+		case token.SUB:
+			result = x - y
+		case token.MUL:
+			result = x * y
+		case token.QUO:
+			if y == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			result = x / y
+		default:
+			return 0, fmt.Errorf("the operator '%v' is not allowed", n.Op)
+		}
+
+		// JSON can't encode infinite numbers
+		if math.IsInf(result, 0) || math.IsNaN(result) {
+			return 0, fmt.Errorf("the result is not a finite number")
+		}
+		return result, nil
+	case *ast.Ident, *ast.SelectorExpr:
+		name, _ := featureName(n)
+		value, ok := featureValue(name, features)
+		if !ok {
+			return 0, fmt.Errorf("the dashboard has no value for '%v'", name)
+		}
+		return value, nil
+	default:
+		return 0, fmt.Errorf("only numbers, features, parentheses and the operators + - * / are allowed")
+	}
+}
@@ -0,0 +1,77 @@
+package dashboards
+
+import (
+	"assignment2/util"
+	"context"
+	_ "embed"
+	"encoding/json"
+)
+
+// Translations of capitals and currencies are not offered by REST Countries, so they are kept in translations.json.
+// Terms and languages that are missing from the file are returned in English.
+//
+//go:embed translations.json
+var translationsFile []byte
+
+// glossary holds the translations of translations.json. Both maps are keyed by the English term (the capital's name
+// or the currency code), and then by the ISO 639-1 language.
+var glossary struct {
+	Capitals   map[string]map[string]string `json:"capitals"`
+	Currencies map[string]map[string]string `json:"currencies"`
+}
+
+func init() {
+	if err := json.Unmarshal(translationsFile, &glossary); err != nil {
+		// The file is embedded at compile time, so this only happens if it was edited wrongly
+		panic("translations.json is invalid: " + err.Error())
+	}
+}
+
+// CountryName returns the common name of a country in a language. The translations of REST Countries are used first,
+// then the country's native names. English is returned if the country has no name in the language.
+func CountryName(country util.Country, lang string) string {
+	key := util.LanguageKey(lang)
+	if name, ok := country.Translations[key]; ok && name.Common != "" {
+		return name.Common
+	}
+	if name, ok := country.Name.NativeName[key]; ok && name.Common != "" {
+		return name.Common
+	}
+	return country.Name.Common
+}
+
+// LocalizeCountry returns the common name of the country with an ISO code in a language. See CountryName.
+func LocalizeCountry(ctx context.Context, isoCode string, lang string) (string, error) {
+	country, err := GetCountry(ctx, isoCode)
+	if err != nil {
+		return "", err
+	}
+	return CountryName(country, lang), nil
+}
+
+// capitalName returns the name of a capital in a language, or the English name if it has no translation.
+func capitalName(capital string, lang string) string {
+	if name, ok := glossary.Capitals[capital][lang]; ok {
+		return name
+	}
+	return capital
+}
+
+// currencyNames returns the names of the currencies in a language. The name in English is used for currencies that
+// are not translated, and the country's own currency is also named by REST Countries. Currencies without a name are
+// left out.
+func currencyNames(country util.Country, codes []string, lang string) map[string]string {
+	names := make(map[string]string, len(codes))
+	for _, code := range codes {
+		if name, ok := glossary.Currencies[code][lang]; ok {
+			names[code] = name
+		} else if name, ok := glossary.Currencies[code][util.LANGUAGE_DEFAULT]; ok {
+			names[code] = name
+		} else if currency, ok := country.Currencies[code].(map[string]any); ok {
+			if name, ok := currency["name"].(string); ok {
+				names[code] = name
+			}
+		}
+	}
+	return names
+}
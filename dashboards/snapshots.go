@@ -0,0 +1,133 @@
+package dashboards
+
+import (
+	"assignment2/database"
+	"assignment2/upstream"
+	"assignment2/util"
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// SnapshotCheckInterval is how often the scheduler looks for registrations with a snapshot due.
+var SnapshotCheckInterval = time.Minute
+
+// DEFAULT_SNAPSHOT_RETENTION_DAYS is how long snapshots are kept if config.yaml does not say otherwise.
+const DEFAULT_SNAPSHOT_RETENTION_DAYS = 92
+
+var (
+	// lastSnapshots is the time of the latest snapshot of each registration, so the database is only asked once.
+	lastSnapshots      = map[string]time.Time{}
+	lastSnapshotsMutex sync.Mutex
+)
+
+// ScheduleSnapshots takes the snapshots of registrations when they are due, and deletes snapshots older than the
+// retention period. It never returns, and must only be started once.
+//
+// # Example
+//
+// go dashboards.ScheduleSnapshots()
+func ScheduleSnapshots() {
+	ticker := time.NewTicker(SnapshotCheckInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		TakeDueSnapshots(now)
+
+		deleted, err := PruneSnapshots(now)
+		if err != nil {
+			log.Println("Failed to delete old snapshots:", err)
+		} else if deleted > 0 {
+			log.Printf("Deleted %v snapshots older than the retention period\n", deleted)
+		}
+	}
+}
+
+// TakeDueSnapshots stores the dashboard of every registration with a snapshot due. A registration is due once per
+// hour or day of its schedule (in UTC), so a snapshot is never taken twice in the same period. Registrations whose
+// dashboard fails to build are tried again on the next check.
+func TakeDueSnapshots(now time.Time) {
+	registrations, err := database.GetAllRegistrations()
+	if err != nil {
+		log.Println("Failed to get registrations for snapshots:", err)
+		return
+	}
+
+	for _, reg := range registrations {
+		period := util.SchedulePeriod(reg.Snapshots)
+		if period == 0 || !snapshotDue(reg.ID, now, period) {
+			continue
+		}
+
+		if err := TakeSnapshot(reg, now); err != nil {
+			log.Printf("Failed to take a snapshot of %v: %v\n", reg.ID, err)
+		}
+	}
+}
+
+// TakeSnapshot builds the dashboard of a registration and stores it as a snapshot taken at a time. The dashboard is
+// built from the latest data, not from the cache.
+func TakeSnapshot(reg util.Registration, now time.Time) error {
+	dashboard, err := BuildAny(upstream.WithRefresh(context.Background()), reg, util.LANGUAGE_DEFAULT)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(dashboard)
+	if err != nil {
+		return err
+	}
+
+	snapshot := util.Snapshot{RegistrationId: reg.ID, Time: now.UTC(), Dashboard: encoded}
+	if err := database.AddSnapshot(snapshot); err != nil {
+		return err
+	}
+
+	lastSnapshotsMutex.Lock()
+	lastSnapshots[reg.ID] = snapshot.Time
+	lastSnapshotsMutex.Unlock()
+	return nil
+}
+
+// snapshotDue checks whether a registration has no snapshot in the current period.
+func snapshotDue(registrationId string, now time.Time, period time.Duration) bool {
+	lastSnapshotsMutex.Lock()
+	last, ok := lastSnapshots[registrationId]
+	lastSnapshotsMutex.Unlock()
+
+	if !ok {
+		// Find the latest snapshot in the database, so restarting the service doesn't take extra snapshots.
+		snapshots, err := database.GetSnapshots(registrationId, time.Time{}, time.Time{})
+		if err != nil {
+			log.Printf("Failed to get the snapshots of %v: %v\n", registrationId, err)
+			return false
+		}
+		if len(snapshots) > 0 {
+			last = snapshots[len(snapshots)-1].Time
+
+			lastSnapshotsMutex.Lock()
+			lastSnapshots[registrationId] = last
+			lastSnapshotsMutex.Unlock()
+		}
+	}
+
+	return last.IsZero() || now.Truncate(period).After(last.Truncate(period))
+}
+
+// PruneSnapshots deletes the snapshots that are older than the retention period in config.yaml.
+//
+// Returns:
+// The number of deleted snapshots, and an error object if something went wrong.
+func PruneSnapshots(now time.Time) (int, error) {
+	return database.DeleteSnapshotsBefore(now.AddDate(0, 0, -SnapshotRetentionDays()))
+}
+
+// SnapshotRetentionDays returns the number of days snapshots are kept.
+func SnapshotRetentionDays() int {
+	if util.Config.Snapshots.RetentionDays > 0 {
+		return util.Config.Snapshots.RetentionDays
+	}
+	return DEFAULT_SNAPSHOT_RETENTION_DAYS
+}
@@ -0,0 +1,270 @@
+package dashboards
+
+import (
+	"assignment2/database"
+	"assignment2/models"
+	"assignment2/notifications"
+	"assignment2/upstream"
+	"assignment2/util"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Timing of dashboard streams. These are variables so tests can shorten them.
+var (
+	// StreamRefreshInterval is how often a watched dashboard is rebuilt to pick up new data from the upstream APIs.
+	StreamRefreshInterval = 5 * time.Minute
+	// StreamHeartbeatInterval is how often an idle stream sends a heartbeat to keep the connection open.
+	StreamHeartbeatInterval = 30 * time.Second
+	// StreamLinger is how long a dashboard is still watched after its last watcher leaves, so a client that
+	// reconnects can resume where it left off.
+	StreamLinger = time.Minute
+)
+
+// streamHistory is the number of updates kept for resuming a stream.
+const streamHistory = 32
+
+// Events of a dashboard stream.
+const (
+	UPDATE_DASHBOARD = "dashboard"
+	UPDATE_DELETED   = "deleted"
+)
+
+// Update is a change to a watched dashboard.
+type Update struct {
+	Id    string // Id is unique within the process and increases with every update.
+	Event string // Event is 'UPDATE_DASHBOARD' or 'UPDATE_DELETED'.
+	Data  []byte // Data is the dashboard encoded as JSON, or the ID of the deleted registration.
+}
+
+// updateCounter is the ID of the latest update of any dashboard.
+var updateCounter atomic.Int64
+
+// watchedDashboard rebuilds a dashboard when its registration changes or its data is refreshed, and sends updates to
+// its watchers. A dashboard is only watched once, no matter how many clients watch it.
+type watchedDashboard struct {
+	id       string
+	mutex    sync.Mutex
+	watchers map[chan Update]struct{}
+	history  []Update
+	current  []byte // current is the dashboard without retrieval times, to tell if the data changed.
+	linger   *time.Timer
+	stop     chan struct{}
+
+	// registration is the registration the dashboard was last built from. It is only used by run.
+	registration *util.Registration
+}
+
+var (
+	watched      = map[string]*watchedDashboard{}
+	watchedMutex sync.Mutex
+)
+
+// Watch starts watching the dashboard of a registration. The returned channel receives an update whenever the
+// registration changes, or the upstream data of the dashboard changes. The current dashboard is always sent first.
+//
+// If lastUpdateId is the ID of an update that is still kept, the updates after it are sent first instead, so a client
+// can resume where it left off. An empty lastUpdateId starts from the current dashboard.
+//
+// The watcher must call stop when it is done. stop closes the channel.
+func Watch(registrationId string, lastUpdateId string) (<-chan Update, func()) {
+	watchedMutex.Lock()
+	d, ok := watched[registrationId]
+	if !ok {
+		d = &watchedDashboard{id: registrationId, watchers: map[chan Update]struct{}{}, stop: make(chan struct{})}
+		watched[registrationId] = d
+		go d.run()
+	}
+
+	updates := make(chan Update, streamHistory)
+
+	// The watcher is added before releasing watchedMutex, so the dashboard can't stop watching in between.
+	d.mutex.Lock()
+	watchedMutex.Unlock()
+	if d.linger != nil {
+		d.linger.Stop()
+		d.linger = nil
+	}
+	for _, update := range d.missedUpdates(lastUpdateId) {
+		updates <- update
+	}
+	d.watchers[updates] = struct{}{}
+	d.mutex.Unlock()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() { d.leave(updates) })
+	}
+	return updates, stop
+}
+
+// missedUpdates finds the updates a watcher must be sent when it starts watching. d.mutex must be held.
+func (d *watchedDashboard) missedUpdates(lastUpdateId string) []Update {
+	if len(d.history) == 0 {
+		// Nothing is built yet. The first dashboard is sent to every watcher when it is ready.
+		return nil
+	}
+
+	for i, update := range d.history {
+		if update.Id == lastUpdateId {
+			return d.history[i+1:]
+		}
+	}
+
+	// Unknown or forgotten update, so start over from the current dashboard.
+	return d.history[len(d.history)-1:]
+}
+
+// leave removes a watcher. The dashboard stops being watched once no watcher has returned within 'StreamLinger'.
+func (d *watchedDashboard) leave(updates chan Update) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	delete(d.watchers, updates)
+	close(updates)
+	if len(d.watchers) > 0 {
+		return
+	}
+
+	d.linger = time.AfterFunc(StreamLinger, func() {
+		watchedMutex.Lock()
+		defer watchedMutex.Unlock()
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+
+		// A watcher may have arrived while waiting for the locks.
+		if len(d.watchers) > 0 || watched[d.id] != d {
+			return
+		}
+		delete(watched, d.id)
+		close(d.stop)
+	})
+}
+
+// run rebuilds the dashboard whenever its registration changes and on every refresh interval, until it is stopped.
+func (d *watchedDashboard) run() {
+	// The watched registration may be changed to another country, so the events of every country are checked.
+	events, unsubscribe := notifications.Subscribe(models.NotificationDatabaseModel{})
+	defer unsubscribe()
+
+	refresh := time.NewTicker(StreamRefreshInterval)
+	defer refresh.Stop()
+
+	d.rebuild(false)
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-refresh.C:
+			d.rebuild(false)
+		case event := <-events:
+			// Only changing or deleting a registration may change the dashboard. Events of other registrations only
+			// read the watched registration, and don't retrieve any upstream data.
+			if event.Event == util.EVENT_CHANGE || event.Event == util.EVENT_DELETE {
+				d.rebuild(true)
+			}
+		}
+	}
+}
+
+// rebuild builds the dashboard and sends it to the watchers if anything but the retrieval time changed. If
+// onlyIfChanged is set, the dashboard is only built if its registration changed since it was last built.
+// If the registration was deleted, the watchers are told so once.
+func (d *watchedDashboard) rebuild(onlyIfChanged bool) {
+	reg, err := database.GetSingleRegistrationByID(d.id)
+	if errors.Is(err, database.ErrRegistrationNotFound) {
+		deleted, _ := json.Marshal(map[string]string{"id": d.id})
+		d.send(UPDATE_DELETED, deleted, nil)
+		return
+	}
+	if err != nil {
+		// The stream is kept open, and the dashboard is rebuilt on the next change or refresh.
+		log.Printf("Failed to get the registration of the watched dashboard %v: %v", d.id, err)
+		return
+	}
+	if onlyIfChanged && d.registration != nil && reflect.DeepEqual(*d.registration, reg) {
+		return
+	}
+
+	dashboard, current, err := buildWatched(reg)
+	if err != nil {
+		log.Printf("Failed to rebuild the watched dashboard %v: %v", d.id, err)
+		return
+	}
+
+	data, err := json.Marshal(dashboard)
+	if err != nil {
+		log.Printf("Failed to encode the watched dashboard %v: %v", d.id, err)
+		return
+	}
+	d.registration = &reg
+	d.send(UPDATE_DASHBOARD, data, current)
+}
+
+// buildWatched builds the dashboard of a registration. The dashboard is also returned encoded without its retrieval
+// times, to tell if its data changed since it was last built.
+func buildWatched(reg util.Registration) (any, []byte, error) {
+	// The cache is skipped, or changes would only be seen when the cached responses expire
+	ctx := upstream.WithRefresh(context.Background())
+	if reg.IsComparison() {
+		comparison, err := BuildComparison(ctx, reg, util.LANGUAGE_DEFAULT)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		withoutTimes := comparison
+		withoutTimes.LastRetrieval = ""
+		withoutTimes.Countries = append([]util.DashboardResponse(nil), comparison.Countries...)
+		for i := range withoutTimes.Countries {
+			withoutTimes.Countries[i].LastRetrieval = ""
+		}
+		current, err := json.Marshal(withoutTimes)
+		return comparison, current, err
+	}
+
+	dashboard, err := Build(ctx, reg, util.LANGUAGE_DEFAULT)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	withoutTimes := dashboard
+	withoutTimes.LastRetrieval = ""
+	current, err := json.Marshal(withoutTimes)
+	return dashboard, current, err
+}
+
+// send records an update and sends it to every watcher, unless it doesn't change anything.
+// A watcher that is too far behind to receive it is skipped, and can resume with the ID of its last update.
+func (d *watchedDashboard) send(event string, data []byte, current []byte) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if len(d.history) > 0 {
+		last := d.history[len(d.history)-1]
+		if last.Event == event && bytes.Equal(d.current, current) {
+			return
+		}
+	}
+	d.current = current
+
+	update := Update{Id: strconv.FormatInt(updateCounter.Add(1), 10), Event: event, Data: data}
+	d.history = append(d.history, update)
+	if len(d.history) > streamHistory {
+		d.history = d.history[len(d.history)-streamHistory:]
+	}
+
+	for watcher := range d.watchers {
+		select {
+		case watcher <- update:
+		default:
+		}
+	}
+}
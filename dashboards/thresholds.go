@@ -0,0 +1,201 @@
+package dashboards
+
+import (
+	"assignment2/database"
+	"assignment2/models"
+	"assignment2/notifications"
+	"assignment2/upstream"
+	"assignment2/util"
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ThresholdCheckInterval is how often the conditions of THRESHOLD notifications are checked.
+var ThresholdCheckInterval = 10 * time.Minute
+
+// thresholdKey identifies a condition of a notification, checked for a country.
+type thresholdKey struct {
+	notification string
+	country      string
+	condition    string
+}
+
+var (
+	// thresholdStates tells whether each condition held when it was last checked. Conditions that have not been
+	// checked yet did not hold.
+	thresholdStates      = map[thresholdKey]bool{}
+	thresholdStatesMutex sync.Mutex
+)
+
+// ScheduleThresholds checks the conditions of THRESHOLD notifications on every 'ThresholdCheckInterval'. The
+// conditions are seeded first, so the conditions that already hold when the service starts are not sent again.
+// It never returns, and must only be started once.
+//
+// # Example
+//
+// go dashboards.ScheduleThresholds()
+func ScheduleThresholds() {
+	SeedThresholds()
+
+	ticker := time.NewTicker(ThresholdCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		CheckThresholds()
+	}
+}
+
+// CheckThresholds checks the conditions of every THRESHOLD notification against the countries of the registrations,
+// and notifies the subscriber of each condition that started or stopped holding since it was last checked.
+//
+// A notification with a country is only checked for that country. Otherwise, it is checked for every registered
+// country. Exchange rate conditions on a currency the country has no rate for are skipped.
+func CheckThresholds() {
+	checkThresholds(true)
+}
+
+// SeedThresholds checks the conditions of every THRESHOLD notification like CheckThresholds, but only records whether
+// they hold, without notifying the subscribers. The states are kept in memory, so this is how the service learns which
+// conditions already held before it started.
+func SeedThresholds() {
+	checkThresholds(false)
+}
+
+// checkThresholds checks the conditions of every THRESHOLD notification, and notifies the subscribers if notify is
+// true.
+func checkThresholds(notify bool) {
+	allNotifications, err := database.GetAllNotifications()
+	if err != nil {
+		log.Println("Failed to get notifications for thresholds:", err)
+		return
+	}
+
+	var thresholds []models.NotificationDatabaseModel
+	ids := map[string]bool{}
+	for _, n := range allNotifications {
+		if n.Event == util.EVENT_THRESHOLD && len(n.Conditions) > 0 {
+			thresholds = append(thresholds, n)
+			ids[n.Id] = true
+		}
+	}
+	forgetThresholds(ids)
+	if len(thresholds) == 0 {
+		return
+	}
+
+	registrations, err := database.GetAllRegistrations()
+	if err != nil {
+		log.Println("Failed to get registrations for thresholds:", err)
+		return
+	}
+
+	for _, country := range registeredCountries(registrations) {
+		var matching []models.NotificationDatabaseModel
+		for _, n := range thresholds {
+			if n.Country == "" || n.Country == country {
+				matching = append(matching, n)
+			}
+		}
+		if len(matching) == 0 {
+			continue
+		}
+
+		// Only the features the conditions are about are retrieved, and never from the cache
+		reg := util.Registration{IsoCode: country, Features: conditionFeatures(matching)}
+		dashboard, err := Build(upstream.WithRefresh(context.Background()), reg, util.LANGUAGE_DEFAULT)
+		if err != nil {
+			log.Printf("Failed to check thresholds for %v: %v\n", country, err)
+			continue
+		}
+
+		for _, n := range matching {
+			for _, condition := range n.Conditions {
+				checkThreshold(n, country, condition, dashboard.Features, notify)
+			}
+		}
+	}
+}
+
+// checkThreshold checks a condition, and notifies the subscriber if it started or stopped holding and notify is true.
+func checkThreshold(n models.NotificationDatabaseModel, country string, c models.Condition,
+	features util.DashboardFeatures, notify bool) {
+	actual, ok := conditionValue(c, features)
+	if !ok {
+		return
+	}
+	holds := c.Holds(actual)
+
+	key := thresholdKey{notification: n.Id, country: country, condition: c.String()}
+	thresholdStatesMutex.Lock()
+	held := thresholdStates[key]
+	thresholdStates[key] = holds
+	thresholdStatesMutex.Unlock()
+
+	if holds == held || !notify {
+		return
+	}
+
+	state := models.ThresholdState{Condition: c, Actual: actual, Holds: holds}
+	if err := notifications.InvokeThreshold(n, country, state); err != nil {
+		log.Printf("Failed to send the threshold %v for %v: %v\n", c.String(), country, err)
+	}
+}
+
+// conditionValue finds the value of a condition's feature in a dashboard. It returns false if the dashboard has no
+// value for the feature.
+func conditionValue(c models.Condition, features util.DashboardFeatures) (float64, bool) {
+	return featureValue(c.Feature, features)
+}
+
+// conditionFeatures returns the features needed to check the conditions of notifications.
+func conditionFeatures(thresholds []models.NotificationDatabaseModel) util.Features {
+	var features util.Features
+	for _, n := range thresholds {
+		for _, c := range n.Conditions {
+			switch c.Feature {
+			case models.FEATURE_TEMPERATURE:
+				features.Temperature = true
+			case models.FEATURE_PRECIPITATION:
+				features.Precipitation = true
+			case models.FEATURE_POPULATION:
+				features.Population = true
+			case models.FEATURE_AREA:
+				features.Area = true
+			default:
+				features.TargetCurrencies = append(features.TargetCurrencies, c.Currency())
+			}
+		}
+	}
+	return features
+}
+
+// registeredCountries returns the ISO codes of every country in the registrations, sorted and without duplicates.
+func registeredCountries(registrations []util.Registration) []string {
+	seen := map[string]bool{}
+	var countries []string
+	for _, reg := range registrations {
+		for _, isoCode := range reg.AllIsoCodes() {
+			if isoCode != "" && !seen[isoCode] {
+				seen[isoCode] = true
+				countries = append(countries, isoCode)
+			}
+		}
+	}
+	sort.Strings(countries)
+	return countries
+}
+
+// forgetThresholds removes the states of notifications that no longer exist.
+func forgetThresholds(existing map[string]bool) {
+	thresholdStatesMutex.Lock()
+	defer thresholdStatesMutex.Unlock()
+
+	for key := range thresholdStates {
+		if !existing[key.notification] {
+			delete(thresholdStates, key)
+		}
+	}
+}
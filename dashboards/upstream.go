@@ -0,0 +1,59 @@
+package dashboards
+
+import (
+	"assignment2/upstream"
+	"assignment2/util"
+	"context"
+	"fmt"
+)
+
+// GetCountry retrieves information about a country from the REST Countries API or the Stub service.
+//
+// Parameters:
+// - ctx: cancels the request, including its retries. Handlers should pass the request's context.
+// - isoCode: the country's two-letter ISO code. Example: NO
+//
+// Returns:
+// - The country is returned if the service found it.
+// - An *upstream.Error is returned if the request failed, or if the service returned no country.
+func GetCountry(ctx context.Context, isoCode string) (util.Country, error) {
+	return upstream.Countries.ByCode(ctx, isoCode)
+}
+
+// GetCountryByName retrieves information about a country by its full name from the REST Countries API or the
+// Stub service. Both the common and the official names are matched.
+//
+// Returns:
+// - The countries that are named exactly the same as name. This is normally only one country.
+// - An *upstream.Error of the kind upstream.ErrNotFound is returned if no country has the name.
+func GetCountryByName(ctx context.Context, name string) ([]util.Country, error) {
+	return upstream.Countries.ByName(ctx, name)
+}
+
+// GetWeather retrieves the hourly weather forecast for a set of coordinates from the weather provider in
+// config.yaml: the Open Meteo API or MET Norway, or their Stub services.
+func GetWeather(ctx context.Context, latitude float64, longitude float64) (util.Weather, error) {
+	return upstream.Forecast(ctx, latitude, longitude)
+}
+
+// GetForecast retrieves the hourly weather forecast for a country. The forecast is for the country's coordinates.
+func GetForecast(ctx context.Context, isoCode string) (util.Weather, error) {
+	country, err := GetCountry(ctx, isoCode)
+	if err != nil {
+		return util.Weather{}, err
+	}
+	if len(country.LatitudeAndLongitude) != 2 {
+		return util.Weather{}, fmt.Errorf("the country %v has no coordinates", isoCode)
+	}
+
+	return GetWeather(ctx, country.LatitudeAndLongitude[0], country.LatitudeAndLongitude[1])
+}
+
+// GetCurrency retrieves the exchange rates for a base currency from the first currency provider that has them: the
+// Currency API or the ECB by default, or their Stub services.
+//
+// Parameters:
+// - currencyCode: the base currency's three-letter code. Example: NOK
+func GetCurrency(ctx context.Context, currencyCode string) (util.Currency, error) {
+	return upstream.CurrencyRates(ctx, currencyCode)
+}
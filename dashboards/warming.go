@@ -0,0 +1,212 @@
+package dashboards
+
+import (
+	"assignment2/database"
+	"assignment2/upstream"
+	"assignment2/util"
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Defaults of the cache warming, used if config.yaml does not say otherwise.
+const (
+	DEFAULT_WARMING_INTERVAL    = 10 * time.Minute
+	DEFAULT_WARMING_CONCURRENCY = 4
+)
+
+var (
+	// lastRefreshes is the time the upstream data of each registration was last refreshed.
+	lastRefreshes      = map[string]time.Time{}
+	lastRefreshesMutex sync.Mutex
+)
+
+// ScheduleWarming refreshes the upstream data of every registration at once, and then on every interval in
+// config.yaml, so dashboards are served from the cache of the upstream clients. It never returns, and must only be
+// started once.
+//
+// # Example
+//
+// go dashboards.ScheduleWarming()
+func ScheduleWarming() {
+	ticker := time.NewTicker(WarmingInterval())
+	defer ticker.Stop()
+
+	for now := time.Now(); ; now = <-ticker.C {
+		WarmRegistrations(now)
+	}
+}
+
+// WarmingInterval returns how often the upstream data is refreshed.
+func WarmingInterval() time.Duration {
+	if util.Config.Warming.Interval > 0 {
+		return util.Config.Warming.Interval
+	}
+	return DEFAULT_WARMING_INTERVAL
+}
+
+// WarmingConcurrency returns how many countries and currencies are refreshed at the same time.
+func WarmingConcurrency() int {
+	if util.Config.Warming.Concurrency > 0 {
+		return util.Config.Warming.Concurrency
+	}
+	return DEFAULT_WARMING_CONCURRENCY
+}
+
+// warmCountry is the upstream data of a country that the registrations need.
+type warmCountry struct {
+	weather       bool     // weather tells whether any registration of the country has a weather feature.
+	currency      bool     // currency tells whether any registration of the country has target currencies.
+	registrations []string // registrations are the IDs of the registrations of the country.
+}
+
+// WarmRegistrations refreshes the upstream data of every stored registration. The registrations are grouped by ISO
+// code, and then by base currency, so every country and currency is only refreshed once. A registration's refresh
+// time is set if all of its data was refreshed. See LastRefresh.
+//
+// Nothing is refreshed while the cache of every upstream service is off, as the dashboards would not be served from
+// the refreshed data. See upstream.Caching.
+func WarmRegistrations(now time.Time) {
+	if !upstream.Caching() {
+		return
+	}
+
+	registrations, err := database.GetAllRegistrations()
+	if err != nil {
+		log.Println("Failed to get registrations for cache warming:", err)
+		return
+	}
+
+	countries := map[string]*warmCountry{}
+	for _, reg := range registrations {
+		for _, isoCode := range reg.AllIsoCodes() {
+			country, ok := countries[isoCode]
+			if !ok {
+				country = &warmCountry{}
+				countries[isoCode] = country
+			}
+			country.weather = country.weather || reg.Features.Temperature || reg.Features.Precipitation
+			country.currency = country.currency || len(reg.Features.TargetCurrencies) > 0
+			country.registrations = append(country.registrations, reg.ID)
+		}
+	}
+
+	ctx := upstream.WithRefresh(context.Background())
+	var mutex sync.Mutex
+	failed := map[string]bool{}               // failed are the registrations whose data could not be refreshed.
+	currencies := map[string][]*warmCountry{} // currencies are the countries by their base currency.
+
+	// Refresh the countries and their weather
+	forEachConcurrently(keysOf(countries), func(isoCode string) {
+		country := countries[isoCode]
+		currencyCode, err := warmCountryData(ctx, isoCode, country.weather)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err != nil {
+			log.Printf("Failed to refresh the upstream data of %v: %v\n", isoCode, err)
+			for _, id := range country.registrations {
+				failed[id] = true
+			}
+			return
+		}
+		if country.currency && currencyCode != "" {
+			currencies[currencyCode] = append(currencies[currencyCode], country)
+		}
+	})
+
+	// Refresh the exchange rates of the base currencies
+	forEachConcurrently(keysOf(currencies), func(currencyCode string) {
+		_, err := upstream.CurrencyRates(ctx, currencyCode)
+		if err == nil {
+			return
+		}
+
+		log.Printf("Failed to refresh the exchange rates of %v: %v\n", currencyCode, err)
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, country := range currencies[currencyCode] {
+			for _, id := range country.registrations {
+				failed[id] = true
+			}
+		}
+	})
+
+	// Registrations that failed keep their previous refresh time, and deleted registrations are forgotten
+	lastRefreshesMutex.Lock()
+	defer lastRefreshesMutex.Unlock()
+	refreshes := make(map[string]time.Time, len(registrations))
+	for _, reg := range registrations {
+		if !failed[reg.ID] {
+			refreshes[reg.ID] = now
+		} else if last, ok := lastRefreshes[reg.ID]; ok {
+			refreshes[reg.ID] = last
+		}
+	}
+	lastRefreshes = refreshes
+}
+
+// warmCountryData refreshes a country, and its weather forecast if weather is set.
+//
+// Returns:
+// - The country's base currency. See findCurrencyCode.
+// - An error if the country or its forecast could not be retrieved.
+func warmCountryData(ctx context.Context, isoCode string, weather bool) (string, error) {
+	country, err := upstream.Countries.ByCode(ctx, isoCode)
+	if err != nil {
+		return "", err
+	}
+
+	// The forecast is requested with the same coordinates as the dashboards do, so they share the cache
+	if weather {
+		var latitude, longitude float64
+		if len(country.LatitudeAndLongitude) == 2 {
+			latitude = country.LatitudeAndLongitude[0]
+			longitude = country.LatitudeAndLongitude[1]
+		}
+		if _, err := upstream.Forecast(ctx, latitude, longitude); err != nil {
+			return "", err
+		}
+	}
+	return findCurrencyCode(country), nil
+}
+
+// LastRefresh returns the time the upstream data of a registration was last refreshed, and whether it has been.
+func LastRefresh(registrationId string) (time.Time, bool) {
+	lastRefreshesMutex.Lock()
+	defer lastRefreshesMutex.Unlock()
+
+	refreshed, ok := lastRefreshes[registrationId]
+	return refreshed, ok
+}
+
+// forEachConcurrently calls f for every key, with at most WarmingConcurrency calls at the same time. It returns when
+// all the calls have returned.
+func forEachConcurrently(keys []string, f func(key string)) {
+	slots := make(chan struct{}, WarmingConcurrency())
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(key string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			f(key)
+		}(key)
+	}
+	wg.Wait()
+}
+
+// keysOf returns the keys of a map in sorted order.
+func keysOf[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
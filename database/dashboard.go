@@ -15,6 +15,9 @@ import (
 	"os"
 )
 
+// ErrRegistrationNotFound is returned when there is no registration by an ID, for instance because it was deleted.
+var ErrRegistrationNotFound = errors.New("registration not found")
+
 // GetAllRegistrations is a helper function used get all registrations from databases.
 //
 // Returns:
@@ -81,7 +84,7 @@ func GetAllRegistrations() ([]util.Registration, error) {
 //
 // Returns:
 // util.Registration: the populated registration object
-// error: any errors which may occur
+// error: any errors which may occur. ErrRegistrationNotFound if there is no registration by the ID.
 func GetSingleRegistrationByID(registrationId string) (util.Registration, error) {
 	var registration util.Registration
 
@@ -112,7 +115,7 @@ func GetSingleRegistrationByID(registrationId string) (util.Registration, error)
 
 		// Document was not found by the Registration object's registration_id
 		if fireDoc == nil {
-			return util.Registration{}, errors.New("registration not found by registration_id")
+			return util.Registration{}, ErrRegistrationNotFound
 		}
 
 		//Converts firestore document into Registration object
@@ -153,7 +156,7 @@ func GetSingleRegistrationByID(registrationId string) (util.Registration, error)
 		}
 		if foundWanted != true {
 			fmt.Println("could not find a match")
-			return util.Registration{}, errors.New("could not find a match")
+			return util.Registration{}, ErrRegistrationNotFound
 		}
 	}
 	return registration, nil
@@ -316,64 +319,6 @@ func UpdateRegistration(registration util.Registration) error {
 	return nil
 }
 
-// PatchDashboardByID updates specific fields of a dashboard, based on specified ID.
-// FUnction searches for an existing document to find an ID match, then applies updates
-// specified within the patchData map.
-//
-// Parameters:
-// - id: dashboard's id to match & patch
-// - patchData: Map with fields to update & their new data
-//
-// Return:
-// - Error object if something went wrong.
-func PatchDashboardByID(id string, patchData map[string]interface{}) error {
-	//Find firestore document from given ID
-
-	var fireDoc *firestore.DocumentSnapshot
-
-	// Find document by the Registration object's registration_id
-	iter := Client.Collection(util.DASHBOARDS).Documents(Ctx)
-	for {
-		doc, err := iter.Next()
-		if errors.Is(err, iterator.Done) {
-			break
-		}
-		if err != nil {
-			return err
-		}
-
-		foundId := doc.Data()["ID"] //gives all document data to docFields
-
-		// Document was found
-		if id == foundId {
-			fireDoc = doc
-			break
-		}
-	}
-
-	if fireDoc == nil {
-		return errors.New("failed to update the database. Unable to find a registration object by id")
-	}
-
-	//Variable for "slice" to update
-	var updates []firestore.Update
-	//Iterate over the patchData map
-	for key, value := range patchData {
-		//Specifies path and new value and appends
-		updates = append(updates, firestore.Update{Path: key, Value: value})
-	}
-
-	//Updates into firestore
-	// ID may complain about potential nil pointer dereference. This is already handled
-	_, err := fireDoc.Ref.Update(Ctx, updates)
-	if err != nil {
-		return errors.New("Error: could not update")
-	}
-
-	//Successful, no error
-	return nil
-}
-
 // searchForQueryWithID searches for a document that has a field ID matching to the parameter id.
 // This lets us search for a document by the field ID.
 //
@@ -0,0 +1,168 @@
+// Shares.go is a module that stores the public share links of dashboards in our database
+package database
+
+import (
+	"assignment2/util"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"google.golang.org/api/iterator"
+)
+
+// ErrShareNotFound is returned when there is no share by an ID, for instance because it was revoked.
+var ErrShareNotFound = errors.New("share not found")
+
+// GetSharesOfRegistration retrieves the shares of a registration, sorted by the time they were created.
+// The callee must be aware that if no shares were found, then an empty array is returned.
+func GetSharesOfRegistration(registrationID string) ([]util.Share, error) {
+	out := []util.Share{}
+	if util.Config.Stubs.Database == false {
+		iter := Client.Collection(util.COLLECTION_SHARES).Where("RegistrationID", "==", registrationID).Documents(Ctx)
+		for {
+			doc, err := iter.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			var share util.Share
+			if err := doc.DataTo(&share); err != nil {
+				return nil, errors.New("could not convert share data from database to our internal Share struct")
+			}
+			out = append(out, share)
+		}
+	} else {
+		query := url.Values{"registrationId": {registrationID}}
+		if err := stubRequest(http.MethodGet, util.STUB_SHARES_PATH, query, nil, &out); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.Before(out[j].Created) })
+	return out, nil
+}
+
+// GetShare retrieves a share by its ID.
+//
+// Returns:
+// - ErrShareNotFound if there is no share by the ID.
+func GetShare(id string) (util.Share, error) {
+	if util.Config.Stubs.Database == false {
+		doc, err := Client.Collection(util.COLLECTION_SHARES).Doc(id).Get(Ctx)
+		if doc != nil && !doc.Exists() {
+			return util.Share{}, ErrShareNotFound
+		}
+		if err != nil {
+			return util.Share{}, err
+		}
+
+		var share util.Share
+		if err := doc.DataTo(&share); err != nil {
+			return util.Share{}, errors.New("could not convert share data from database to our internal Share struct")
+		}
+		return share, nil
+	}
+
+	var share util.Share
+	err := stubRequest(http.MethodGet, util.STUB_SHARES_PATH+id, nil, nil, &share)
+	if errors.Is(err, errStubNotFound) {
+		return util.Share{}, ErrShareNotFound
+	}
+	return share, err
+}
+
+// AddShare stores a new share. The shares that have expired by the time the share was created are deleted first, so
+// the shares don't pile up in the database.
+//
+// Returns:
+// An error object is returned if the share could not be stored.
+func AddShare(share util.Share) error {
+	if err := deleteExpiredShares(share.Created); err != nil {
+		return err
+	}
+
+	if util.Config.Stubs.Database == false {
+		if _, err := Client.Collection(util.COLLECTION_SHARES).Doc(share.ID).Set(Ctx, share); err != nil {
+			return fmt.Errorf("unable to store share %v", err)
+		}
+		return nil
+	}
+
+	if err := stubRequest(http.MethodPost, util.STUB_SHARES_PATH, nil, share, nil); err != nil {
+		return fmt.Errorf("unable to store share %v", err)
+	}
+	return nil
+}
+
+// deleteExpiredShares deletes every share that expired at or before a time, no matter which registration it belongs
+// to.
+func deleteExpiredShares(now time.Time) error {
+	if util.Config.Stubs.Database == false {
+		iter := Client.Collection(util.COLLECTION_SHARES).Where("Expires", "<=", now).Documents(Ctx)
+		for {
+			doc, err := iter.Next()
+			if errors.Is(err, iterator.Done) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := doc.Ref.Delete(Ctx); err != nil {
+				return fmt.Errorf("unable to delete expired share %v", err)
+			}
+		}
+	}
+
+	query := url.Values{"expiredBefore": {now.Format(time.RFC3339Nano)}}
+	if err := stubRequest(http.MethodDelete, util.STUB_SHARES_PATH, query, nil, nil); err != nil {
+		return fmt.Errorf("unable to delete expired shares %v", err)
+	}
+	return nil
+}
+
+// DeleteShare deletes a share by its ID, which revokes its link. Deleting a share that does not exist is not an
+// error.
+func DeleteShare(id string) error {
+	if util.Config.Stubs.Database == false {
+		if _, err := Client.Collection(util.COLLECTION_SHARES).Doc(id).Delete(Ctx); err != nil {
+			return fmt.Errorf("unable to delete share %v", err)
+		}
+		return nil
+	}
+
+	if err := stubRequest(http.MethodDelete, util.STUB_SHARES_PATH+id, nil, nil, nil); err != nil {
+		return fmt.Errorf("unable to delete share %v", err)
+	}
+	return nil
+}
+
+// DeleteSharesOfRegistration deletes every share of a registration, which revokes their links.
+func DeleteSharesOfRegistration(registrationID string) error {
+	if util.Config.Stubs.Database == false {
+		iter := Client.Collection(util.COLLECTION_SHARES).Where("RegistrationID", "==", registrationID).Documents(Ctx)
+		for {
+			doc, err := iter.Next()
+			if errors.Is(err, iterator.Done) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := doc.Ref.Delete(Ctx); err != nil {
+				return fmt.Errorf("unable to delete share %v", err)
+			}
+		}
+	}
+
+	query := url.Values{"registrationId": {registrationID}}
+	if err := stubRequest(http.MethodDelete, util.STUB_SHARES_PATH, query, nil, nil); err != nil {
+		return fmt.Errorf("unable to delete share %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Snapshots.go is a module that stores dashboard snapshots in our database
+package database
+
+import (
+	"assignment2/util"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"google.golang.org/api/iterator"
+)
+
+// snapshotDocument is how a snapshot is stored in Firestore. The dashboard is stored as a JSON string, since its
+// structure depends on the registration.
+type snapshotDocument struct {
+	RegistrationId string    `firestore:"RegistrationId"`
+	Time           time.Time `firestore:"Time"`
+	Dashboard      string    `firestore:"Dashboard"`
+}
+
+// AddSnapshot stores a dashboard snapshot in the database.
+//
+// Parameters:
+// - snapshot: the snapshot to store.
+//
+// Returns:
+// An error object is returned if the snapshot could not be stored.
+func AddSnapshot(snapshot util.Snapshot) error {
+	if util.Config.Stubs.Database == false {
+		doc := snapshotDocument{
+			RegistrationId: snapshot.RegistrationId,
+			Time:           snapshot.Time,
+			Dashboard:      string(snapshot.Dashboard),
+		}
+		if _, _, err := Client.Collection(util.COLLECTION_SNAPSHOTS).Add(Ctx, doc); err != nil {
+			return fmt.Errorf("unable to add snapshot %v", err)
+		}
+		return nil
+	}
+
+	if err := stubRequest(http.MethodPost, util.STUB_SNAPSHOTS_PATH, nil, snapshot, nil); err != nil {
+		return fmt.Errorf("unable to add snapshot %v", err)
+	}
+	return nil
+}
+
+// GetSnapshots retrieves the snapshots of a registration taken between two times, including both. A zero time means
+// there is no bound on that side. The snapshots are sorted from the oldest to the newest.
+// The callee must be aware that if no snapshots were found, then an empty array is returned.
+//
+// Parameters:
+// - registrationId: the Registration object's ID.
+// - from: the time of the oldest snapshot to return.
+// - to: the time of the newest snapshot to return.
+func GetSnapshots(registrationId string, from time.Time, to time.Time) ([]util.Snapshot, error) {
+	inRange := func(t time.Time) bool {
+		return (from.IsZero() || !t.Before(from)) && (to.IsZero() || !t.After(to))
+	}
+
+	out := []util.Snapshot{}
+	if util.Config.Stubs.Database == false {
+		iter := Client.Collection(util.COLLECTION_SNAPSHOTS).Where("RegistrationId", "==", registrationId).Documents(Ctx)
+		for {
+			doc, err := iter.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			var stored snapshotDocument
+			if err := doc.DataTo(&stored); err != nil {
+				return nil, errors.New("could not convert snapshot data from database to our internal Snapshot struct")
+			}
+			if inRange(stored.Time) {
+				out = append(out, util.Snapshot{
+					RegistrationId: stored.RegistrationId,
+					Time:           stored.Time,
+					Dashboard:      json.RawMessage(stored.Dashboard),
+				})
+			}
+		}
+	} else {
+		query := url.Values{"registrationId": {registrationId}}
+		if !from.IsZero() {
+			query.Set("from", from.Format(time.RFC3339Nano))
+		}
+		if !to.IsZero() {
+			query.Set("to", to.Format(time.RFC3339Nano))
+		}
+		if err := stubRequest(http.MethodGet, util.STUB_SNAPSHOTS_PATH, query, nil, &out); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out, nil
+}
+
+// DeleteSnapshotsBefore deletes every snapshot taken before a time, no matter which registration it belongs to.
+//
+// Returns:
+// The number of deleted snapshots, and an error object if something went wrong.
+func DeleteSnapshotsBefore(before time.Time) (int, error) {
+	deleted := 0
+	if util.Config.Stubs.Database == false {
+		iter := Client.Collection(util.COLLECTION_SNAPSHOTS).Where("Time", "<", before).Documents(Ctx)
+		for {
+			doc, err := iter.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				return deleted, err
+			}
+
+			if _, err := doc.Ref.Delete(Ctx); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		return deleted, nil
+	}
+
+	var response struct {
+		Deleted int `json:"deleted"`
+	}
+	query := url.Values{"before": {before.Format(time.RFC3339Nano)}}
+	if err := stubRequest(http.MethodDelete, util.STUB_SNAPSHOTS_PATH, query, nil, &response); err != nil {
+		return 0, err
+	}
+	return response.Deleted, nil
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"assignment2/util"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// errStubNotFound is returned by stubRequest when the database stub has no document by the ID in the path.
+var errStubNotFound = errors.New("not found in the stub database")
+
+// stubRequest sends a request to the database stub, with body encoded as JSON unless it is nil, and decodes the
+// response into out unless it is nil.
+//
+// Returns:
+// - errStubNotFound if the stub responds with 404 Not Found.
+// - An error if the stub could not be reached, or responds with another error.
+func stubRequest(method string, path string, query url.Values, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("Unable to marshal the body. This is a developer error.\n%v\n", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	target := util.LOCALHOST + util.DatabaseStubPort + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return fmt.Errorf("request not compatible with client.Do %v", err)
+	}
+	if body != nil {
+		req.Header.Set(util.CONTENT_TYPE, util.MIMETYPE_JSON)
+	}
+
+	client := http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach the stub database %v", err)
+	}
+	defer func(Body io.ReadCloser) {
+		if err := Body.Close(); err != nil {
+			log.Println("Failed to close repsonse body")
+		}
+	}(res.Body)
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return errStubNotFound
+	case res.StatusCode >= http.StatusMultipleChoices:
+		return fmt.Errorf("the stub database responded with %v", res.Status)
+	case out == nil:
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("the response of the stub database cannot be decoded.\n%v\n", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Templates.go is a module that stores registration templates in our database
+package database
+
+import (
+	"assignment2/util"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"google.golang.org/api/iterator"
+)
+
+// ErrTemplateNotFound is returned when there is no template by a name.
+var ErrTemplateNotFound = errors.New("template not found")
+
+// GetAllTemplates retrieves every registration template, sorted by name.
+// The callee must be aware that if no templates were found, then an empty array is returned.
+func GetAllTemplates() ([]util.Template, error) {
+	out := []util.Template{}
+	if util.Config.Stubs.Database == false {
+		iter := Client.Collection(util.COLLECTION_TEMPLATES).Documents(Ctx)
+		for {
+			doc, err := iter.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			var template util.Template
+			if err := doc.DataTo(&template); err != nil {
+				return nil, errors.New("could not convert template data from database to our internal Template struct")
+			}
+			out = append(out, template)
+		}
+	} else if err := stubRequest(http.MethodGet, util.TEMPLATE_PATH, nil, nil, &out); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// GetTemplate retrieves a registration template by its name.
+//
+// Returns:
+// - ErrTemplateNotFound if there is no template by the name.
+func GetTemplate(name string) (util.Template, error) {
+	if util.Config.Stubs.Database == false {
+		doc, err := Client.Collection(util.COLLECTION_TEMPLATES).Doc(name).Get(Ctx)
+		if doc != nil && !doc.Exists() {
+			return util.Template{}, ErrTemplateNotFound
+		}
+		if err != nil {
+			return util.Template{}, err
+		}
+
+		var template util.Template
+		if err := doc.DataTo(&template); err != nil {
+			return util.Template{}, errors.New("could not convert template data from database to our internal Template struct")
+		}
+		return template, nil
+	}
+
+	var template util.Template
+	err := stubRequest(http.MethodGet, util.TEMPLATE_PATH+name, nil, nil, &template)
+	if errors.Is(err, errStubNotFound) {
+		return util.Template{}, ErrTemplateNotFound
+	}
+	return template, err
+}
+
+// SetTemplate stores a registration template by its name. A template by the same name is replaced.
+//
+// Returns:
+// An error object is returned if the template could not be stored.
+func SetTemplate(template util.Template) error {
+	if util.Config.Stubs.Database == false {
+		if _, err := Client.Collection(util.COLLECTION_TEMPLATES).Doc(template.Name).Set(Ctx, template); err != nil {
+			return fmt.Errorf("unable to store template %v", err)
+		}
+		return nil
+	}
+
+	if err := stubRequest(http.MethodPut, util.TEMPLATE_PATH+template.Name, nil, template, nil); err != nil {
+		return fmt.Errorf("unable to store template %v", err)
+	}
+	return nil
+}
+
+// DeleteTemplate deletes a registration template by its name. Deleting a template that does not exist is not an
+// error. Registrations created from the template are kept.
+func DeleteTemplate(name string) error {
+	if util.Config.Stubs.Database == false {
+		if _, err := Client.Collection(util.COLLECTION_TEMPLATES).Doc(name).Delete(Ctx); err != nil {
+			return fmt.Errorf("unable to delete template %v", err)
+		}
+		return nil
+	}
+
+	if err := stubRequest(http.MethodDelete, util.TEMPLATE_PATH+name, nil, nil, nil); err != nil {
+		return fmt.Errorf("unable to delete template %v", err)
+	}
+	return nil
+}
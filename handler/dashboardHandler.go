@@ -1,12 +1,21 @@
 package handler
 
 import (
+	"assignment2/dashboards"
 	"assignment2/database"
 	"assignment2/util"
+	"assignment2/views"
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,142 +23,339 @@ import (
 //
 // It handles the following:
 // - GET: Retrieves information about a specific registration in the database using APIs or Stub-services.
+// Without an ID, an ad-hoc dashboard is built from the query parameters instead.
+// GET on {id}/chart.svg renders the registration's hourly weather forecast as a SVG chart.
+// GET on {id}/snapshots returns the stored snapshots of the dashboard.
+// GET on {id}/stream keeps the connection open, and sends the dashboard as Server-Sent Events whenever it changes.
+// - POST: Builds an ad-hoc dashboard from a registration in the request body. Nothing is stored in the database.
 //
-// If another method than GET is used, an Error occurs.
+// If another method than GET or POST is used, an Error occurs.
 func DashboardHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method { //a switch for the supported methods. Only GET method is supported
+	switch r.Method { //a switch for the supported methods. Only GET and POST methods are supported
 	case http.MethodGet:
 		handleDashboardGetRequest(w, r)
-	default: //Error message if GET method is not used
-		http.Error(w, "This method is not supported! Only GET are supported", http.StatusMethodNotAllowed)
+	case http.MethodPost:
+		// Ad-hoc dashboards are only posted to the dashboards collection, never to a specific dashboard
+		if strings.TrimSuffix(r.URL.Path, "/") != strings.TrimSuffix(util.DASHBOARD_PATH, "/") {
+			http.Error(w, "This method is not supported! Only GET are supported on a dashboard", http.StatusMethodNotAllowed)
+			return
+		}
+		handleDashboardPostRequest(w, r)
+	default: //Error message if GET or POST method is not used
+		http.Error(w, "This method is not supported! Only GET and POST are supported", http.StatusMethodNotAllowed)
 	}
 }
 
 // handleDashboardGetRequest retrieves a specified registration from the database,
 // and finds information about it from APIs or Stub-services.
+// If no ID is specified, the registration is read from the query parameters instead. See registrationFromQuery.
 func handleDashboardGetRequest(w http.ResponseWriter, r *http.Request) {
-	// Find ID in the URL.
-	id, err := util.GetIdFromUrl(r.URL.Path)
+	// Sub-resources of a dashboard, such as its chart, are served separately.
+	if id, resource := util.SplitResourcePath(r.URL.Path, util.DASHBOARD_PATH); resource != "" {
+		switch resource {
+		case "chart.svg":
+			handleDashboardChartRequest(w, r, id)
+		case "stream":
+			handleDashboardStreamRequest(w, r, id)
+		case "snapshots":
+			handleDashboardSnapshotsRequest(w, r, id)
+		default:
+			http.Error(w, "Error: unknown dashboard resource '"+resource+"'", http.StatusNotFound)
+		}
+		return
+	}
+
+	// Find ID in the URL. The '.html' extension only selects the HTML view.
+	id, err := util.GetIdFromUrl(strings.TrimSuffix(r.URL.Path, ".html"))
 	if err != nil {
 		return
 	}
 
-	// Find registratration with the help of the ID:
 	var reg util.Registration
-	reg, err = database.GetSingleRegistrationByID(id)
+	if id == "" {
+		// No ID, so this is an ad-hoc dashboard.
+		reg, err = registrationFromQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, "Error: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		// Find registratration with the help of the ID:
+		reg, err = database.GetSingleRegistrationByID(id)
+		if err != nil {
+			http.Error(w, "Error: could not find specified ID", http.StatusNotFound)
+			return
+		}
+	}
+
+	serveDashboard(w, r, reg)
+}
+
+// handleDashboardChartRequest renders the hourly weather forecast of a registration as a SVG chart.
+// Comparison registrations use the country in the 'isoCode' query parameter, or their first country.
+// The size of the chart is set with the 'width' and 'height' query parameters.
+func handleDashboardChartRequest(w http.ResponseWriter, r *http.Request, id string) {
+	reg, err := database.GetSingleRegistrationByID(id)
 	if err != nil {
 		http.Error(w, "Error: could not find specified ID", http.StatusNotFound)
 		return
 	}
 
-	// Find info about the country using REST Countries API or the Stub service.
-	var url string
-	if util.Config.Stubs.RestCountries == true {
-		url = util.LOCALHOST + util.CountryStubPort + "/" // Use the Stub service.
-	} else {
-		url = util.COUNTRY_URL + "/alpha/" + reg.IsoCode // Use the real service.
+	query := r.URL.Query()
+	isoCode := reg.IsoCode
+	if reg.IsComparison() {
+		isoCode = reg.AllIsoCodes()[0]
+	}
+	if query.Has("isoCode") {
+		isoCode = strings.ToUpper(query.Get("isoCode"))
+		if !slices.Contains(reg.AllIsoCodes(), isoCode) {
+			http.Error(w, "Error: the registration does not include the country "+isoCode, http.StatusBadRequest)
+			return
+		}
 	}
-	// Create GET-request and decode response:
-	var countries []util.Country
-	err = util.MakeGetRequest(url, &countries)
+
+	chart := views.ForecastChart{Title: reg.Country, Width: views.CHART_DEFAULT_WIDTH, Height: views.CHART_DEFAULT_HEIGHT}
+	for name, size := range map[string]*int{"width": &chart.Width, "height": &chart.Height} {
+		if !query.Has(name) {
+			continue
+		}
+		*size, err = strconv.Atoi(query.Get(name))
+		if err != nil {
+			http.Error(w, "Error: the parameter '"+name+"' must be a whole number of pixels", http.StatusBadRequest)
+			return
+		}
+	}
+
+	chart.Weather, err = dashboards.GetForecast(r.Context(), isoCode)
 	if err != nil {
-		http.Error(w, "Error in reponse: "+err.Error(), http.StatusBadRequest)
+		setRetryAfter(w, err)
+		http.Error(w, "Error: could not retrieve the forecast: "+err.Error(), upstreamErrorStatus(err, http.StatusBadGateway))
 		log.Println(err)
 		return
 	}
-	country := countries[0]
+	if reg.IsComparison() || chart.Title == "" {
+		chart.Title = isoCode
+	}
+	chart.Title = "Weather forecast for " + chart.Title
 
-	// Find the coordinates of the given contry:
-	latitude := country.LatitudeAndLongitude[0]
-	longitude := country.LatitudeAndLongitude[1]
+	// Render the chart before writing, so a failure can still be reported with a status code.
+	var image bytes.Buffer
+	if err := views.RenderForecastChart(&image, chart); err != nil {
+		http.Error(w, "Error: could not render the chart: "+err.Error(), http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
 
-	// Convert the float to strings:
-	lat := strconv.FormatFloat(latitude, 'f', 2, 64)
-	lon := strconv.FormatFloat(longitude, 'f', 2, 64)
+	w.Header().Set(util.CONTENT_TYPE, util.MIMETYPE_SVG)
+	_, _ = w.Write(image.Bytes())
+}
 
-	// Find the Weather forecast for the given coordinates. Either with stub or real service.
-	if util.Config.Stubs.Weather == true {
-		url = util.LOCALHOST + util.WeatherStubPort + "/" // Use the Stub service.
-	} else {
-		url = util.OPEN_METO_URL + "?latitude=" + lat + "&longitude=" + lon + "&hourly=temperature_2m,precipitation" // Use the real service.
+// handleDashboardStreamRequest sends the dashboard of a registration as Server-Sent Events. The current dashboard is
+// sent first, followed by a new one whenever the registration or its upstream data changes. Heartbeats are sent while
+// nothing changes, and the stream ends with a 'deleted' event if the registration is deleted.
+//
+// A client resumes with the 'Last-Event-ID' header, or the 'lastEventId' query parameter. See dashboards.Watch.
+func handleDashboardStreamRequest(w http.ResponseWriter, r *http.Request, id string) {
+	if _, err := database.GetSingleRegistrationByID(id); err != nil {
+		http.Error(w, "Error: could not find specified ID", http.StatusNotFound)
+		return
 	}
-	// Create GET-request and decode response:
-	var weatherForcast util.Weather
-	err = util.MakeGetRequest(url, &weatherForcast)
-	if err != nil {
-		http.Error(w, "Error in reponse: "+err.Error(), http.StatusBadRequest)
-		log.Println(err)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Error: streaming is not supported by the connection", http.StatusInternalServerError)
 		return
 	}
 
-	// Find mean-values for temperature and precipitation
-	meanTemp := findMean(weatherForcast.Hourly.Temperature)
-	meanPrec := findMean(weatherForcast.Hourly.Precipitation)
+	lastEventId := r.Header.Get(util.LAST_EVENT_ID)
+	if lastEventId == "" {
+		// Browsers can't set headers on the first connection of an EventSource.
+		lastEventId = r.URL.Query().Get("lastEventId")
+	}
+
+	updates, stop := dashboards.Watch(id, lastEventId)
+	defer stop()
+
+	w.Header().Set(util.CONTENT_TYPE, util.MIMETYPE_EVENT_STREAM)
+	w.Header().Set(util.CACHE_CONTROL, "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
 
-	// Find the targeted currencies.
-	targetedCurrencies := reg.Features.TargetCurrencies
+	heartbeat := time.NewTicker(dashboards.StreamHeartbeatInterval)
+	defer heartbeat.Stop()
 
-	// Find Currency-code from the Country.
-	var currencyCode string
-	for key := range country.Currencies {
-		if key != "" && len(key) == 3 {
-			currencyCode = key
-			break // IF there are more then one, just use the first one:
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			// Comments are ignored by clients, but keep proxies from closing an idle connection.
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", update.Id, update.Event, update.Data); err != nil {
+				return
+			}
+			if update.Event == dashboards.UPDATE_DELETED {
+				flusher.Flush()
+				return
+			}
 		}
+		flusher.Flush()
 	}
+}
 
-	// Get currency rates from the given country. Either with stub or real service.
-	if util.Config.Stubs.Currencies == true {
-		url = util.LOCALHOST + util.CurrenciesStubPort + "/" // Use the Stub service.
-	} else {
-		url = util.CURRENCY_URL + currencyCode // Use the real service.
+// handleDashboardSnapshotsRequest returns the snapshots of a registration's dashboard, from the oldest to the newest.
+// The 'from' and 'to' query parameters limit the snapshots to a period. See parseSnapshotTime.
+func handleDashboardSnapshotsRequest(w http.ResponseWriter, r *http.Request, id string) {
+	if _, err := database.GetSingleRegistrationByID(id); err != nil {
+		http.Error(w, "Error: could not find specified ID", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	from, err := parseSnapshotTime(query.Get("from"), false)
+	if err != nil {
+		util.HttpError(w, "parameter 'from' is invalid. "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseSnapshotTime(query.Get("to"), true)
+	if err != nil {
+		util.HttpError(w, "parameter 'to' is invalid. "+err.Error(), http.StatusBadRequest)
+		return
 	}
-	// Create GET-request and decode response:
-	var currency util.Currency
-	err = util.MakeGetRequest(url, &currency)
+
+	snapshots, err := database.GetSnapshots(id, from, to)
 	if err != nil {
-		http.Error(w, "Error in reponse: "+err.Error(), http.StatusBadRequest)
 		log.Println(err)
+		util.HttpError(w, "failed to get snapshots", http.StatusInternalServerError)
 		return
 	}
 
-	// Find the currency rates for the target currencies.
-	targetCurrencyRate := make(map[string]float64)
-	for _, val := range targetedCurrencies {
-		targetCurrencyRate[val] = currency.Rates[val]
+	w.Header().Set(util.CONTENT_TYPE, util.MIMETYPE_JSON)
+	if err := json.NewEncoder(w).Encode(snapshots); err != nil {
+		log.Println("Failed to write snapshots:", err)
 	}
+}
 
-	// Fix the body of the response:
-	var response util.DashboardResponse
+// parseSnapshotTime parses a time in a snapshot query. Times are RFC 3339, the service's own timestamps
+// ("2006-01-02 15:04") or dates ("2006-01-02"). Times without a time zone are in UTC. A date at the end of a period
+// includes the whole day. An empty value returns the zero time, which means no limit.
+func parseSnapshotTime(value string, endOfPeriod bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
 
-	// Fix the coordinates
-	if reg.Features.Coordinates {
-		response.Features.Coordinates.Latitude = latitude
-		response.Features.Coordinates.Longitude = longitude
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02 15:04", value); err == nil {
+		if endOfPeriod {
+			t = t.Add(time.Minute - time.Nanosecond)
+		}
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		if endOfPeriod {
+			t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		return t, nil
 	}
+	return time.Time{}, fmt.Errorf("use RFC 3339 (2006-01-02T15:04:05Z), '2006-01-02 15:04' or '2006-01-02'")
+}
 
-	// Fix the other features:
-	if reg.Features.Area {
-		response.Features.Area = country.Area
+// handleDashboardPostRequest builds an ad-hoc dashboard from a registration in the request body.
+// The registration is never stored in the database.
+func handleDashboardPostRequest(w http.ResponseWriter, r *http.Request) {
+	var reg util.Registration
+	err := json.NewDecoder(r.Body).Decode(&reg)
+	switch {
+	case err == io.EOF:
+		http.Error(w, "Error, the request body was empty", http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Error, could not parse body", http.StatusBadRequest)
+		return
+	}
+
+	reg.IsoCode = strings.ToUpper(reg.IsoCode)
+	for i, isoCode := range reg.IsoCodes {
+		reg.IsoCodes[i] = strings.ToUpper(isoCode)
+	}
+	if reg.IsoCode == "" && !reg.IsComparison() {
+		http.Error(w, "Error: the field 'isoCode' or 'isoCodes' is required", http.StatusBadRequest)
+		return
 	}
-	if reg.Features.Capital {
-		response.Features.Capital = country.CapitalCity[0]
+	if err := dashboards.ValidateComputed(reg.Features); err != nil {
+		http.Error(w, "Error: the field 'features.computed' is invalid. "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serveDashboard(w, r, reg)
+}
+
+// serveDashboard populates the dashboard of a registration using APIs or the Stub services, and writes it to the
+// client. Comparison registrations return a dashboard for each of their countries, and comparisons between them.
+//
+// The dashboard is written as JSON, unless the client asks for CSV, NDJSON or HTML. See util.NegotiateFormat.
+// A path ending with '.html' always returns the HTML view. The country's name, the capital and the currency names are
+// in the language the client asks for. See util.NegotiateLanguage.
+func serveDashboard(w http.ResponseWriter, r *http.Request, reg util.Registration) {
+	format, err := util.NegotiateFormat(r, util.FORMAT_HTML)
+	if err != nil {
+		util.HttpError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	if reg.Features.Temperature {
-		response.Features.Temperature = meanTemp
+	if strings.HasSuffix(r.URL.Path, ".html") {
+		format = util.FORMAT_HTML
 	}
-	if reg.Features.Precipitation {
-		response.Features.Precipitation = meanPrec
+
+	lang := util.NegotiateLanguage(r)
+
+	var response any
+	var countries []util.DashboardResponse
+	view := views.DashboardView{Title: reg.Country, Enabled: reg.Features}
+	if reg.IsComparison() {
+		var comparison util.ComparisonDashboardResponse
+		comparison, err = dashboards.BuildComparison(r.Context(), reg, lang)
+		response, countries = comparison, comparison.Countries
+		view.Comparisons, view.LastRetrieval = &comparison.Comparisons, comparison.LastRetrieval
+	} else {
+		var dashboard util.DashboardResponse
+		dashboard, err = dashboards.Build(r.Context(), reg, lang)
+		response, countries = dashboard, []util.DashboardResponse{dashboard}
+		view.Title, view.LastRetrieval = dashboard.Name, dashboard.LastRetrieval
 	}
-	if reg.Features.Population {
-		response.Features.Population = country.Population
+	if err != nil {
+		setRetryAfter(w, err)
+		http.Error(w, "Error in reponse: "+err.Error(), upstreamErrorStatus(err, http.StatusBadRequest))
+		log.Println(err)
+		return
 	}
-	response.Features.TargetCurrencies = targetCurrencyRate
+	util.SetLanguage(w, lang)
 
-	// Fix the rest of the response struct:
-	response.Name = reg.Country
-	response.Isocode = reg.IsoCode
-	response.LastRetrieval = time.Now().Format("2006-01-02 15:04")
+	// Comparisons between countries are only included in JSON and HTML. CSV and NDJSON only contain the countries.
+	switch format {
+	case util.FORMAT_HTML:
+		view.Countries = countries
+		writeDashboardView(w, view)
+		return
+	case util.FORMAT_CSV:
+		header, records := dashboardsToCSV(reg.Features, countries)
+		if err := util.WriteCSV(w, header, records); err != nil {
+			log.Println("Failed to write dashboard as CSV:", err)
+		}
+		return
+	case util.FORMAT_NDJSON:
+		if err := util.WriteNDJSON(w, countries); err != nil {
+			log.Println("Failed to write dashboard as NDJSON:", err)
+		}
+		return
+	}
 
 	// Add the content type to the reponsewriter.
 	w.Header().Add("content-type", "application/json")
@@ -168,12 +374,159 @@ func handleDashboardGetRequest(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// findMean is a function that calculates the mean value of a list
-// containing floats, and returns it as a float64
-func findMean(list []float64) float64 {
-	var sum float64 = 0
-	for _, value := range list {
-		sum += value
+// writeDashboardView renders a dashboard as a HTML page and writes it to the client.
+// The page is rendered before anything is written, so a failure can still be reported with a status code.
+func writeDashboardView(w http.ResponseWriter, view views.DashboardView) {
+	var page bytes.Buffer
+	if err := views.RenderDashboard(&page, view); err != nil {
+		log.Println("Failed to render dashboard:", err)
+		http.Error(w, "Error during rendering", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(util.CONTENT_TYPE, util.MIMETYPE_HTML+"; charset=utf-8")
+	w.Header().Add(util.VARY, util.ACCEPT)
+	w.WriteHeader(http.StatusOK)
+	if _, err := page.WriteTo(w); err != nil {
+		log.Println("Failed to write dashboard:", err)
 	}
-	return sum / float64(len(list))
+}
+
+// registrationFromQuery creates a registration for an ad-hoc dashboard from query parameters.
+//
+// Supported parameters:
+// - isoCode: the country's ISO code. Example: SE
+// - isoCodes: comma-separated ISO codes for a comparison dashboard. Example: NO,SE,FI
+// - features: comma-separated names of the features to enable. Example: temperature,capital
+// - currencies: comma-separated target currencies. Example: EUR,USD
+//
+// An error is returned if no country is given, or if a feature is unknown.
+func registrationFromQuery(query url.Values) (util.Registration, error) {
+	reg := util.Registration{
+		IsoCode:  strings.ToUpper(query.Get("isoCode")),
+		IsoCodes: splitQueryList(strings.ToUpper(query.Get("isoCodes"))),
+	}
+	if reg.IsoCode == "" && !reg.IsComparison() {
+		return util.Registration{}, fmt.Errorf("an ID or the query parameter 'isoCode' is required")
+	}
+
+	// Enable the features by decoding them as if they were sent in a registration body. Unknown features are
+	// rejected, and the names are matched case-insensitively just like in a body.
+	enabled := make(map[string]bool)
+	for _, feature := range splitQueryList(query.Get("features")) {
+		if strings.EqualFold(feature, "targetCurrencies") {
+			return util.Registration{}, fmt.Errorf("target currencies are set with the query parameter 'currencies'")
+		}
+		enabled[feature] = true
+	}
+	encoded, err := json.Marshal(enabled)
+	if err != nil {
+		return util.Registration{}, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&reg.Features); err != nil {
+		return util.Registration{}, fmt.Errorf("the query parameter 'features' contains an unknown feature")
+	}
+
+	reg.Features.TargetCurrencies = splitQueryList(strings.ToUpper(query.Get("currencies")))
+
+	return reg, nil
+}
+
+// splitQueryList splits a comma-separated query parameter into its values. Empty values are skipped.
+func splitQueryList(value string) []string {
+	var out []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// dashboardsToCSV flattens dashboards into CSV records. Each dashboard has one record per target currency, or a single
+// record if it has no target currencies. Only the features that are enabled have a column, and lists are joined with
+// util.JoinList.
+func dashboardsToCSV(enabled util.Features, countries []util.DashboardResponse) ([]string, [][]string) {
+	// Each enabled feature adds one or more columns, with a function to get their values from the features.
+	type column struct {
+		names  []string
+		values func(f util.DashboardFeatures) []string
+	}
+	columns := []column{}
+	add := func(isEnabled bool, values func(f util.DashboardFeatures) []string, names ...string) {
+		if isEnabled {
+			columns = append(columns, column{names, values})
+		}
+	}
+	add(enabled.Temperature, func(f util.DashboardFeatures) []string { return []string{util.FormatFloat(f.Temperature)} }, "temperature")
+	add(enabled.Precipitation, func(f util.DashboardFeatures) []string { return []string{util.FormatFloat(f.Precipitation)} }, "precipitation")
+	add(enabled.Capital, func(f util.DashboardFeatures) []string { return []string{f.Capital} }, "capital")
+	add(enabled.Coordinates, func(f util.DashboardFeatures) []string {
+		return []string{util.FormatFloat(f.Coordinates.Latitude), util.FormatFloat(f.Coordinates.Longitude)}
+	}, "latitude", "longitude")
+	add(enabled.Population, func(f util.DashboardFeatures) []string { return []string{strconv.Itoa(f.Population)} }, "population")
+	add(enabled.Area, func(f util.DashboardFeatures) []string { return []string{util.FormatFloat(f.Area)} }, "area")
+	add(enabled.Languages, func(f util.DashboardFeatures) []string { return []string{util.JoinList(f.Languages)} }, "languages")
+	add(enabled.Timezones, func(f util.DashboardFeatures) []string { return []string{util.JoinList(f.Timezones)} }, "timezones")
+	add(enabled.Region, func(f util.DashboardFeatures) []string { return []string{f.Region, f.Subregion} }, "region", "subregion")
+	add(enabled.Borders, func(f util.DashboardFeatures) []string { return []string{util.JoinList(f.Borders)} }, "borders")
+	add(enabled.CallingCodes, func(f util.DashboardFeatures) []string { return []string{util.JoinList(f.CallingCodes)} }, "callingCodes")
+	add(enabled.Flag, func(f util.DashboardFeatures) []string {
+		if f.Flag == nil {
+			return []string{"", ""}
+		}
+		return []string{f.Flag.Png, f.Flag.Svg}
+	}, "flagPng", "flagSvg")
+	add(enabled.DrivingSide, func(f util.DashboardFeatures) []string { return []string{f.DrivingSide} }, "drivingSide")
+	add(enabled.TopLevelDomains, func(f util.DashboardFeatures) []string { return []string{util.JoinList(f.TopLevelDomains)} }, "topLevelDomains")
+
+	// One column per computed feature, sorted by name. Features that can't be computed are empty.
+	computed := make([]string, 0, len(enabled.Computed))
+	for name := range enabled.Computed {
+		computed = append(computed, name)
+	}
+	sort.Strings(computed)
+	for _, name := range computed {
+		add(true, func(f util.DashboardFeatures) []string {
+			if value := f.Computed[name]; value != nil {
+				return []string{util.FormatFloat(*value)}
+			}
+			return []string{""}
+		}, "computed."+name)
+	}
+
+	header := []string{"country", "isoCode"}
+	for _, c := range columns {
+		header = append(header, c.names...)
+	}
+	header = append(header, "currency", "rate", "lastRetrieval")
+
+	var records [][]string
+	for _, dashboard := range countries {
+		record := []string{dashboard.Name, dashboard.Isocode}
+		for _, c := range columns {
+			record = append(record, c.values(dashboard.Features)...)
+		}
+
+		// One record per currency. Sort the currencies, so the output is always in the same order.
+		currencies := make([]string, 0, len(dashboard.Features.TargetCurrencies))
+		for currency := range dashboard.Features.TargetCurrencies {
+			currencies = append(currencies, currency)
+		}
+		sort.Strings(currencies)
+
+		if len(currencies) == 0 {
+			records = append(records, append(record, "", "", dashboard.LastRetrieval))
+		}
+		for _, currency := range currencies {
+			rate := util.FormatFloat(dashboard.Features.TargetCurrencies[currency])
+			// Copy the record, so the records do not share the same underlying array
+			currencyRecord := append(append([]string{}, record...), currency, rate, dashboard.LastRetrieval)
+			records = append(records, currencyRecord)
+		}
+	}
+
+	return header, records
 }
@@ -1,16 +1,29 @@
 package handler_test
 
 import (
+	"assignment2/crypto"
+	"assignment2/dashboards"
 	"assignment2/handler"
+	"assignment2/notifications"
 	stubs "assignment2/stubs/handler"
+	"assignment2/upstream"
 	"assignment2/util"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -102,6 +115,10 @@ func TestRetrievePopulatedDashboard(t *testing.T) {
 				"NOK": 1.0,
 				"EUR": 0.086289,
 			},
+			CurrencyNames: map[string]string{
+				"NOK": "Norwegian krone",
+				"EUR": "Euro",
+			},
 		},
 		LastRetrieval: time.Now().Format("2006-01-02 15:04"),
 	}
@@ -176,3 +193,1500 @@ func TestRetrievePopulatedDashboard(t *testing.T) {
 		t.Error("The data are not as expected!")
 	}
 }
+
+// startStubServices starts the Weather, Country and Currency stub-services, and points the
+// global stub ports to them. The returned function closes all the stub-services.
+func startStubServices() func() {
+	util.Config.Stubs.Database = true
+	util.Config.Stubs.Weather = true
+	util.Config.Stubs.Currencies = true
+	util.Config.Stubs.RestCountries = true
+	util.Config.Stubs.ECB = true
+	util.Config.Stubs.MetNorway = true
+
+	stubWeather := httptest.NewServer(http.HandlerFunc(stubs.StubWeatherHandler))
+	stubCountry := httptest.NewServer(http.HandlerFunc(stubs.StubCountryHandler))
+	stubCurrency := httptest.NewServer(http.HandlerFunc(stubs.StubCurrencyHandler))
+	stubECB := httptest.NewServer(http.HandlerFunc(stubs.StubECBHandler))
+	stubMetNorway := httptest.NewServer(http.HandlerFunc(stubs.StubMetNorwayHandler))
+
+	util.WeatherStubPort = portOf(stubWeather.URL)
+	util.CountryStubPort = portOf(stubCountry.URL)
+	util.CurrenciesStubPort = portOf(stubCurrency.URL)
+	util.ECBStubPort = portOf(stubECB.URL)
+	util.MetNorwayStubPort = portOf(stubMetNorway.URL)
+
+	return func() {
+		stubWeather.Close()
+		stubCountry.Close()
+		stubCurrency.Close()
+		stubECB.Close()
+		stubMetNorway.Close()
+	}
+}
+
+// startStubDatabase starts the database stub with the same handlers as stubs.DatabaseStub, and points the global
+// database stub port to it. The returned function closes the stub.
+func startStubDatabase() func() {
+	stubMux := http.NewServeMux()
+	stubMux.HandleFunc(util.REGISTRATION_PATH, stubs.DatabaseDashboardHandler)
+	stubMux.HandleFunc(util.NOTIFICATION_PATH, stubs.DatabaseNotificationHandler)
+	stubMux.HandleFunc(util.TEMPLATE_PATH, stubs.DatabaseTemplateHandler)
+	stubMux.HandleFunc(util.STUB_SNAPSHOTS_PATH, stubs.DatabaseSnapshotHandler)
+	stubMux.HandleFunc(util.STUB_SHARES_PATH, stubs.DatabaseShareHandler)
+
+	stubDatabase := httptest.NewServer(stubMux)
+	util.DatabaseStubPort = portOf(stubDatabase.URL)
+	return stubDatabase.Close
+}
+
+// portOf returns the port of a test server's URL. Example: http://127.0.0.1:4321 returns "4321".
+func portOf(serverURL string) string {
+	port := strings.Split(serverURL, ":")
+	return port[len(port)-1]
+}
+
+// TestRetrieveDashboardCountryFeatures tests that the opt-in REST Countries features are
+// decoded from the stub-service and returned in the dashboard.
+func TestRetrieveDashboardCountryFeatures(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	registrations := []util.Registration{
+		{
+			ID:      "2",
+			Country: "Norway",
+			IsoCode: "NO",
+			Features: util.Features{
+				Languages:       true,
+				Timezones:       true,
+				Region:          true,
+				Borders:         true,
+				CallingCodes:    true,
+				Flag:            true,
+				DrivingSide:     true,
+				TopLevelDomains: true,
+			},
+		},
+	}
+	if err := util.PopulateTestFile(util.STUB_DATABASE_REGISTRATIONS, registrations); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+
+	res, err := getFromServer(server.URL + util.DASHBOARD_PATH + "2")
+	if err != nil {
+		t.Fatalf("Failed to instantiate a new request.\n%v\n", err)
+	}
+	defer res.Body.Close()
+
+	var dashboard util.DashboardResponse
+	if err := json.NewDecoder(res.Body).Decode(&dashboard); err != nil {
+		t.Fatalf("The response cannot be decoded to a dashboard struct.\n%v\n", err)
+	}
+
+	features := dashboard.Features
+	if !reflect.DeepEqual(features.Languages, []string{"Norwegian Bokmål", "Norwegian Nynorsk", "Sami"}) {
+		t.Errorf("Unexpected languages: %v", features.Languages)
+	}
+	if !reflect.DeepEqual(features.CallingCodes, []string{"+47"}) {
+		t.Errorf("Unexpected calling codes: %v", features.CallingCodes)
+	}
+	if features.Region != "Europe" || features.Subregion != "Northern Europe" {
+		t.Errorf("Unexpected region: %v / %v", features.Region, features.Subregion)
+	}
+	if features.Flag == nil || features.Flag.Svg != "https://flagcdn.com/no.svg" {
+		t.Errorf("Unexpected flag: %v", features.Flag)
+	}
+	if features.DrivingSide != "right" {
+		t.Errorf("Unexpected driving side: %v", features.DrivingSide)
+	}
+	if len(features.Borders) != 3 || len(features.Timezones) != 2 || len(features.TopLevelDomains) != 1 {
+		t.Error("The borders, timezones or top-level domains are not as expected!")
+	}
+
+	// Features that are not opted in must be left out
+	if features.Capital != "" || features.Population != 0 || features.Temperature != 0 {
+		t.Error("Features that are not opted in were returned")
+	}
+}
+
+// TestRetrieveComparisonDashboard tests that a comparison registration returns a dashboard for each of its
+// countries, and that the countries are compared correctly.
+func TestRetrieveComparisonDashboard(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	registrations := []util.Registration{
+		{
+			ID:       "3",
+			Country:  "Nordics",
+			IsoCodes: []string{"NO", "SE", "FI"},
+			Features: util.Features{
+				Temperature: true,
+				Population:  true,
+				Area:        true,
+			},
+		},
+	}
+	if err := util.PopulateTestFile(util.STUB_DATABASE_REGISTRATIONS, registrations); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+
+	res, err := getFromServer(server.URL + util.DASHBOARD_PATH + "3")
+	if err != nil {
+		t.Fatalf("Failed to instantiate a new request.\n%v\n", err)
+	}
+	defer res.Body.Close()
+
+	var dashboard util.ComparisonDashboardResponse
+	if err := json.NewDecoder(res.Body).Decode(&dashboard); err != nil {
+		t.Fatalf("The response cannot be decoded to a comparison dashboard struct.\n%v\n", err)
+	}
+
+	if len(dashboard.Countries) != 3 {
+		t.Fatalf("Expected 3 countries, got %d", len(dashboard.Countries))
+	}
+	if dashboard.Countries[1].Name != "Sweden" || dashboard.Countries[1].Features.Population != 10353442 {
+		t.Errorf("Unexpected dashboard for Sweden: %v", dashboard.Countries[1])
+	}
+
+	comparisons := dashboard.Comparisons
+	if comparisons.HighestPopulation == nil || comparisons.HighestPopulation.IsoCode != "SE" {
+		t.Errorf("Expected SE to have the highest population, got %v", comparisons.HighestPopulation)
+	}
+	if comparisons.LowestPopulation == nil || comparisons.LowestPopulation.IsoCode != "NO" {
+		t.Errorf("Expected NO to have the lowest population, got %v", comparisons.LowestPopulation)
+	}
+	if comparisons.SmallestArea == nil || comparisons.SmallestArea.IsoCode != "NO" {
+		t.Errorf("Expected NO to have the smallest area, got %v", comparisons.SmallestArea)
+	}
+
+	// The weather stub returns the same forecast for every country
+	if comparisons.TemperatureDifference == nil || *comparisons.TemperatureDifference != 0 {
+		t.Errorf("Expected no difference in temperature, got %v", comparisons.TemperatureDifference)
+	}
+
+	// Precipitation is not enabled, so it must not be compared
+	if comparisons.PrecipitationDifference != nil || comparisons.HighestPrecipitation != nil {
+		t.Error("Precipitation was compared without being enabled")
+	}
+}
+
+// TestRetrieveAdHocDashboard tests that dashboards can be built from query parameters or a posted registration,
+// without storing anything in the database.
+func TestRetrieveAdHocDashboard(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	if err := util.PopulateTestFile(util.STUB_DATABASE_REGISTRATIONS, []util.Registration{}); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+	endpoint := server.URL + strings.TrimSuffix(util.DASHBOARD_PATH, "/")
+
+	// -----
+	// GET with query parameters
+	// -----
+	res, err := getFromServer(endpoint + "?isoCode=se&features=capital,Population&currencies=eur")
+	if err != nil {
+		t.Fatalf("Failed to instantiate a new request.\n%v\n", err)
+	}
+	defer res.Body.Close()
+
+	var dashboard util.DashboardResponse
+	if err := json.NewDecoder(res.Body).Decode(&dashboard); err != nil {
+		t.Fatalf("The response cannot be decoded to a dashboard struct.\n%v\n", err)
+	}
+	if dashboard.Name != "Sweden" || dashboard.Isocode != "SE" || dashboard.Features.Capital != "Stockholm" ||
+		dashboard.Features.Population != 10353442 {
+		t.Errorf("The ad-hoc dashboard is not as expected: %v", dashboard)
+	}
+	if _, ok := dashboard.Features.TargetCurrencies["EUR"]; !ok {
+		t.Error("The target currency EUR is missing")
+	}
+
+	// Unknown features and missing countries are bad requests
+	if err := util.TestMethod(http.Client{}, endpoint+"?isoCode=SE&features=weather", http.MethodGet, http.StatusBadRequest); err != nil {
+		t.Error(err)
+	}
+	if err := util.TestMethod(http.Client{}, endpoint+"?features=capital", http.MethodGet, http.StatusBadRequest); err != nil {
+		t.Error(err)
+	}
+
+	// -----
+	// POST with a registration body
+	// -----
+	reg := util.Registration{IsoCode: "FI", Features: util.Features{Area: true}}
+	res, err = postToServer(endpoint, reg)
+	if err != nil {
+		t.Fatalf("Failed to post the registration.\n%v\n", err)
+	}
+	defer res.Body.Close()
+
+	dashboard = util.DashboardResponse{}
+	if err := json.NewDecoder(res.Body).Decode(&dashboard); err != nil {
+		t.Fatalf("The response cannot be decoded to a dashboard struct.\n%v\n", err)
+	}
+	if dashboard.Name != "Finland" || dashboard.Features.Area != 338424 {
+		t.Errorf("The posted ad-hoc dashboard is not as expected: %v", dashboard)
+	}
+
+	// Nothing may be stored in the database
+	file := util.ParseFile(util.STUB_DATABASE_REGISTRATIONS)
+	var stored []util.Registration
+	if err := json.Unmarshal(file, &stored); err != nil || len(stored) != 0 {
+		t.Errorf("Ad-hoc dashboards must not be stored. Found %d registrations", len(stored))
+	}
+}
+
+// TestComputedDashboardFeatures tests that computed features are evaluated over the other features of a dashboard,
+// and that invalid expressions are rejected.
+func TestComputedDashboardFeatures(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	if err := util.PopulateTestFile(util.STUB_DATABASE_REGISTRATIONS, []util.Registration{}); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+	endpoint := server.URL + strings.TrimSuffix(util.DASHBOARD_PATH, "/")
+
+	reg := util.Registration{IsoCode: "NO", Features: util.Features{
+		Population: true,
+		Area:       true,
+		Computed: map[string]string{
+			"density":   "population / area",
+			"doubled":   "-(area * 2) + 1.5",
+			"undefined": "population / (area - area)",
+		},
+	}}
+	res, err := postToServer(endpoint, reg)
+	if err != nil {
+		t.Fatalf("Failed to post the registration.\n%v\n", err)
+	}
+	defer res.Body.Close()
+
+	var dashboard util.DashboardResponse
+	if err := json.NewDecoder(res.Body).Decode(&dashboard); err != nil {
+		t.Fatalf("The response cannot be decoded to a dashboard struct.\n%v\n", err)
+	}
+
+	computed := dashboard.Features.Computed
+	if density := computed["density"]; density == nil || math.Abs(*density-5379475.0/323802.0) > 1e-9 {
+		t.Errorf("The computed density is not as expected: %v", density)
+	}
+	if doubled := computed["doubled"]; doubled == nil || *doubled != -323802*2+1.5 {
+		t.Errorf("The computed feature 'doubled' is not as expected: %v", doubled)
+	}
+	if value, ok := computed["undefined"]; !ok || value != nil {
+		t.Errorf("A division by zero must be null, got %v", value)
+	}
+
+	// -----
+	// Invalid expressions
+	// -----
+	registrationServer := httptest.NewServer(http.HandlerFunc(handler.RegistrationHandler))
+	defer registrationServer.Close()
+
+	invalid := []map[string]string{
+		{"density": "population / temperature"}, // The temperature is not enabled
+		{"density": "population % area"},
+		{"density": "len(population)"},
+		{"density": "population /"},
+		{"1density": "population / area"},
+		{"density": "\"text\""},
+		{"density": "population / 0x10"}, // Go literals that are not decimal numbers
+		{"density": "population / 1e400"},
+	}
+	for _, expressions := range invalid {
+		reg.Features.Computed = expressions
+		res, err := postToServer(registrationServer.URL+util.REGISTRATION_PATH, reg)
+		if err != nil {
+			t.Fatalf("Failed to post the registration.\n%v\n", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status code %d for %v, got %d", http.StatusUnprocessableEntity, expressions, res.StatusCode)
+		}
+
+		res, err = postToServer(endpoint, reg)
+		if err != nil {
+			t.Fatalf("Failed to post the registration.\n%v\n", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for the ad-hoc %v, got %d", http.StatusBadRequest, expressions, res.StatusCode)
+		}
+	}
+}
+
+// TestLocalizedDashboard tests that the country's name, the capital and the currency names are translated to the
+// language in the 'lang' query parameter or the Accept-Language header, and that English is the fallback.
+func TestLocalizedDashboard(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	if err := populateDashboardsFile(); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+
+	tests := []struct {
+		path           string
+		acceptLanguage string
+		language       string
+		name           string
+		capital        string
+		currencies     map[string]string
+	}{
+		{util.DASHBOARD_PATH + "1?lang=de", "", "de", "Norwegen", "Oslo",
+			map[string]string{"NOK": "Norwegische Krone", "EUR": "Euro"}},
+		// Norwegian is only found in the native names
+		{util.DASHBOARD_PATH + "1", "nb-NO, de;q=0.8", "nb", "Norge", "Oslo",
+			map[string]string{"NOK": "norsk krone", "EUR": "euro"}},
+		// The query parameter takes precedence
+		{util.DASHBOARD_PATH + "1?lang=sv", "de", "sv", "Norge", "Oslo",
+			map[string]string{"NOK": "norsk krona", "EUR": "euro"}},
+		// Unsupported languages fall back to English
+		{util.DASHBOARD_PATH + "1?lang=xx", "", "en", "Norway", "Oslo",
+			map[string]string{"NOK": "Norwegian krone", "EUR": "Euro"}},
+		{strings.TrimSuffix(util.DASHBOARD_PATH, "/") + "?isoCode=DK&features=capital&currencies=sek", "fr-CH, en;q=0.5",
+			"fr", "Danemark", "Copenhague", map[string]string{"DKK": "couronne danoise", "SEK": "couronne suédoise"}},
+	}
+	for _, test := range tests {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+test.path, nil)
+		if test.acceptLanguage != "" {
+			request.Header.Set(util.ACCEPT_LANGUAGE, test.acceptLanguage)
+		}
+		res, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("Failed to get the dashboard.\n%v\n", err)
+		}
+
+		var dashboard util.DashboardResponse
+		err = json.NewDecoder(res.Body).Decode(&dashboard)
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("The response cannot be decoded to a dashboard struct.\n%v\n", err)
+		}
+
+		if language := res.Header.Get(util.CONTENT_LANGUAGE); language != test.language {
+			t.Errorf("Expected the language %v for %v, got %v", test.language, test.path, language)
+		}
+		if dashboard.Name != test.name || dashboard.Features.Capital != test.capital {
+			t.Errorf("Expected %v with the capital %v for %v, got %v with %v", test.name, test.capital, test.path,
+				dashboard.Name, dashboard.Features.Capital)
+		}
+		if !reflect.DeepEqual(dashboard.Features.CurrencyNames, test.currencies) {
+			t.Errorf("Expected the currency names %v for %v, got %v", test.currencies, test.path,
+				dashboard.Features.CurrencyNames)
+		}
+	}
+
+	// -----
+	// Registrations
+	// -----
+	registrationServer := httptest.NewServer(http.HandlerFunc(handler.RegistrationHandler))
+	defer registrationServer.Close()
+
+	res, err := getFromServer(registrationServer.URL + util.REGISTRATION_PATH + "1?lang=fi")
+	if err != nil {
+		t.Fatalf("Failed to get the registration.\n%v\n", err)
+	}
+	defer res.Body.Close()
+
+	var registration util.Registration
+	if err := json.NewDecoder(res.Body).Decode(&registration); err != nil {
+		t.Fatalf("The response cannot be decoded to a registration struct.\n%v\n", err)
+	}
+	if registration.Country != "Norja" {
+		t.Errorf("Expected the registration's country in Finnish, got %v", registration.Country)
+	}
+}
+
+// TestUpstreamFailures tests that failing upstream services are retried, and that failures are returned with a status
+// code that tells what went wrong.
+func TestUpstreamFailures(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	// Make the retries and timeouts fast
+	client := upstream.Countries.Client
+	defer func(timeout time.Duration, retryWait time.Duration) {
+		client.Timeout, client.RetryWait = timeout, retryWait
+	}(client.Timeout, client.RetryWait)
+	client.Timeout, client.RetryWait = 100*time.Millisecond, time.Millisecond
+	defer client.Breaker.Reset()
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+	endpoint := server.URL + strings.TrimSuffix(util.DASHBOARD_PATH, "/") + "?isoCode=NO&features=capital"
+
+	tests := []struct {
+		name     string
+		failures int // failures is the number of requests that fail before the stub service responds
+		respond  func(w http.ResponseWriter)
+		status   int
+		requests int
+	}{
+		{"a failure that passes when retried", 2, func(w http.ResponseWriter) {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		}, http.StatusOK, 3},
+		{"a failure on every attempt", 10, func(w http.ResponseWriter) {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}, http.StatusBadGateway, upstream.DEFAULT_ATTEMPTS},
+		{"a service that is too slow", 10, func(w http.ResponseWriter) {
+			time.Sleep(300 * time.Millisecond)
+		}, http.StatusGatewayTimeout, upstream.DEFAULT_ATTEMPTS},
+		{"a rejected request", 10, func(w http.ResponseWriter) {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+		}, http.StatusBadGateway, 1},
+		{"a missing country with a HTML body", 10, func(w http.ResponseWriter) {
+			w.Header().Set(util.CONTENT_TYPE, util.MIMETYPE_HTML)
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("<html><body>Not Found</body></html>"))
+		}, http.StatusBadRequest, 1},
+		{"an invalid response", 10, func(w http.ResponseWriter) {
+			_, _ = w.Write([]byte("<html><body>OK</body></html>"))
+		}, http.StatusBadGateway, 1},
+	}
+	for _, test := range tests {
+		// The failures of one case should not open the breaker in the next
+		client.Breaker.Reset()
+
+		var requests atomic.Int32
+		flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if int(requests.Add(1)) <= test.failures {
+				test.respond(w)
+				return
+			}
+			stubs.StubCountryHandler(w, r)
+		}))
+		util.CountryStubPort = portOf(flaky.URL)
+
+		res, err := getFromServer(endpoint)
+		if err != nil {
+			t.Fatalf("Failed to get the dashboard.\n%v\n", err)
+		}
+		res.Body.Close()
+		flaky.Close()
+
+		if res.StatusCode != test.status {
+			t.Errorf("Expected status code %d for %v, got %d", test.status, test.name, res.StatusCode)
+		}
+		if int(requests.Load()) != test.requests {
+			t.Errorf("Expected %d requests to the service for %v, got %d", test.requests, test.name, requests.Load())
+		}
+	}
+}
+
+// TestCancelledDashboard tests that the requests to the upstream services are cancelled when the client disconnects,
+// and are not retried.
+func TestCancelledDashboard(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	client := upstream.Countries.Client
+	defer func(retryWait time.Duration) { client.RetryWait = retryWait }(client.RetryWait)
+	client.RetryWait = time.Millisecond
+	defer client.Breaker.Reset()
+
+	// The service waits for the request to be cancelled, or gives up after two seconds
+	var requests atomic.Int32
+	cancelled := make(chan bool, upstream.DEFAULT_ATTEMPTS)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		select {
+		case <-r.Context().Done():
+			cancelled <- true
+		case <-time.After(2 * time.Second):
+			cancelled <- false
+		}
+	}))
+	defer slow.Close()
+	util.CountryStubPort = portOf(slow.URL)
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		server.URL+strings.TrimSuffix(util.DASHBOARD_PATH, "/")+"?isoCode=IS&features=capital", nil)
+	if err != nil {
+		t.Fatalf("Failed to instantiate a new request.\n%v\n", err)
+	}
+	if res, err := http.DefaultClient.Do(req); err == nil {
+		res.Body.Close()
+		t.Fatalf("Expected the client to give up, got %v", res.Status)
+	}
+
+	select {
+	case wasCancelled := <-cancelled:
+		if !wasCancelled {
+			t.Errorf("Expected the request to the service to be cancelled when the client disconnected")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("The service never received the request")
+	}
+
+	// Give a retry the time to arrive, if there was one
+	time.Sleep(100 * time.Millisecond)
+	if requests.Load() != 1 {
+		t.Errorf("Expected 1 request to the service after the client disconnected, got %d", requests.Load())
+	}
+}
+
+// TestCircuitBreaker tests that the breaker of a failing upstream service opens after repeated failures, that
+// requests fail fast while it is open, and that a probe closes it again when the service is back.
+func TestCircuitBreaker(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	client := upstream.Countries.Client
+	defer func(attempts int, retryWait time.Duration, threshold int, cooldown time.Duration) {
+		client.Attempts, client.RetryWait = attempts, retryWait
+		client.Breaker.Threshold, client.Breaker.Cooldown = threshold, cooldown
+		client.Breaker.Reset()
+	}(client.Attempts, client.RetryWait, client.Breaker.Threshold, client.Breaker.Cooldown)
+	client.Attempts, client.RetryWait = 1, time.Millisecond
+	client.Breaker.Threshold, client.Breaker.Cooldown = 2, 200*time.Millisecond
+	client.Breaker.Reset()
+
+	var failing atomic.Bool
+	var requests atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		stubs.StubCountryHandler(w, r)
+	}))
+	defer flaky.Close()
+	util.CountryStubPort = portOf(flaky.URL)
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+	endpoint := server.URL + strings.TrimSuffix(util.DASHBOARD_PATH, "/") + "?isoCode=NO&features=capital"
+
+	getStatus := func() int {
+		res, err := getFromServer(endpoint)
+		if err != nil {
+			t.Fatalf("Failed to get the dashboard.\n%v\n", err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	// The breaker opens after 'Threshold' failures in a row
+	failing.Store(true)
+	for i := 0; i < 2; i++ {
+		if status := getStatus(); status != http.StatusBadGateway {
+			t.Errorf("Expected status code %d while the service fails, got %d", http.StatusBadGateway, status)
+		}
+	}
+	status := client.Breaker.Status()
+	if status.State != upstream.BREAKER_OPEN || status.Failures != 2 || status.OpenUntil == nil {
+		t.Fatalf("Expected an open breaker with 2 failures, got %+v", status)
+	}
+	if !strings.Contains(status.LastError, "status 500") || status.LastFailure == nil {
+		t.Errorf("Expected the last error to be the failure of the service, got %q", status.LastError)
+	}
+
+	// Requests fail fast while the breaker is open, without asking the service, and tell when to try again
+	res, err := getFromServer(endpoint)
+	if err != nil {
+		t.Fatalf("Failed to get the dashboard.\n%v\n", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d while the breaker is open, got %d", http.StatusServiceUnavailable, res.StatusCode)
+	}
+	if retryAfter := res.Header.Get(util.RETRY_AFTER); retryAfter != "1" {
+		t.Errorf("Expected Retry-After 1 for the rest of the cooldown, got %q", retryAfter)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("Expected no requests to the service while the breaker is open, got %d", requests.Load()-2)
+	}
+
+	// A failed probe opens the breaker again at once
+	time.Sleep(client.Breaker.Cooldown)
+	if status := getStatus(); status != http.StatusBadGateway {
+		t.Errorf("Expected status code %d for a failed probe, got %d", http.StatusBadGateway, status)
+	}
+	if state := client.Breaker.Status().State; state != upstream.BREAKER_OPEN {
+		t.Errorf("Expected the breaker to open after a failed probe, got %v", state)
+	}
+
+	// A probe that passes closes the breaker
+	failing.Store(false)
+	time.Sleep(client.Breaker.Cooldown)
+	if status := getStatus(); status != http.StatusOK {
+		t.Errorf("Expected status code %d when the service is back, got %d", http.StatusOK, status)
+	}
+	status = client.Breaker.Status()
+	if status.State != upstream.BREAKER_CLOSED || status.Failures != 0 || status.TotalFailures != 3 {
+		t.Errorf("Expected a closed breaker with 3 failures in total, got %+v", status)
+	}
+}
+
+// TestCurrencyProviders tests that the ECB's euro reference rates are converted to the base currency, and that the
+// next currency provider is used when the first one fails.
+func TestCurrencyProviders(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	client := upstream.Currencies.Client
+	defer func(attempts int) {
+		client.Attempts = attempts
+		client.Breaker.Reset()
+		_ = upstream.SetCurrencyProviders(upstream.PROVIDER_CURRENCY_API, upstream.PROVIDER_ECB)
+	}(client.Attempts)
+	client.Attempts = 1
+
+	if err := upstream.SetCurrencyProviders("unknown"); err == nil {
+		t.Error("Expected an error for an unknown currency provider")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+	endpoint := server.URL + strings.TrimSuffix(util.DASHBOARD_PATH, "/") + "?isoCode=NO&currencies=EUR,SEK,NOK"
+
+	getCurrencies := func() (int, map[string]float64) {
+		res, err := getFromServer(endpoint)
+		if err != nil {
+			t.Fatalf("Failed to get the dashboard.\n%v\n", err)
+		}
+		defer res.Body.Close()
+
+		var dashboard util.DashboardResponse
+		if res.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(res.Body).Decode(&dashboard); err != nil {
+				t.Fatalf("Failed to decode the dashboard.\n%v\n", err)
+			}
+		}
+		return res.StatusCode, dashboard.Features.TargetCurrencies
+	}
+	equalRates := func(a map[string]float64, b map[string]float64) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for code, rate := range a {
+			if math.Abs(rate-b[code]) > 1e-9 {
+				return false
+			}
+		}
+		return true
+	}
+
+	// The ECB's rates are of one euro (NOK 11.7535, SEK 11.6555), and are converted to the Norwegian krone
+	expected := map[string]float64{"EUR": 1 / 11.7535, "SEK": 11.6555 / 11.7535, "NOK": 1}
+	if err := upstream.SetCurrencyProviders(upstream.PROVIDER_ECB); err != nil {
+		t.Fatalf("Failed to set the currency providers.\n%v\n", err)
+	}
+	status, rates := getCurrencies()
+	if status != http.StatusOK || !equalRates(rates, expected) {
+		t.Errorf("Expected the ECB's rates %v, got status code %d and %v", expected, status, rates)
+	}
+
+	// The ECB is used when the Currency API fails
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	util.CurrenciesStubPort = portOf(failing.URL)
+
+	if err := upstream.SetCurrencyProviders(upstream.PROVIDER_CURRENCY_API, upstream.PROVIDER_ECB); err != nil {
+		t.Fatalf("Failed to set the currency providers.\n%v\n", err)
+	}
+	status, rates = getCurrencies()
+	if status != http.StatusOK || !equalRates(rates, expected) {
+		t.Errorf("Expected the ECB's rates when the Currency API fails, got status code %d and %v", status, rates)
+	}
+
+	// The error of the first provider is returned when all of them fail
+	if err := upstream.SetCurrencyProviders(upstream.PROVIDER_CURRENCY_API); err != nil {
+		t.Fatalf("Failed to set the currency providers.\n%v\n", err)
+	}
+	if status, _ = getCurrencies(); status != http.StatusBadGateway {
+		t.Errorf("Expected status code %d when the Currency API fails, got %d", http.StatusBadGateway, status)
+	}
+}
+
+// TestWeatherProviders tests that MET Norway's compact forecast is normalized into the same hourly forecast as
+// Open-Meteo's, for both the dashboard and the chart.
+func TestWeatherProviders(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+	defer func() { _ = upstream.SetWeatherProvider(upstream.PROVIDER_OPEN_METEO) }()
+
+	if err := populateDashboardsFile(); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+	if err := upstream.SetWeatherProvider("unknown"); err == nil {
+		t.Error("Expected an error for an unknown weather provider")
+	}
+	if err := upstream.SetWeatherProvider(upstream.PROVIDER_MET_NORWAY); err != nil {
+		t.Fatalf("Failed to set the weather provider.\n%v\n", err)
+	}
+
+	// MET Norway rejects requests without a User-Agent
+	var userAgent string
+	stubMetNorway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get(util.USER_AGENT)
+		stubs.StubMetNorwayHandler(w, r)
+	}))
+	defer stubMetNorway.Close()
+	util.MetNorwayStubPort = portOf(stubMetNorway.URL)
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+
+	res, err := getFromServer(server.URL + strings.TrimSuffix(util.DASHBOARD_PATH, "/") +
+		"?isoCode=NO&features=temperature,precipitation")
+	if err != nil {
+		t.Fatalf("Failed to get the dashboard.\n%v\n", err)
+	}
+	defer res.Body.Close()
+
+	var dashboard util.DashboardResponse
+	if err := json.NewDecoder(res.Body).Decode(&dashboard); err != nil {
+		t.Fatalf("Failed to decode the dashboard.\n%v\n", err)
+	}
+	if userAgent != upstream.DEFAULT_MET_NORWAY_USER_AGENT {
+		t.Errorf("Expected the User-Agent %q, got %q", upstream.DEFAULT_MET_NORWAY_USER_AGENT, userAgent)
+	}
+
+	// The means of the 24 hourly entries. The 6-hourly entries after them are not used.
+	if math.Abs(dashboard.Features.Temperature-0.8583333) > 1e-6 {
+		t.Errorf("Expected the mean temperature 0.858, got %v", dashboard.Features.Temperature)
+	}
+	if math.Abs(dashboard.Features.Precipitation-0.0916667) > 1e-6 {
+		t.Errorf("Expected the mean precipitation 0.092, got %v", dashboard.Features.Precipitation)
+	}
+
+	// MET Norway's units are shown like Open-Meteo's
+	chart, err := http.Get(server.URL + util.DASHBOARD_PATH + "1/chart.svg")
+	if err != nil {
+		t.Fatalf("Failed to get the chart.\n%v\n", err)
+	}
+	defer chart.Body.Close()
+	body, _ := io.ReadAll(chart.Body)
+	if chart.StatusCode != http.StatusOK || !strings.Contains(string(body), "Temperature (°C)") ||
+		!strings.Contains(string(body), "Apr 18") {
+		t.Errorf("Expected a chart of MET Norway's forecast, got status code %d", chart.StatusCode)
+	}
+}
+
+// TestCoalescedRequests tests that identical dashboards retrieved at the same time send only one request to each
+// upstream service, and that the coalesced calls are counted.
+func TestCoalescedRequests(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	// A slow service, so all the dashboards are retrieved while the first request is in flight
+	var requests atomic.Int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(300 * time.Millisecond)
+		stubs.StubCountryHandler(w, r)
+	}))
+	defer slow.Close()
+	util.CountryStubPort = portOf(slow.URL)
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+	endpoint := server.URL + strings.TrimSuffix(util.DASHBOARD_PATH, "/") + "?isoCode=NO&features=capital"
+
+	const consumers = 20
+	before := upstream.Countries.Metrics()
+
+	var wg sync.WaitGroup
+	statuses := make(chan int, consumers)
+	for i := 0; i < consumers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := getFromServer(endpoint)
+			if err != nil {
+				t.Errorf("Failed to get the dashboard.\n%v\n", err)
+				return
+			}
+			res.Body.Close()
+			statuses <- res.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	for status := range statuses {
+		if status != http.StatusOK {
+			t.Errorf("Expected status code %d for every consumer, got %d", http.StatusOK, status)
+		}
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected 1 request to the service, got %d", requests.Load())
+	}
+
+	after := upstream.Countries.Metrics()
+	calls, coalesced, sent := after.Calls-before.Calls, after.Coalesced-before.Coalesced, after.Requests-before.Requests
+	if calls != consumers || coalesced != consumers-1 || sent != 1 {
+		t.Errorf("Expected %d calls, %d coalesced and 1 request in the metrics, got %d, %d and %d", consumers,
+			consumers-1, calls, coalesced, sent)
+	}
+}
+
+// TestCoalescedCancellation tests that a coalesced caller that disconnects does not fail the callers that wait for
+// the same response, and that coalesced calls are counted when the request fails.
+func TestCoalescedCancellation(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+	defer upstream.Countries.Breaker.Reset()
+
+	var requests atomic.Int32
+	var status atomic.Int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(300 * time.Millisecond)
+		if code := int(status.Load()); code != http.StatusOK {
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		stubs.StubCountryHandler(w, r)
+	}))
+	defer slow.Close()
+	util.CountryStubPort = portOf(slow.URL)
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+	endpoint := server.URL + strings.TrimSuffix(util.DASHBOARD_PATH, "/") + "?isoCode=NO&features=capital"
+
+	// The first caller sends the request and gives up. The second waits for the same request.
+	status.Store(http.StatusOK)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	first := make(chan error, 1)
+	go func() {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err == nil {
+			var res *http.Response
+			if res, err = http.DefaultClient.Do(req); err == nil {
+				res.Body.Close()
+			}
+		}
+		first <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	res, err := getFromServer(endpoint)
+	if err != nil {
+		t.Fatalf("Failed to get the dashboard.\n%v\n", err)
+	}
+	res.Body.Close()
+	if err := <-first; err == nil {
+		t.Errorf("Expected the first caller to give up")
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected status code %d for the caller that waited, got %d", http.StatusOK, res.StatusCode)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected 1 request to the service, got %d", requests.Load())
+	}
+
+	// Every caller shares a request that fails, and is counted
+	status.Store(http.StatusBadRequest)
+	requests.Store(0)
+	before := upstream.Countries.Metrics()
+	const consumers = 5
+	var wg sync.WaitGroup
+	for i := 0; i < consumers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res, err := getFromServer(endpoint); err == nil {
+				res.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	after := upstream.Countries.Metrics()
+	if coalesced := after.Coalesced - before.Coalesced; coalesced != consumers-1 || requests.Load() != 1 {
+		t.Errorf("Expected 1 request and %d coalesced calls for a failing request, got %d and %d", consumers-1,
+			requests.Load(), coalesced)
+	}
+}
+
+// TestRateLimit tests that requests to an upstream host wait for the host's rate limit, and fail with 503 Service
+// Unavailable and Retry-After when they would wait too long.
+func TestRateLimit(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+	defer upstream.SetRateLimits(util.RateLimit{}, nil, 0)
+
+	// Stub services are not limited, so REST Countries is served as if it was the real service
+	service := httptest.NewServer(http.HandlerFunc(stubs.StubCountryHandler))
+	defer service.Close()
+	client := upstream.Countries.Client
+	defer func(url string) {
+		client.URL = url
+		util.Config.Stubs.RestCountries = true
+	}(client.URL)
+	client.URL = service.URL
+	util.Config.Stubs.RestCountries = false
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+	endpoint := server.URL + strings.TrimSuffix(util.DASHBOARD_PATH, "/") + "?features=capital&isoCode="
+
+	// One request at once, and one more every 100 milliseconds
+	hosts := map[string]util.RateLimit{"127.0.0.1": {Rate: 10, Burst: 1}}
+
+	tests := []struct {
+		name   string
+		queue  time.Duration
+		status int
+	}{
+		{"a request that waits for its turn", time.Second, http.StatusOK},
+		{"a request that would wait too long", 10 * time.Millisecond, http.StatusServiceUnavailable},
+	}
+	for _, test := range tests {
+		upstream.SetRateLimits(util.RateLimit{}, hosts, test.queue)
+		client.ClearCache() // Cached countries are not requested, and don't take a token
+
+		// The first request takes the only token, so the second must wait for the next
+		for i, isoCode := range []string{"NO", "SE"} {
+			res, err := getFromServer(endpoint + isoCode)
+			if err != nil {
+				t.Fatalf("Failed to get the dashboard.\n%v\n", err)
+			}
+			res.Body.Close()
+
+			status, retryAfter := http.StatusOK, ""
+			if i == 1 {
+				status = test.status
+				if status == http.StatusServiceUnavailable {
+					retryAfter = "1"
+				}
+			}
+			if res.StatusCode != status {
+				t.Errorf("Expected status code %d for %v, got %d", status, test.name, res.StatusCode)
+			}
+			if res.Header.Get(util.RETRY_AFTER) != retryAfter {
+				t.Errorf("Expected Retry-After %q for %v, got %q", retryAfter, test.name,
+					res.Header.Get(util.RETRY_AFTER))
+			}
+		}
+	}
+
+	// The shared request does not wait for a token longer than its caller's deadline, so the caller is told to retry
+	// instead of timing out
+	upstream.SetRateLimits(util.RateLimit{}, hosts, time.Second)
+	client.ClearCache()
+	var countries []map[string]any
+	if err := client.Get(context.Background(), "/alpha/FI", nil, &countries); err != nil {
+		t.Fatalf("Failed to get the first country.\n%v\n", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := client.Get(ctx, "/alpha/DK", nil, &countries)
+	var upstreamErr *upstream.Error
+	if !errors.Is(err, upstream.ErrRateLimited) || !errors.As(err, &upstreamErr) || upstreamErr.RetryAfter <= 0 {
+		t.Errorf("Expected the request to be rate limited with a time to retry, got %v", err)
+	}
+}
+
+// TestCacheWarming tests that the background refresh requests each country and base currency once, that dashboards
+// are served from the refreshed data, and that the refresh time is shown on the registrations. Nothing is refreshed
+// while the cache is off.
+func TestCacheWarming(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	// Count the requests to each service. The new ports give new cache keys, so nothing is cached from before.
+	var requests sync.Map
+	counting := func(name string, next http.HandlerFunc) string {
+		var count atomic.Int32
+		requests.Store(name, &count)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count.Add(1)
+			next(w, r)
+		}))
+		t.Cleanup(server.Close)
+		return portOf(server.URL)
+	}
+	count := func(name string) int32 {
+		value, _ := requests.Load(name)
+		return value.(*atomic.Int32).Load()
+	}
+	util.CountryStubPort = counting("countries", stubs.StubCountryHandler)
+	util.WeatherStubPort = counting("weather", stubs.StubWeatherHandler)
+	util.CurrenciesStubPort = counting("currencies", stubs.StubCurrencyHandler)
+
+	// Norway is in both registrations, but is only refreshed once
+	registrations := []util.Registration{
+		{ID: "1", Country: "Norway", IsoCode: "NO", Features: util.Features{Temperature: true, Capital: true,
+			TargetCurrencies: []string{"EUR"}}},
+		{ID: "2", Country: "Nordic", IsoCodes: []string{"NO", "SE"}, Features: util.Features{Capital: true}},
+	}
+	if err := util.PopulateTestFile(util.STUB_DATABASE_REGISTRATIONS, registrations); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+	stubDatabase := httptest.NewServer(http.HandlerFunc(stubs.DatabaseDashboardHandler))
+	defer stubDatabase.Close()
+	util.DatabaseStubPort = portOf(stubDatabase.URL)
+
+	// The cache is off by default, so nothing is refreshed
+	now := time.Date(2024, 4, 18, 12, 30, 0, 0, time.UTC)
+	dashboards.WarmRegistrations(now.Add(-time.Hour))
+	if count("countries") != 0 || count("weather") != 0 || count("currencies") != 0 {
+		t.Errorf("Expected nothing to be refreshed while the cache is off, got %d, %d and %d requests",
+			count("countries"), count("weather"), count("currencies"))
+	}
+	if refreshed, ok := dashboards.LastRefresh("1"); ok && refreshed.Equal(now.Add(-time.Hour)) {
+		t.Errorf("Expected no refresh time while the cache is off, got %v", refreshed)
+	}
+
+	for _, client := range []*upstream.Client{upstream.Countries.Client, upstream.Weather.Client,
+		upstream.Currencies.Client} {
+		defer func(client *upstream.Client, ttl time.Duration) { client.CacheTTL = ttl }(client, client.CacheTTL)
+		client.CacheTTL = time.Minute
+	}
+
+	dashboards.WarmRegistrations(now)
+	if count("countries") != 2 || count("weather") != 1 || count("currencies") != 1 {
+		t.Errorf("Expected 2 countries, 1 forecast and 1 currency to be refreshed, got %d, %d and %d",
+			count("countries"), count("weather"), count("currencies"))
+	}
+
+	// The dashboards are served from the refreshed data
+	dashboardServer := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer dashboardServer.Close()
+	for _, id := range []string{"1", "2"} {
+		res, err := getFromServer(dashboardServer.URL + util.DASHBOARD_PATH + id)
+		if err != nil {
+			t.Fatalf("Failed to get the dashboard.\n%v\n", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("Expected status code %d for dashboard %v, got %d", http.StatusOK, id, res.StatusCode)
+		}
+	}
+	if count("countries") != 2 || count("weather") != 1 || count("currencies") != 1 {
+		t.Errorf("Expected the dashboards to be served from the cache, got %d, %d and %d requests",
+			count("countries"), count("weather"), count("currencies"))
+	}
+
+	// The refresh time is shown on the registration
+	registrationServer := httptest.NewServer(http.HandlerFunc(handler.RegistrationHandler))
+	defer registrationServer.Close()
+	res, err := getFromServer(registrationServer.URL + util.REGISTRATION_PATH + "1")
+	if err != nil {
+		t.Fatalf("Failed to get the registration.\n%v\n", err)
+	}
+	defer res.Body.Close()
+	var registration util.Registration
+	if err := json.NewDecoder(res.Body).Decode(&registration); err != nil {
+		t.Fatalf("Failed to decode the registration.\n%v\n", err)
+	}
+	if registration.LastRefresh != "2024-04-18 12:30" {
+		t.Errorf("Expected the last refresh 2024-04-18 12:30, got %q", registration.LastRefresh)
+	}
+
+	// The next refresh requests the data again, even though it is cached
+	dashboards.WarmRegistrations(now.Add(time.Minute))
+	if count("countries") != 4 {
+		t.Errorf("Expected the countries to be requested again, got %d requests", count("countries"))
+	}
+}
+
+// TestRetrieveDashboardAsCSV tests that a dashboard is flattened to CSV with one record per target currency,
+// when the client asks for CSV in the Accept header or the 'format' query parameter.
+func TestRetrieveDashboardAsCSV(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	if err := populateDashboardsFile(); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+
+	for _, endpoint := range []string{util.DASHBOARD_PATH + "1", util.DASHBOARD_PATH + "1?format=csv"} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+endpoint, nil)
+		if err != nil {
+			t.Fatalf("Failed to instantiate a new request.\n%v\n", err)
+		}
+		if !strings.Contains(endpoint, "format") {
+			req.Header.Set(util.ACCEPT, "application/json;q=0.5, text/csv")
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to connect to the server.\n%v\n", err)
+		}
+
+		if contentType := res.Header.Get(util.CONTENT_TYPE); contentType != util.MIMETYPE_CSV {
+			t.Errorf("Expected content type %v, got %v", util.MIMETYPE_CSV, contentType)
+		}
+
+		records, err := csv.NewReader(res.Body).ReadAll()
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("The response cannot be read as CSV.\n%v\n", err)
+		}
+
+		// A header, and one record for each of the currencies EUR and NOK
+		if len(records) != 3 {
+			t.Fatalf("Expected 3 records, got %d", len(records))
+		}
+		header := strings.Join(records[0], ",")
+		if header != "country,isoCode,temperature,precipitation,capital,latitude,longitude,population,area,currency,rate,lastRetrieval" {
+			t.Errorf("Unexpected header: %v", header)
+		}
+		if records[1][9] != "EUR" || records[1][10] != "0.086289" || records[2][9] != "NOK" || records[2][4] != "Oslo" {
+			t.Errorf("Unexpected records: %v", records[1:])
+		}
+	}
+
+	// Unsupported formats are bad requests
+	if err := util.TestMethod(http.Client{}, server.URL+util.DASHBOARD_PATH+"1?format=xml", http.MethodGet, http.StatusBadRequest); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestRetrieveDashboardAsHTML tests that a dashboard is rendered as a HTML page, either with the '.html' extension or
+// when the client asks for HTML in the Accept header.
+func TestRetrieveDashboardAsHTML(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	if err := populateDashboardsFile(); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+
+	for _, endpoint := range []string{util.DASHBOARD_PATH + "1.html", util.DASHBOARD_PATH + "1"} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+endpoint, nil)
+		if err != nil {
+			t.Fatalf("Failed to instantiate a new request.\n%v\n", err)
+		}
+		req.Header.Set(util.ACCEPT, "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to connect to the server.\n%v\n", err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to read the response body.\n%v\n", err)
+		}
+
+		if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get(util.CONTENT_TYPE), util.MIMETYPE_HTML) {
+			t.Fatalf("Expected a HTML page with status 200 OK, got %v (%v)", res.Status, res.Header.Get(util.CONTENT_TYPE))
+		}
+
+		page := string(body)
+		for _, expected := range []string{"<h2>Norway", "Capital: Oslo", "5 379 475", "<td>EUR</td>", util.STATIC_PATH + "dashboard.css"} {
+			if !strings.Contains(page, expected) {
+				t.Errorf("The page for %v does not contain %q", endpoint, expected)
+			}
+		}
+	}
+}
+
+func TestRetrieveDashboardChart(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	if err := populateDashboardsFile(); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + util.DASHBOARD_PATH + "1/chart.svg?width=640&height=5000")
+	if err != nil {
+		t.Fatalf("Failed to connect to the server.\n%v\n", err)
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to read the response body.\n%v\n", err)
+	}
+
+	if res.StatusCode != http.StatusOK || res.Header.Get(util.CONTENT_TYPE) != util.MIMETYPE_SVG {
+		t.Fatalf("Expected a SVG image with status 200 OK, got %v (%v)", res.Status, res.Header.Get(util.CONTENT_TYPE))
+	}
+
+	// The height is clamped to the largest allowed size.
+	image := string(body)
+	for _, expected := range []string{`<svg xmlns="http://www.w3.org/2000/svg" width="640" height="1000"`, "<polyline", "Temperature (°C)", "Precipitation (mm)", "Apr 19"} {
+		if !strings.Contains(image, expected) {
+			t.Errorf("The chart does not contain %q", expected)
+		}
+	}
+
+	res, err = http.Get(server.URL + util.DASHBOARD_PATH + "1/chart.svg?width=wide")
+	if err != nil {
+		t.Fatalf("Failed to connect to the server.\n%v\n", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 Bad Request for an invalid width, got %v", res.Status)
+	}
+}
+
+// readServerSentEvent reads the next event of a Server-Sent Events stream. Heartbeats before the event are counted.
+func readServerSentEvent(reader *bufio.Reader) (map[string]string, int, error) {
+	event := map[string]string{}
+	heartbeats := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return event, heartbeats, err
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && len(event) > 0:
+			return event, heartbeats, nil
+		case strings.HasPrefix(line, ":"):
+			heartbeats++
+		case line != "":
+			field, value, _ := strings.Cut(line, ": ")
+			event[field] = value
+		}
+	}
+}
+
+func TestStreamDashboard(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	heartbeatInterval := dashboards.StreamHeartbeatInterval
+	dashboards.StreamHeartbeatInterval = 20 * time.Millisecond
+	defer func() { dashboards.StreamHeartbeatInterval = heartbeatInterval }()
+
+	// The dashboard must stop being watched before the test ends, or it is rebuilt by the events of other tests
+	linger := dashboards.StreamLinger
+	dashboards.StreamLinger = time.Millisecond
+	defer func() {
+		time.Sleep(50 * time.Millisecond)
+		dashboards.StreamLinger = linger
+	}()
+
+	if err := populateDashboardsFile(); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	// Count the requests for the country, to tell when the dashboard is rebuilt
+	var requests atomic.Int32
+	countries := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		stubs.StubCountryHandler(w, r)
+	}))
+	defer countries.Close()
+	util.CountryStubPort = portOf(countries.URL)
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+
+	connect := func(lastEventId string) (*http.Response, *bufio.Reader) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+util.DASHBOARD_PATH+"1/stream", nil)
+		if err != nil {
+			t.Fatalf("Failed to instantiate a new request.\n%v\n", err)
+		}
+		if lastEventId != "" {
+			req.Header.Set(util.LAST_EVENT_ID, lastEventId)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to connect to the server.\n%v\n", err)
+		}
+		if res.StatusCode != http.StatusOK || res.Header.Get(util.CONTENT_TYPE) != util.MIMETYPE_EVENT_STREAM {
+			t.Fatalf("Expected an event stream with status 200 OK, got %v (%v)", res.Status, res.Header.Get(util.CONTENT_TYPE))
+		}
+		return res, bufio.NewReader(res.Body)
+	}
+
+	// The current dashboard is sent first
+	res, reader := connect("")
+	first, _, err := readServerSentEvent(reader)
+	if err != nil {
+		t.Fatalf("Failed to read the first event.\n%v\n", err)
+	}
+	if first["event"] != dashboards.UPDATE_DASHBOARD || first["id"] == "" || !strings.Contains(first["data"], `"capital":"Oslo"`) {
+		t.Fatalf("Expected the current dashboard as the first event, got %v", first)
+	}
+
+	// Changes to other registrations don't rebuild the dashboard
+	built := requests.Load()
+	_ = notifications.InvokeEvent("NO", util.EVENT_CHANGE)
+	_ = notifications.InvokeEvent("SE", util.EVENT_DELETE)
+	time.Sleep(50 * time.Millisecond)
+	if requests.Load() != built {
+		t.Errorf("Expected the dashboard not to be rebuilt for other registrations, got %d requests",
+			requests.Load()-built)
+	}
+
+	// Heartbeats are sent while nothing changes, and a change to the registration sends the new dashboard
+	time.Sleep(100 * time.Millisecond)
+	changed := util.Registration{ID: "1", Country: "Norway", IsoCode: "NO", Features: util.Features{Population: true}}
+	if err := util.PopulateTestFile(util.STUB_DATABASE_REGISTRATIONS, []util.Registration{changed}); err != nil {
+		t.Fatalf("Failed to change the test data. %v\n", err)
+	}
+	_ = notifications.InvokeEvent("NO", util.EVENT_CHANGE)
+
+	second, heartbeats, err := readServerSentEvent(reader)
+	if err != nil {
+		t.Fatalf("Failed to read the second event.\n%v\n", err)
+	}
+	if heartbeats == 0 {
+		t.Errorf("Expected heartbeats while the dashboard did not change")
+	}
+	if second["event"] != dashboards.UPDATE_DASHBOARD || strings.Contains(second["data"], "capital") || !strings.Contains(second["data"], `"population":5379475`) {
+		t.Fatalf("Expected the changed dashboard, got %v", second)
+	}
+	res.Body.Close()
+
+	// A client that resumes after the first event is sent the second event again
+	res, reader = connect(first["id"])
+	defer res.Body.Close()
+	resumed, _, err := readServerSentEvent(reader)
+	if err != nil {
+		t.Fatalf("Failed to read the resumed event.\n%v\n", err)
+	}
+	if resumed["id"] != second["id"] {
+		t.Errorf("Expected to resume with event %v, got %v", second["id"], resumed["id"])
+	}
+
+	// A registration that can't be read is not deleted, and the stream goes on
+	if err := os.WriteFile(util.STUB_DATABASE_REGISTRATIONS, []byte("["), 0666); err != nil {
+		t.Fatalf("Failed to change the test data. %v\n", err)
+	}
+	_ = notifications.InvokeEvent("NO", util.EVENT_DELETE)
+	time.Sleep(50 * time.Millisecond)
+	changed.Features.Area = true
+	if err := util.PopulateTestFile(util.STUB_DATABASE_REGISTRATIONS, []util.Registration{changed}); err != nil {
+		t.Fatalf("Failed to change the test data. %v\n", err)
+	}
+	_ = notifications.InvokeEvent("NO", util.EVENT_CHANGE)
+	third, _, err := readServerSentEvent(reader)
+	if err != nil || third["event"] != dashboards.UPDATE_DASHBOARD || !strings.Contains(third["data"], `"area"`) {
+		t.Fatalf("Expected the changed dashboard after the database failed, got %v (%v)", third, err)
+	}
+
+	// Deleting the registration ends the stream
+	if err := util.PopulateTestFile(util.STUB_DATABASE_REGISTRATIONS, []util.Registration{}); err != nil {
+		t.Fatalf("Failed to change the test data. %v\n", err)
+	}
+	_ = notifications.InvokeEvent("NO", util.EVENT_DELETE)
+
+	deleted, _, err := readServerSentEvent(reader)
+	if err != nil || deleted["event"] != dashboards.UPDATE_DELETED {
+		t.Fatalf("Expected a deleted event, got %v (%v)", deleted, err)
+	}
+	if _, _, err := readServerSentEvent(reader); err != io.EOF {
+		t.Errorf("Expected the stream to end after the deleted event, got %v", err)
+	}
+}
+
+// TestDashboardSnapshots tests that snapshots are taken once per period of a registration's schedule, that old
+// snapshots are deleted, and that the stored snapshots are returned from the Dashboard-endpoint.
+func TestDashboardSnapshots(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+	defer startStubDatabase()()
+
+	// The scheduler remembers registrations between tests, so the ID is unique to every run
+	id := myCrypto.GetMD5Hash("snapshots" + time.Now().String())
+	registrations := []util.Registration{
+		{ID: id, Country: "Norway", IsoCode: "NO", Features: util.Features{Capital: true}, Snapshots: util.SCHEDULE_HOURLY},
+		{ID: "2", Country: "Sweden", IsoCode: "SE", Features: util.Features{Capital: true}},
+	}
+	if err := util.PopulateTestFile(util.STUB_DATABASE_REGISTRATIONS, registrations); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	now := time.Date(2024, 4, 18, 10, 15, 0, 0, time.UTC)
+	old := []util.Snapshot{{RegistrationId: id, Time: now.AddDate(0, 0, -100), Dashboard: json.RawMessage("{}")}}
+	if err := util.PopulateTestFile(util.STUB_DATABASE_SNAPSHOTS, old); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	// Only one snapshot is taken per hour
+	dashboards.TakeDueSnapshots(now)
+	dashboards.TakeDueSnapshots(now.Add(30 * time.Minute))
+	dashboards.TakeDueSnapshots(now.Add(time.Hour))
+
+	// The snapshots are appended to the file of the stub database, so the populated snapshots are left as they were
+	populated, err := json.MarshalIndent(old, "", "    ")
+	if err != nil {
+		t.Fatalf("Failed to encode the test data. %v\n", err)
+	}
+	if file, err := os.ReadFile(util.STUB_DATABASE_SNAPSHOTS); err != nil || !bytes.HasPrefix(file, populated) {
+		t.Errorf("Expected the snapshots to be appended to the file, got %s (%v)", file, err)
+	}
+
+	deleted, err := dashboards.PruneSnapshots(now)
+	if err != nil || deleted != 1 {
+		t.Errorf("Expected the snapshot older than the retention period to be deleted, deleted %v (%v)", deleted, err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler.DashboardHandler))
+	defer server.Close()
+
+	getSnapshots := func(query string) (int, []util.Snapshot) {
+		res, err := http.Get(server.URL + util.DASHBOARD_PATH + id + "/snapshots" + query)
+		if err != nil {
+			t.Fatalf("Failed to connect to the server.\n%v\n", err)
+		}
+		defer res.Body.Close()
+
+		var snapshots []util.Snapshot
+		if res.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(res.Body).Decode(&snapshots); err != nil {
+				t.Fatalf("Failed to decode the snapshots.\n%v\n", err)
+			}
+		}
+		return res.StatusCode, snapshots
+	}
+
+	status, snapshots := getSnapshots("?from=2024-04-18&to=2024-04-18")
+	if status != http.StatusOK || len(snapshots) != 2 {
+		t.Fatalf("Expected 2 snapshots on the day, got %v (%v)", len(snapshots), status)
+	}
+	if !snapshots[0].Time.Equal(now) || !snapshots[1].Time.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected snapshots at %v and %v, got %v and %v", now, now.Add(time.Hour), snapshots[0].Time, snapshots[1].Time)
+	}
+	if !strings.Contains(string(snapshots[0].Dashboard), `"capital":"Oslo"`) {
+		t.Errorf("Expected the snapshot to contain the dashboard, got %s", snapshots[0].Dashboard)
+	}
+
+	if _, snapshots := getSnapshots("?from=2024-04-18%2011:00"); len(snapshots) != 1 {
+		t.Errorf("Expected 1 snapshot after 11:00, got %v", len(snapshots))
+	}
+	if status, _ := getSnapshots("?from=yesterday"); status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 Bad Request for an invalid time, got %v", status)
+	}
+}
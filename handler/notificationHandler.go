@@ -27,11 +27,18 @@ func NotificationHandler(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		id, _ := util.GetIdFromUrl(r.URL.Path)
 
+		// Notifications are returned as JSON, unless the client asks for CSV or NDJSON
+		format, err := util.NegotiateFormat(r)
+		if err != nil {
+			util.HttpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		if id == "" {
-			getAllNotifications(w)
+			getAllNotifications(w, format)
 		} else {
 			// Pass the ID provided by the client.
-			getSingleNotification(w, id)
+			getSingleNotification(w, id, format)
 		}
 	case http.MethodPost:
 		registerNotification(w, r)
@@ -53,9 +60,9 @@ func NotificationHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// getAllNotifications returns all notifications to the client.
+// getAllNotifications returns all notifications to the client in the requested format.
 // If no notifications are found, then an empty array is returned.
-func getAllNotifications(w http.ResponseWriter) {
+func getAllNotifications(w http.ResponseWriter, format string) {
 	notifications, err := database.GetAllNotifications()
 
 	if err != nil {
@@ -64,6 +71,11 @@ func getAllNotifications(w http.ResponseWriter) {
 		return
 	}
 
+	if format != util.FORMAT_JSON {
+		writeNotifications(w, format, notifications)
+		return
+	}
+
 	// There might not be any registered notifications at all... return an empty array
 	if len(notifications) == 0 {
 		w.Header().Set(util.CONTENT_TYPE, util.MIMETYPE_JSON)
@@ -93,9 +105,9 @@ func getAllNotifications(w http.ResponseWriter) {
 	}
 }
 
-// getSingleNotification retrieves a single notification by its id.
+// getSingleNotification retrieves a single notification by its id, and returns it in the requested format.
 // If the notification was not found, 404 not found is returned to the client.
-func getSingleNotification(w http.ResponseWriter, id string) {
+func getSingleNotification(w http.ResponseWriter, id string, format string) {
 	notification, err := database.GetSingleNotification(id)
 
 	// Error from the database
@@ -111,6 +123,11 @@ func getSingleNotification(w http.ResponseWriter, id string) {
 		return
 	}
 
+	if format != util.FORMAT_JSON {
+		writeNotifications(w, format, []models.NotificationDatabaseModel{notification})
+		return
+	}
+
 	// Marshall the returning struct from the database
 	marshalled, err := json.Marshal(notification)
 	if err != nil {
@@ -137,6 +154,28 @@ func getSingleNotification(w http.ResponseWriter, id string) {
 	}
 }
 
+// writeNotifications writes notifications to the client as CSV or NDJSON.
+func writeNotifications(w http.ResponseWriter, format string, notifications []models.NotificationDatabaseModel) {
+	var err error
+	if format == util.FORMAT_NDJSON {
+		err = util.WriteNDJSON(w, notifications)
+	} else {
+		records := make([][]string, 0, len(notifications))
+		for _, n := range notifications {
+			conditions := make([]string, 0, len(n.Conditions))
+			for _, c := range n.Conditions {
+				conditions = append(conditions, c.String())
+			}
+			records = append(records, []string{n.Id, n.Url, n.Event, n.Country, util.JoinList(conditions)})
+		}
+		err = util.WriteCSV(w, []string{"id", "url", "event", "country", "conditions"}, records)
+	}
+
+	if err != nil {
+		log.Printf("Failed to write notifications as %v: %v\n", format, err)
+	}
+}
+
 // registerNotification lets the client register a new notification.
 //
 // The client provides us a URL, so we can notify them whenever a certain event has occurred.
@@ -181,14 +220,24 @@ func registerNotification(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Validate conditions
+	validationMessage = validateConditions(&dto)
+	if validationMessage != nil {
+		util.HttpError(w,
+			"field 'conditions' is invalid. "+validationMessage.Error(),
+			http.StatusUnprocessableEntity)
+		return
+	}
+
 	// Convert DTO fields to database model
 	databaseModel := models.NotificationDatabaseModel{
 		// ID cannot be provided by the client. If this still happens, we clear it. This is strictly not necessary, but
 		// prevents potential bugs in this project's future development.
-		Id:      myCrypto.GetMD5Hash(dto.Url + dto.Event + time.Now().String()),
-		Url:     dto.Url,
-		Event:   dto.Event,
-		Country: dto.Country,
+		Id:         myCrypto.GetMD5Hash(dto.Url + dto.Event + time.Now().String()),
+		Url:        dto.Url,
+		Event:      dto.Event,
+		Country:    dto.Country,
+		Conditions: dto.Conditions,
 	}
 
 	// Store the new notification to the database
@@ -209,6 +258,27 @@ func registerNotification(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// validateConditions ensures that THRESHOLD notifications have conditions, and that other notifications don't.
+// Every condition must have a known feature and operator.
+func validateConditions(dto *models.NotificationDTO) error {
+	if dto.Event != util.EVENT_THRESHOLD {
+		if len(dto.Conditions) > 0 {
+			return fmt.Errorf("conditions are only allowed on 'THRESHOLD' events")
+		}
+		return nil
+	}
+
+	if len(dto.Conditions) == 0 {
+		return fmt.Errorf("'THRESHOLD' events require at least one condition")
+	}
+	for i := range dto.Conditions {
+		if err := dto.Conditions[i].Validate(); err != nil {
+			return fmt.Errorf("condition %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
 // deleteNotification removes a notification by id from the database.
 // It also protects notification by id '123123' to be deleted. This particular notification is used for unit testing.
 func deleteNotification(w http.ResponseWriter, id string) {
@@ -1,8 +1,10 @@
 package handler_test
 
 import (
+	"assignment2/dashboards"
 	"assignment2/handler"
 	"assignment2/models"
+	"assignment2/notifications"
 	stubs "assignment2/stubs/handler"
 	"assignment2/util"
 	"bytes"
@@ -453,3 +455,276 @@ func TestDeleteNotification(t *testing.T) {
 		t.Errorf("Deleting a notification that does not exist should yield status code 204 Not Created. Expected %v got %v", http.StatusNoContent, res.StatusCode)
 	}
 }
+
+// TestGetAllNotificationsAsNDJSON tests that notifications are returned as newline delimited JSON when the client asks
+// for it, with one notification on each line.
+func TestGetAllNotificationsAsNDJSON(t *testing.T) {
+	util.FixStubPaths()
+
+	util.Config.Stubs.Database = true
+
+	stubServer := httptest.NewServer(http.HandlerFunc(stubs.DatabaseNotificationHandler))
+	defer stubServer.Close()
+
+	port := strings.Split(stubServer.URL, ":")
+	portNum := port[len(port)-1]
+	util.DatabaseStubPort = portNum
+
+	if err := populateNotificationsFile(); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler.NotificationHandler))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to instantiate a new request.\n%v\n", err)
+	}
+	req.Header.Set(util.ACCEPT, util.MIMETYPE_NDJSON)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect to the server.\n%v\n", err)
+	}
+	defer res.Body.Close()
+
+	if contentType := res.Header.Get(util.CONTENT_TYPE); contentType != util.MIMETYPE_NDJSON {
+		t.Errorf("Expected content type %v, got %v", util.MIMETYPE_NDJSON, contentType)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Failed to read the response body.\n%v\n", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d", len(lines))
+	}
+
+	var notification models.NotificationDatabaseModel
+	if err := json.Unmarshal([]byte(lines[2]), &notification); err != nil {
+		t.Fatalf("The line cannot be decoded to a notification struct.\n%v\n", err)
+	}
+	if notification.Id != "3" || notification.Url != "https://3.no/3" {
+		t.Errorf("Unexpected notification: %v", notification)
+	}
+}
+
+// TestThresholdNotifications tests that THRESHOLD notifications require valid conditions, and that the subscriber
+// is notified only when a condition starts or stops holding.
+func TestThresholdNotifications(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	if err := populateNotificationsFile(); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	stubMux := http.NewServeMux()
+	stubMux.HandleFunc(util.REGISTRATION_PATH, stubs.DatabaseDashboardHandler)
+	stubMux.HandleFunc(util.NOTIFICATION_PATH, stubs.DatabaseNotificationHandler)
+	stubServer := httptest.NewServer(stubMux)
+	defer stubServer.Close()
+	util.DatabaseStubPort = portOf(stubServer.URL)
+
+	server := httptest.NewServer(http.HandlerFunc(handler.NotificationHandler))
+	defer server.Close()
+
+	// Invalid conditions are rejected
+	invalid := []string{
+		`{"url": "https://1.no", "event": "THRESHOLD", "country": "NO"}`,
+		`{"url": "https://1.no", "event": "THRESHOLD", "conditions": [{"feature": "temperature", "operator": "=", "value": 1}]}`,
+		`{"url": "https://1.no", "event": "THRESHOLD", "conditions": [{"feature": "humidity", "operator": "<", "value": 1}]}`,
+		`{"url": "https://1.no", "event": "CHANGE", "conditions": [{"feature": "area", "operator": "<", "value": 1}]}`,
+	}
+	for _, body := range invalid {
+		res, err := http.Post(server.URL, util.MIMETYPE_JSON, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to connect to the server.\n%v\n", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 Unprocessable Entity for %v, got %v", body, res.Status)
+		}
+	}
+
+	// The subscriber records every notification it receives
+	received := make(chan models.InvocationNotificationModel, 10)
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var invocation models.InvocationNotificationModel
+		if err := json.NewDecoder(r.Body).Decode(&invocation); err == nil {
+			received <- invocation
+		}
+	}))
+	defer subscriber.Close()
+
+	body := `{"url": "` + subscriber.URL + `", "event": "threshold", "country": "NO", "conditions": [
+		{"feature": "population", "operator": ">", "value": 5000000},
+		{"feature": "targetCurrencies.eur", "operator": ">=", "value": 0.09}]}`
+	res, err := http.Post(server.URL, util.MIMETYPE_JSON, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to connect to the server.\n%v\n", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201 Created, got %v", res.Status)
+	}
+
+	registrations := []util.Registration{{ID: "1", Country: "Norway", IsoCode: "NO"}, {ID: "2", Country: "Sweden", IsoCode: "SE"}}
+	if err := util.PopulateTestFile(util.STUB_DATABASE_REGISTRATIONS, registrations); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	// The population condition starts holding. The EUR rate (0.086289) does not.
+	dashboards.CheckThresholds()
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 notification, got %v", len(received))
+	}
+	invocation := <-received
+	if invocation.Event != util.EVENT_THRESHOLD || invocation.Country != "NO" || invocation.Threshold == nil ||
+		invocation.Threshold.Feature != "population" || !invocation.Threshold.Holds || invocation.Threshold.Actual != 5379475 {
+		t.Errorf("Expected the population condition to start holding in NO, got %+v", invocation)
+	}
+
+	// Nothing changed, so nothing is sent
+	dashboards.CheckThresholds()
+	if len(received) != 0 {
+		t.Errorf("Expected no notifications when nothing changed, got %v", len(received))
+	}
+
+	// The population drops below the line
+	smallCountry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(util.CONTENT_TYPE, util.MIMETYPE_JSON)
+		fmt.Fprint(w, `[{"name": {"common": "Norway"}, "cca2": "NO", "population": 100, "latlng": [62, 10], "currencies": {"NOK": {}}}]`)
+	}))
+	defer smallCountry.Close()
+	util.CountryStubPort = portOf(smallCountry.URL)
+
+	dashboards.CheckThresholds()
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 notification, got %v", len(received))
+	}
+	if invocation := <-received; invocation.Threshold == nil || invocation.Threshold.Holds || invocation.Threshold.Actual != 100 {
+		t.Errorf("Expected the population condition to stop holding, got %+v", invocation)
+	}
+
+	// Conditions that hold when the service starts are seeded without notifying
+	body = `{"url": "` + subscriber.URL + `", "event": "threshold", "country": "NO", "conditions": [
+		{"feature": "population", "operator": "<", "value": 1000}]}`
+	res, err = http.Post(server.URL, util.MIMETYPE_JSON, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to connect to the server.\n%v\n", err)
+	}
+	res.Body.Close()
+
+	dashboards.SeedThresholds()
+	dashboards.CheckThresholds()
+	if len(received) != 0 {
+		t.Errorf("Expected no notifications for seeded conditions, got %v", len(received))
+	}
+}
+
+// TestInvocationPayload tests that webhooks and WebSocket subscribers receive the same payload, with the country and
+// the event that happened rather than the values of their filter.
+func TestInvocationPayload(t *testing.T) {
+	util.FixStubPaths()
+	util.Config.Stubs.Database = true
+
+	received := make(chan models.InvocationNotificationModel, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var invocation models.InvocationNotificationModel
+		if err := json.NewDecoder(r.Body).Decode(&invocation); err == nil {
+			received <- invocation
+		}
+	}))
+	defer webhook.Close()
+
+	// The webhook is registered for every country and event
+	if err := util.PopulateTestFile(util.STUB_DATABASE_NOTIFICATIONS,
+		[]models.NotificationDatabaseModel{{Id: "1", Url: webhook.URL}}); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+	stubServer := httptest.NewServer(http.HandlerFunc(stubs.DatabaseNotificationHandler))
+	defer stubServer.Close()
+	util.DatabaseStubPort = portOf(stubServer.URL)
+
+	events, unsubscribe := notifications.Subscribe(models.NotificationDatabaseModel{Id: "2"})
+	defer unsubscribe()
+
+	if err := notifications.InvokeEvent("SE", util.EVENT_REGISTER); err != nil {
+		t.Fatal("Failed to invoke the event:", err)
+	}
+	if len(received) != 1 || len(events) != 1 {
+		t.Fatalf("Expected 1 webhook and 1 subscriber event, got %v and %v", len(received), len(events))
+	}
+	fromWebhook, fromSubscriber := <-received, <-events
+
+	if fromWebhook.Id != "1" || fromSubscriber.Id != "2" {
+		t.Errorf("Expected the IDs of the notifications, got %v and %v", fromWebhook.Id, fromSubscriber.Id)
+	}
+	fromWebhook.Id, fromSubscriber.Id = "", ""
+	if fromWebhook.Country != "SE" || fromWebhook.Event != util.EVENT_REGISTER ||
+		!fromWebhook.Time.Equal(fromSubscriber.Time) || fromWebhook.Country != fromSubscriber.Country ||
+		fromWebhook.Event != fromSubscriber.Event {
+		t.Errorf("Expected the same payloads for SE and REGISTER, got %+v and %+v", fromWebhook, fromSubscriber)
+	}
+}
+
+// TestComparisonInvocation tests that an event of a comparison registration is sent once to every notification, for
+// the country it is filtered on, or for the first country if it is not filtered on one.
+func TestComparisonInvocation(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	received := make(chan models.InvocationNotificationModel, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var invocation models.InvocationNotificationModel
+		if err := json.NewDecoder(r.Body).Decode(&invocation); err == nil {
+			received <- invocation
+		}
+	}))
+	defer webhook.Close()
+
+	if err := populateRegistrationFile(); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+	if err := util.PopulateTestFile(util.STUB_DATABASE_NOTIFICATIONS,
+		[]models.NotificationDatabaseModel{{Id: "1", Url: webhook.URL, Event: util.EVENT_REGISTER}}); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+	stubMux := http.NewServeMux()
+	stubMux.HandleFunc(util.REGISTRATION_PATH, stubs.DatabaseDashboardHandler)
+	stubMux.HandleFunc(util.NOTIFICATION_PATH, stubs.DatabaseNotificationHandler)
+	stubServer := httptest.NewServer(stubMux)
+	defer stubServer.Close()
+	util.DatabaseStubPort = portOf(stubServer.URL)
+
+	unfiltered, unsubscribeUnfiltered := notifications.Subscribe(models.NotificationDatabaseModel{Event: util.EVENT_REGISTER})
+	defer unsubscribeUnfiltered()
+	sweden, unsubscribeSweden := notifications.Subscribe(models.NotificationDatabaseModel{Country: "SE"})
+	defer unsubscribeSweden()
+	denmark, unsubscribeDenmark := notifications.Subscribe(models.NotificationDatabaseModel{Country: "DK"})
+	defer unsubscribeDenmark()
+
+	request := httptest.NewRequest(http.MethodPost, util.REGISTRATION_PATH,
+		strings.NewReader(`{"country": "Nordics", "isoCodes": ["NO", "SE"]}`))
+	responseRecorder := httptest.NewRecorder()
+	handler.RegistrationHandler(responseRecorder, request)
+	if responseRecorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %v", http.StatusCreated, responseRecorder.Code,
+			responseRecorder.Body.String())
+	}
+
+	if len(received) != 1 || len(unfiltered) != 1 || len(sweden) != 1 || len(denmark) != 0 {
+		t.Fatalf("Expected 1 webhook, 1 unfiltered, 1 Swedish and 0 Danish events, got %d, %d, %d and %d",
+			len(received), len(unfiltered), len(sweden), len(denmark))
+	}
+	if event := <-received; event.Country != "NO" {
+		t.Errorf("Expected the webhook to receive the event for the first country, got %+v", event)
+	}
+	if event := <-sweden; event.Country != "SE" {
+		t.Errorf("Expected the subscriber for SE to receive the event for SE, got %+v", event)
+	}
+}
@@ -2,12 +2,23 @@ package handler
 
 import (
 	"assignment2/crypto"
+	"assignment2/dashboards"
 	"assignment2/database"
 	"assignment2/notifications"
+	"assignment2/upstream"
 	"assignment2/util"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"math"
+	"mime"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -22,8 +33,16 @@ import (
 // - DELETE: Removes a dashboard.
 // - PATCH: Apply only specified updates to a dashboard.
 //
+// The share links of a registration are handled on {id}/shares. See handleRegistrationSharesRequest.
+//
 // If an unrecognized method is detected, an appropriate error is returned.
 func RegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	if id, resource := util.SplitResourcePath(r.URL.Path, util.REGISTRATION_PATH); id != "" &&
+		(resource == "shares" || strings.HasPrefix(resource, "shares/")) {
+		handleRegistrationSharesRequest(w, r, id, strings.Trim(strings.TrimPrefix(resource, "shares"), "/"))
+		return
+	}
+
 	switch r.Method { //a switch for the supported methods.
 	case http.MethodGet:
 		HandleRegistrationGetRequest(w, r)
@@ -43,24 +62,139 @@ func RegistrationHandler(w http.ResponseWriter, r *http.Request) {
 // HandleRegistrationPostRequest creates a new dashboard. First it decodes the request body into a
 // Registration struct, generates an INT hashed ID, sets the structs last change time to current, and saves
 // the dashboard to the database.
+//
+// A registration can also be created from a template (?template=<name>), or as a clone of another registration
+// (/registrations/{id}/clone). See handleRegistrationTemplateRequest and handleRegistrationCloneRequest.
 func HandleRegistrationPostRequest(w http.ResponseWriter, r *http.Request) {
-	//Decode JSON into registration struct
-	var registration util.Registration
-	err := json.NewDecoder(r.Body).Decode(&registration)
+	id, resource := util.SplitResourcePath(r.URL.Path, util.REGISTRATION_PATH)
+	switch {
+	case id != "" && resource == "clone":
+		handleRegistrationCloneRequest(w, r, id)
+		return
+	case r.URL.Query().Has("template"):
+		handleRegistrationTemplateRequest(w, r, r.URL.Query().Get("template"))
+		return
+	}
+
+	//Decode JSON into registration struct, and validate it
+	registration, ok := decodeRegistration(w, r, r.Body)
+	if !ok {
+		return
+	}
+
+	createRegistration(w, registration)
+}
+
+// handleRegistrationTemplateRequest creates a new dashboard from a template. The registration has the template's
+// features, and the country given by the 'country' and 'isoCode' query parameters. The body is optional, and may
+// override fields of the registration (see overrideRegistration).
+//
+// Example: POST /dashboard/v1/registrations/?template=nordic-default&isoCode=SE
+func handleRegistrationTemplateRequest(w http.ResponseWriter, r *http.Request, name string) {
+	template, err := database.GetTemplate(name)
+	if errors.Is(err, database.ErrTemplateNotFound) {
+		util.HttpValidationError(w, "the registration is invalid",
+			util.ValidationError{{Field: "template", Reason: "no template is named '" + name + "'"}})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting template %v: %v\n", name, err)
+		http.Error(w, "Error, could not get the template", http.StatusInternalServerError)
+		return
+	}
+
+	overrideRegistration(w, r, util.Registration{Features: template.Features})
+}
+
+// handleRegistrationCloneRequest creates a new dashboard as a copy of the registration by given ID. Everything but
+// the ID and the timestamps is copied. The country may be changed by the 'country' and 'isoCode' query parameters, and
+// the body may override other fields (see overrideRegistration).
+//
+// Example: POST /dashboard/v1/registrations/123/clone?isoCode=SE
+func handleRegistrationCloneRequest(w http.ResponseWriter, r *http.Request, id string) {
+	existingRegistration, err := database.GetSingleRegistrationByID(id)
+	if err != nil {
+		http.Error(w, "Error: could not find specified ID to clone", http.StatusNotFound)
+		return
+	}
+
+	overrideRegistration(w, r, existingRegistration)
+}
+
+// overrideRegistration creates a new dashboard from a base registration, with overrides from the request.
+//
+// # Description
+//
+// - The 'country' and 'isoCode' query parameters replace the country of the base.
+// - The body is optional. If given, it is a JSON Merge Patch (RFC 7396) of the base, like PATCH.
+// - A new country replaces the country of the base as a whole. Mentioning any of 'country', 'isoCode' and
+// 'isoCodes' clears the others, so a clone of Norway with the ISO code SE becomes Sweden.
+//
+// The result is validated the same way as a new registration.
+func overrideRegistration(w http.ResponseWriter, r *http.Request, base util.Registration) {
+	query := r.URL.Query()
+
+	overrides, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error, could not read body", http.StatusBadRequest)
+		return
+	}
+	var overrideFields map[string]json.RawMessage
+	if len(bytes.TrimSpace(overrides)) > 0 {
+		if err := json.Unmarshal(overrides, &overrideFields); err != nil || overrideFields == nil {
+			util.HttpError(w, "could not parse body. The overrides must be a JSON object", http.StatusBadRequest)
+			return
+		}
+	}
+
+	newCountry := query.Has("country") || query.Has("isoCode")
+	for _, field := range []string{"country", "isoCode", "isoCodes"} {
+		_, overridden := overrideFields[field]
+		newCountry = newCountry || overridden
+	}
+	if newCountry {
+		base.Country, base.IsoCode, base.IsoCodes = query.Get("country"), query.Get("isoCode"), nil
+	}
+
+	document, err := registrationDocument(base)
+	if err == nil && overrideFields != nil {
+		document, err = util.ApplyMergePatch(document, overrides)
+	}
 	if err != nil {
-		http.Error(w, "Error, could not parse body", http.StatusBadRequest)
+		http.Error(w, "Error, could not create the registration", http.StatusInternalServerError)
 		return
 	}
 
+	registration, err := util.DecodeRegistration(bytes.NewReader(document))
+	var errs util.ValidationError
+	if errors.As(err, &errs) {
+		util.HttpValidationError(w, "the registration is invalid", errs)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error, could not create the registration", http.StatusInternalServerError)
+		return
+	}
+	if !validateRegistration(w, r, &registration) {
+		return
+	}
+
+	createRegistration(w, registration)
+}
+
+// createRegistration stores a new, validated registration, responds with its ID and creation time, and invokes the
+// REGISTER notifications.
+func createRegistration(w http.ResponseWriter, registration util.Registration) {
 	//Generates hashed ID (mashing country name and time.now)
 	hashID := myCrypto.GetMD5Hash(registration.Country + time.Now().String())
 	registration.ID = hashID //Sets registration.ID (ID in struct) to hashed ID
 
 	//Time when document is created (later changed in PUT function for last changed time).
 	registration.LastChange = time.Now().Format("2006-01-02 15:04")
+	registration.LastRefresh = ""
 
 	//Adds a new document to firestore in "dashboards" collection.
-	err = database.AddNewDashboard(registration, hashID)
+	err := database.AddNewDashboard(registration, hashID)
 	if err != nil {
 		http.Error(w, "Error, could not store information", http.StatusInternalServerError)
 		return
@@ -77,10 +211,7 @@ func HandleRegistrationPostRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Invoke registration notification
-	err = notifications.InvokeEvent(registration.IsoCode, util.EVENT_REGISTER)
-	if err != nil {
-		log.Println("Error invoking event:", err)
-	}
+	invokeRegistrationEvent(registration, util.EVENT_REGISTER)
 
 	//Sets header to JSON type and with creation status message and writes bakc id/time response.
 	w.Header().Set("Content-Type", "application/json")
@@ -90,16 +221,34 @@ func HandleRegistrationPostRequest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// HandleRegistrationGetRequest retrieves either a specified dashboard or ALL dashboard if no ID
-// is given. Decodes documents into Registration structs and returns in JSON format.
+// HandleRegistrationGetRequest retrieves either a specified dashboard or ALL dashboard if no ID is given. All
+// dashboards may be filtered by label selectors (see util.ParseLabelSelector) and by a free-text search of their names
+// and descriptions (see util.Registration.MatchesText). Decodes documents into Registration structs and returns in
+// JSON format, unless the client asks for CSV or NDJSON (see util.NegotiateFormat). Country names are in the language
+// the client asks for (see util.NegotiateLanguage).
 func HandleRegistrationGetRequest(w http.ResponseWriter, r *http.Request) {
+	format, err := util.NegotiateFormat(r)
+	if err != nil {
+		util.HttpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lang := util.NegotiateLanguage(r)
+
 	//Splits URL path at "/"
 	id, _ := util.GetIdFromUrl(r.URL.Path)
 	if id == "" {
-		dashboards, err := database.GetAllRegistrations()
+		//Listings may be filtered by labels (?label=team=finance) and free text (?q=oslo)
+		query := r.URL.Query()
+		requirements, err := util.ParseLabelSelector(query["label"])
+		if err != nil {
+			util.HttpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		registrations, err := database.GetAllRegistrations()
 
 		// There might not be any registered notifications at all...
-		if len(dashboards) == 0 {
+		if len(registrations) == 0 {
 			util.HttpError(w, "no registered dashboards found", http.StatusNotFound)
 			return
 		}
@@ -111,9 +260,28 @@ func HandleRegistrationGetRequest(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// A search that matches nothing is an empty list, not an error
+		matching := []util.Registration{}
+		for _, registration := range registrations {
+			if registration.MatchesLabels(requirements) && registration.MatchesText(query.Get("q")) {
+				matching = append(matching, registration)
+			}
+		}
+		registrations = matching
+
+		for i := range registrations {
+			localizeRegistration(r.Context(), &registrations[i], lang)
+			setLastRefresh(&registrations[i])
+		}
+		util.SetLanguage(w, lang)
+		if format != util.FORMAT_JSON {
+			writeRegistrations(w, format, registrations)
+			return
+		}
+
 		//Set content type and header with error message
 		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(dashboards); err != nil { // Use the renamed slice here
+		if err := json.NewEncoder(w).Encode(registrations); err != nil { // Use the renamed slice here
 			http.Error(w, "Error encoding response JSON", http.StatusInternalServerError)
 			return
 		}
@@ -122,6 +290,14 @@ func HandleRegistrationGetRequest(w http.ResponseWriter, r *http.Request) {
 		//Gets specified document by ID from firestore.
 		reg, err := database.GetSingleRegistrationByID(id)
 		if err == nil {
+			localizeRegistration(r.Context(), &reg, lang)
+			setLastRefresh(&reg)
+			util.SetLanguage(w, lang)
+			if format != util.FORMAT_JSON {
+				writeRegistrations(w, format, []util.Registration{reg})
+				return
+			}
+
 			w.Header().Set("Content-Type", "application/json")
 			if err := json.NewEncoder(w).Encode(reg); err != nil {
 				http.Error(w, "Error encoding response JSON", http.StatusInternalServerError)
@@ -136,8 +312,42 @@ func HandleRegistrationGetRequest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// writeRegistrations writes registrations to the client as CSV or NDJSON. In CSV, each registration is a record with
+// one column per feature.
+func writeRegistrations(w http.ResponseWriter, format string, registrations []util.Registration) {
+	var err error
+	if format == util.FORMAT_NDJSON {
+		err = util.WriteNDJSON(w, registrations)
+	} else {
+		header := []string{"id", "name", "description", "labels", "country", "isoCode", "isoCodes", "temperature",
+			"precipitation", "capital", "coordinates", "population", "area", "languages", "timezones", "region",
+			"borders", "callingCodes", "flag", "drivingSide", "topLevelDomains", "targetCurrencies", "computed",
+			"snapshots", "lastChange", "lastRefresh"}
+
+		records := make([][]string, 0, len(registrations))
+		for _, reg := range registrations {
+			f := reg.Features
+			records = append(records, []string{reg.ID, reg.Name, reg.Description, joinMap(reg.Labels), reg.Country,
+				reg.IsoCode, util.JoinList(reg.IsoCodes),
+				strconv.FormatBool(f.Temperature), strconv.FormatBool(f.Precipitation), strconv.FormatBool(f.Capital),
+				strconv.FormatBool(f.Coordinates), strconv.FormatBool(f.Population), strconv.FormatBool(f.Area),
+				strconv.FormatBool(f.Languages), strconv.FormatBool(f.Timezones), strconv.FormatBool(f.Region),
+				strconv.FormatBool(f.Borders), strconv.FormatBool(f.CallingCodes), strconv.FormatBool(f.Flag),
+				strconv.FormatBool(f.DrivingSide), strconv.FormatBool(f.TopLevelDomains),
+				util.JoinList(f.TargetCurrencies), joinMap(f.Computed), reg.Snapshots, reg.LastChange,
+				reg.LastRefresh})
+		}
+		err = util.WriteCSV(w, header, records)
+	}
+
+	if err != nil {
+		log.Printf("Failed to write registrations as %v: %v\n", format, err)
+	}
+}
+
 // HandleRegistrationPutRequest updates a dashboard by given ID. Decodes body into
-// Registration struct, updates the document and updates lastChange to current.
+// Registration struct, updates the document and updates lastChange to current. The body may be a registration as it
+// is returned by GET: 'id', 'lastChange' and 'lastRefresh' are ignored, since they are set by the service.
 func HandleRegistrationPutRequest(w http.ResponseWriter, r *http.Request) {
 	//Get ID from URL
 	id, _ := util.GetIdFromUrl(r.URL.Path)
@@ -146,10 +356,15 @@ func HandleRegistrationPutRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//Decode the request body into a Registration struct (excluding ID and lastChange)
-	var registration util.Registration
-	if err := json.NewDecoder(r.Body).Decode(&registration); err != nil {
-		http.Error(w, "Error, could not decode body", http.StatusBadRequest)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error, could not read body", http.StatusBadRequest)
+		return
+	}
+
+	//Decode the request body into a Registration struct (ignoring ID and lastChange), and validate it
+	registration, ok := decodeRegistration(w, r, bytes.NewReader(withoutServerFields(body)))
+	if !ok {
 		return
 	}
 
@@ -157,10 +372,10 @@ func HandleRegistrationPutRequest(w http.ResponseWriter, r *http.Request) {
 
 	//Change the timestamp to last changed
 	registration.LastChange = time.Now().Format("2006-01-02 15:04")
+	registration.LastRefresh = ""
 
 	// Update registration on the database
-	// Update registration on the database
-	err := database.UpdateRegistration(registration)
+	err = database.UpdateRegistration(registration)
 	if err != nil {
 		if err.Error() == "registration not found by ID" {
 			http.Error(w, err.Error(), http.StatusNotFound)
@@ -171,9 +386,7 @@ func HandleRegistrationPutRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Invoke notification event for changing a registration
-	if err := notifications.InvokeEvent(registration.IsoCode, util.EVENT_CHANGE); err != nil {
-		log.Println("Error invoking event:", err)
-	}
+	invokeRegistrationEvent(registration, util.EVENT_CHANGE)
 
 }
 
@@ -194,24 +407,33 @@ func HandleRegistrationDeleteRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//Apply ISO so it can be invoked
-	isoCode := existingRegistration.IsoCode
-	if err := notifications.InvokeEvent(isoCode, util.EVENT_DELETE); err != nil {
-		log.Println("Error invoking event:", err)
-	}
-
 	//Delete specified document from firestore
 	err = database.DeleteDashboardById(id)
 	if err != nil {
 		log.Println(err)
+	} else {
+		// Revoke the share links of the registration, so they do not work for a registration with the same ID
+		if err := database.DeleteSharesOfRegistration(id); err != nil {
+			log.Printf("Error revoking shares of registration %v: %v\n", id, err)
+		}
+		// Invoked after deleting, so listeners that read the registration see that it is gone
+		invokeRegistrationEvent(existingRegistration, util.EVENT_DELETE)
 	}
 
 	//204 No content status
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// HandleRegistrationPatchRequest applies partial updates to document by given ID.
-// Uses a map to only update the fields given in request body (unlike PUT where you give all fields).
+// HandleRegistrationPatchRequest applies a patch to a registration by given ID. The patch is applied to the stored
+// registration, and the result is validated the same way as a new registration before it replaces the stored one.
+//
+// The patch format is chosen by the Content-Type:
+// - application/merge-patch+json (or application/json): a JSON Merge Patch (RFC 7396). See util.ApplyMergePatch.
+// - application/json-patch+json: a JSON Patch (RFC 6902). See util.ApplyJSONPatch.
+//
+// A patch that only changes the ISO code or the name of the country replaces the country. See clearReplacedCountry.
+//
+// Responds with the patched registration.
 func HandleRegistrationPatchRequest(w http.ResponseWriter, r *http.Request) {
 	//Get ID from URL
 	id, _ := util.GetIdFromUrl(r.URL.Path)
@@ -220,29 +442,325 @@ func HandleRegistrationPatchRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//Map to hold new data from body
-	var patchData map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&patchData); err != nil {
-		http.Error(w, "Error, could not decode body", http.StatusBadRequest)
+	//Choose how to apply the patch
+	var applyPatch func(document []byte, patch []byte) ([]byte, error)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get(util.CONTENT_TYPE))
+	switch mediaType {
+	case "", util.MIMETYPE_JSON, util.MIMETYPE_MERGE_PATCH:
+		applyPatch = util.ApplyMergePatch
+	case util.MIMETYPE_JSON_PATCH:
+		applyPatch = util.ApplyJSONPatch
+	default:
+		w.Header().Set(util.ACCEPT_PATCH, util.MIMETYPE_MERGE_PATCH+", "+util.MIMETYPE_JSON_PATCH)
+		util.HttpError(w, "the patch must be "+util.MIMETYPE_MERGE_PATCH+" or "+util.MIMETYPE_JSON_PATCH,
+			http.StatusUnsupportedMediaType)
+		return
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error, could not read body", http.StatusBadRequest)
 		return
 	}
 
-	//Get ISO code from registration
 	existingRegistration, err := database.GetSingleRegistrationByID(id)
 	if err != nil {
 		http.Error(w, "Error: could not find specified ID to patch", http.StatusNotFound)
 		return
 	}
 
-	//Apply ISO so it can be invoked
-	isoCode := existingRegistration.IsoCode
-	if err := notifications.InvokeEvent(isoCode, util.EVENT_CHANGE); err != nil {
-		log.Println("Error invoking event:", err)
+	//Patch the registration as the client sees it, without the fields that are set by the service
+	document, err := registrationDocument(existingRegistration)
+	if err != nil {
+		http.Error(w, "Error, could not patch", http.StatusInternalServerError)
+		return
+	}
+	patched, err := applyPatch(document, patch)
+	switch {
+	case errors.Is(err, util.ErrInvalidPatch):
+		util.HttpError(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, util.ErrPatchConflict):
+		util.HttpError(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Error, could not patch", http.StatusInternalServerError)
+		return
+	}
+
+	//The patched registration must be as valid as a new one
+	registration, err := util.DecodeRegistration(bytes.NewReader(patched))
+	var errs util.ValidationError
+	if errors.As(err, &errs) {
+		util.HttpValidationError(w, "the patched registration is invalid", errs)
+		return
+	}
+	if err != nil {
+		util.HttpError(w, "the patched registration must be a JSON object", http.StatusUnprocessableEntity)
+		return
+	}
+	clearReplacedCountry(&registration, existingRegistration)
+	if !validateRegistration(w, r, &registration) {
+		return
 	}
 
-	//Update specified dashboard in firestore
-	if err := database.PatchDashboardByID(id, patchData); err != nil {
+	registration.ID = id
+	registration.LastChange = time.Now().Format("2006-01-02 15:04")
+	registration.LastRefresh = ""
+
+	//Replace the registration, in Firestore or the stub database
+	if err := database.UpdateRegistration(registration); err != nil {
 		http.Error(w, "Error, could not patch", http.StatusInternalServerError)
 		return
 	}
+
+	// Invoked after patching, so listeners that read the registration see the change
+	invokeRegistrationEvent(registration, util.EVENT_CHANGE)
+
+	w.Header().Set(util.CONTENT_TYPE, util.MIMETYPE_JSON)
+	if err := json.NewEncoder(w).Encode(registration); err != nil {
+		log.Printf("Error writing response: %v\n", err)
+	}
+}
+
+// clearReplacedCountry clears the country name of a patched registration if only its ISO code was changed, and the
+// ISO code if only the name was changed. A new country replaces the old one as a whole, like in
+// overrideRegistration, so patching Norway with the ISO code SE gives Sweden instead of an inconsistent country.
+// Comparison registrations keep their name, as it names the group of countries.
+func clearReplacedCountry(patched *util.Registration, existing util.Registration) {
+	if patched.IsComparison() {
+		return
+	}
+
+	isoCodeChanged := patched.IsoCode != "" && !strings.EqualFold(patched.IsoCode, existing.IsoCode)
+	countryChanged := patched.Country != "" && patched.Country != existing.Country
+	switch {
+	case isoCodeChanged && patched.Country == existing.Country:
+		patched.Country = ""
+	case countryChanged && strings.EqualFold(patched.IsoCode, existing.IsoCode):
+		patched.IsoCode = ""
+	}
+}
+
+// serverFields are the fields of a registration that are set by the service, and can't be changed by clients.
+var serverFields = []string{"id", "lastChange", "lastRefresh"}
+
+// registrationDocument encodes a registration as a JSON object without 'id', 'lastChange' and 'lastRefresh', which are
+// set by the service.
+func registrationDocument(registration util.Registration) ([]byte, error) {
+	encoded, err := json.Marshal(registration)
+	if err != nil {
+		return nil, err
+	}
+
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &document); err != nil {
+		return nil, err
+	}
+	for _, field := range serverFields {
+		delete(document, field)
+	}
+
+	return json.Marshal(document)
+}
+
+// withoutServerFields removes 'id', 'lastChange' and 'lastRefresh' from a registration in a request body, so a
+// registration that was retrieved can be sent back. A body that is not a JSON object is returned as it is, and is
+// refused when it is decoded.
+func withoutServerFields(body []byte) []byte {
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(body, &document); err != nil || document == nil {
+		return body
+	}
+	for _, field := range serverFields {
+		delete(document, field)
+	}
+
+	stripped, err := json.Marshal(document)
+	if err != nil {
+		return body
+	}
+	return stripped
+}
+
+// decodeRegistration strictly decodes and validates the registration in a body, and checks its country against
+// REST Countries (see normalizeRegistrationCountry). If the registration is invalid, the error is written to the
+// client:
+// - 400 Bad Request if the body is not a JSON object.
+// - 422 Unprocessable Entity with every invalid field, if fields are unknown, of the wrong type or invalid.
+// - 502 Bad Gateway, 503 Service Unavailable or 504 Gateway Timeout if REST Countries failed.
+//
+// Returns:
+// - The registration, and whether it is valid.
+func decodeRegistration(w http.ResponseWriter, r *http.Request, body io.Reader) (util.Registration, bool) {
+	registration, err := util.DecodeRegistration(body)
+	var errs util.ValidationError
+	if errors.As(err, &errs) {
+		util.HttpValidationError(w, "the registration is invalid", errs)
+		return registration, false
+	}
+	if err != nil {
+		util.HttpError(w, "could not parse body. "+err.Error(), http.StatusBadRequest)
+		return registration, false
+	}
+
+	return registration, validateRegistration(w, r, &registration)
+}
+
+// validateRegistration validates a decoded registration, and checks its country against REST Countries (see
+// normalizeRegistrationCountry). If the registration is invalid, the error is written to the client the same way as
+// by decodeRegistration.
+//
+// Returns:
+// - Whether the registration is valid.
+func validateRegistration(w http.ResponseWriter, r *http.Request, registration *util.Registration) bool {
+	errs := util.ValidateRegistration(registration)
+	if err := dashboards.ValidateComputed(registration.Features); err != nil {
+		errs = append(errs, util.FieldError{Field: "features.computed", Reason: err.Error()})
+	}
+	if len(errs) > 0 {
+		util.HttpValidationError(w, "the registration is invalid", errs)
+		return false
+	}
+
+	//Checks the country against REST Countries, and fills in a missing name or ISO code
+	if status, err := normalizeRegistrationCountry(r.Context(), registration); err != nil {
+		if status == http.StatusUnprocessableEntity {
+			util.HttpValidationError(w, "the registration is invalid",
+				util.ValidationError{{Field: countryField(*registration, err), Reason: err.Error()}})
+			return false
+		}
+		setRetryAfter(w, err)
+		http.Error(w, "Error, "+err.Error(), status)
+		return false
+	}
+
+	return true
+}
+
+// countryField names the field of a registration that an error from normalizeRegistrationCountry is about.
+func countryField(registration util.Registration, err error) string {
+	switch {
+	case registration.IsComparison():
+		return "isoCodes"
+	case errors.Is(err, dashboards.ErrInconsistentCountry) || registration.IsoCode == "":
+		return "country"
+	default:
+		return "isoCode"
+	}
+}
+
+// setLastRefresh sets when the upstream data of a registration was last refreshed in the background, if it has been.
+// See dashboards.WarmRegistrations.
+func setLastRefresh(registration *util.Registration) {
+	if refreshed, ok := dashboards.LastRefresh(registration.ID); ok {
+		registration.LastRefresh = refreshed.Format("2006-01-02 15:04")
+	}
+}
+
+// localizeRegistration translates the country name of a registration to a language. Comparison registrations keep
+// their name, as it names the group of countries. A name that can't be translated is left as it is stored.
+func localizeRegistration(ctx context.Context, registration *util.Registration, lang string) {
+	// Registrations are stored with the English common name
+	if lang == util.LANGUAGE_DEFAULT || registration.IsComparison() || registration.IsoCode == "" {
+		return
+	}
+
+	name, err := dashboards.LocalizeCountry(ctx, registration.IsoCode, lang)
+	if err != nil {
+		log.Printf("Failed to translate the country of %v: %v\n", registration.ID, err)
+		return
+	}
+	registration.Country = name
+}
+
+// joinMap joins the members of a map, like the computed features or the labels of a registration, into a single CSV
+// field. Each member is written as name=value, sorted by name.
+func joinMap(members map[string]string) string {
+	values := make([]string, 0, len(members))
+	for name, value := range members {
+		values = append(values, name+"="+value)
+	}
+	sort.Strings(values)
+	return util.JoinList(values)
+}
+
+// invokeRegistrationEvent invokes an event for the countries of a registration. Notifications filtered on any of the
+// countries of a comparison registration are sent the event, and every notification is only sent it once. See
+// notifications.InvokeEventForCountries.
+func invokeRegistrationEvent(registration util.Registration, event string) {
+	if err := notifications.InvokeEventForCountries(registration.AllIsoCodes(), event); err != nil {
+		log.Println("Error invoking event:", err)
+	}
+}
+
+// normalizeRegistrationCountry checks the country of a registration against REST Countries (or the Stub service).
+// A missing ISO code is filled in from the country's name, and a missing name from the ISO code. The name and ISO code
+// are normalized to the country's common name and its two-letter ISO code. Every ISO code of a comparison
+// registration is checked and normalized too.
+//
+// Returns:
+// - 422 Unprocessable Entity and an error if the country is unknown, or the name and the ISO code do not match.
+// - 502 Bad Gateway and an error if REST Countries could not be reached.
+func normalizeRegistrationCountry(ctx context.Context, registration *util.Registration) (int, error) {
+	if registration.IsComparison() {
+		for i, isoCode := range registration.IsoCodes {
+			country, err := dashboards.ResolveCountry(ctx, "", isoCode)
+			if err != nil {
+				return countryErrorStatus(err), err
+			}
+			registration.IsoCodes[i] = country.Cca2
+		}
+		return http.StatusOK, nil
+	}
+
+	country, err := dashboards.ResolveCountry(ctx, registration.Country, registration.IsoCode)
+	if err != nil {
+		return countryErrorStatus(err), err
+	}
+	registration.Country = country.Name.Common
+	registration.IsoCode = country.Cca2
+
+	return http.StatusOK, nil
+}
+
+// countryErrorStatus maps an error from dashboards.ResolveCountry to a HTTP status code.
+func countryErrorStatus(err error) int {
+	if errors.Is(err, dashboards.ErrUnknownCountry) || errors.Is(err, dashboards.ErrInconsistentCountry) {
+		return http.StatusUnprocessableEntity
+	}
+	log.Println("Unable to validate country:", err)
+	return upstreamErrorStatus(err, http.StatusBadGateway)
+}
+
+// upstreamErrorStatus maps an error from an upstream service to a HTTP status code. See package upstream.
+//
+// Returns:
+// - 503 Service Unavailable if the service's circuit breaker is open, or its host's rate limit is used up. See
+// setRetryAfter.
+// - 504 Gateway Timeout if the service did not respond in time.
+// - 502 Bad Gateway if the service could not be reached, failed, or returned an invalid response.
+// - notFound if the service did not find the resource, or if the error is not from an upstream service.
+func upstreamErrorStatus(err error, notFound int) int {
+	var upstreamErr *upstream.Error
+	switch {
+	case !errors.As(err, &upstreamErr), errors.Is(err, upstream.ErrNotFound):
+		return notFound
+	case errors.Is(err, upstream.ErrCircuitOpen), errors.Is(err, upstream.ErrRateLimited):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, upstream.ErrTimeout):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// setRetryAfter sets the Retry-After header to the whole seconds an upstream error says to wait, if it says so.
+// It must be called before the status code is written.
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var upstreamErr *upstream.Error
+	if errors.As(err, &upstreamErr) && upstreamErr.RetryAfter > 0 {
+		seconds := int(math.Ceil(upstreamErr.RetryAfter.Seconds()))
+		w.Header().Set(util.RETRY_AFTER, strconv.Itoa(seconds))
+	}
 }
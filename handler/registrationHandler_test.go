@@ -2,6 +2,8 @@ package handler_test
 
 import (
 	"assignment2/handler"
+	"assignment2/models"
+	"assignment2/notifications"
 	stubs "assignment2/stubs/handler"
 	"assignment2/util"
 	"bytes"
@@ -46,6 +48,9 @@ func populateRegistrationFile() error {
 func TestRegistrationPostHandler(t *testing.T) {
 	util.FixStubPaths()
 
+	//Countries are validated against the REST Countries stub
+	defer startStubServices()()
+
 	//Enable database stub
 	util.Config.Stubs.Database = true
 	stubServer := httptest.NewServer(http.HandlerFunc(stubs.DatabaseDashboardHandler))
@@ -235,14 +240,9 @@ func TestRegistrationGetHandlerSpecified(t *testing.T) {
 func TestRegistrationDeleteHandler(t *testing.T) {
 	util.FixStubPaths()
 
-	//Enable database stub
+	//Enable database stub, with the shares that are revoked when deleting
 	util.Config.Stubs.Database = true
-	stubServer := httptest.NewServer(http.HandlerFunc(stubs.DatabaseDashboardHandler))
-	defer stubServer.Close()
-
-	port := strings.Split(stubServer.URL, ":")
-	portNum := port[len(port)-1]
-	util.DatabaseStubPort = portNum
+	defer startStubDatabase()()
 
 	//Test HTTP server setup with route to RegistrationHandler
 	server := httptest.NewServer(http.HandlerFunc(handler.RegistrationHandler))
@@ -284,6 +284,7 @@ func TestRegistrationDeleteHandler(t *testing.T) {
 // 2. Appropriate responses when met with an invalid ID.
 // 3. Successfully updating when given valid data changes.
 // 4. Appropriate error when a request is sent containing an invalid body.
+// 5. A registration retrieved with GET can be sent back unchanged, as the fields set by the service are ignored.
 //
 // Upon a successful update containing a valid ID & JSON input 200 (OK) is returned, if the ID
 // is unrecognized 404 (not found) is returned and for bad JSON 400 (bad request is returned with
@@ -291,6 +292,9 @@ func TestRegistrationDeleteHandler(t *testing.T) {
 func TestRegistrationPutHandler(t *testing.T) {
 	util.FixStubPaths()
 
+	//Countries are validated against the REST Countries stub
+	defer startStubServices()()
+
 	if err := populateRegistrationFile(); err != nil {
 		t.Fatalf("Failed to populate the test data. %v\n", err)
 	}
@@ -322,7 +326,7 @@ func TestRegistrationPutHandler(t *testing.T) {
 			Coordinates:      false,
 			Population:       false,
 			Area:             false,
-			TargetCurrencies: []string{"NOK", "SWE"},
+			TargetCurrencies: []string{"NOK", "SEK"},
 		},
 	}
 
@@ -337,6 +341,41 @@ func TestRegistrationPutHandler(t *testing.T) {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, status)
 	}
 
+	//Send the registration back as it was retrieved, with its ID and lastChange
+	request = httptest.NewRequest(http.MethodGet, util.REGISTRATION_PATH+testID, nil)
+	responseRecorder = httptest.NewRecorder()
+	handler.RegistrationHandler(responseRecorder, request)
+	retrieved := responseRecorder.Body.Bytes()
+	if !bytes.Contains(retrieved, []byte(`"lastChange"`)) {
+		t.Fatalf("Expected the retrieved registration to have lastChange, got %s", retrieved)
+	}
+	request = httptest.NewRequest(http.MethodPut, util.REGISTRATION_PATH+testID, bytes.NewReader(retrieved))
+	responseRecorder = httptest.NewRecorder()
+	handler.RegistrationHandler(responseRecorder, request)
+	if status := responseRecorder.Code; status != http.StatusOK {
+		t.Errorf("Expected status code %d for a retrieved registration, got %d: %v", http.StatusOK, status,
+			responseRecorder.Body.String())
+	}
+
+	//An ID in the body does not change the ID in the URL
+	request = httptest.NewRequest(http.MethodPut, util.REGISTRATION_PATH+testID,
+		strings.NewReader(`{"id": "2", "isoCode": "SE", "lastChange": "yesterday"}`))
+	responseRecorder = httptest.NewRecorder()
+	handler.RegistrationHandler(responseRecorder, request)
+	if status := responseRecorder.Code; status != http.StatusOK {
+		t.Errorf("Expected status code %d for a body with an ID, got %d", http.StatusOK, status)
+	}
+	request = httptest.NewRequest(http.MethodGet, util.REGISTRATION_PATH+testID, nil)
+	responseRecorder = httptest.NewRecorder()
+	handler.RegistrationHandler(responseRecorder, request)
+	var stored util.Registration
+	if err := json.Unmarshal(responseRecorder.Body.Bytes(), &stored); err != nil {
+		t.Fatal("Could not decode the registration:", err)
+	}
+	if stored.ID != testID || stored.Country != "Sweden" || stored.LastChange == "yesterday" {
+		t.Errorf("Expected registration %v to be replaced by Sweden, got %+v", testID, stored)
+	}
+
 	//*******INVALID TESTING*******
 	//Invalid ID
 	badID := "random123" //Unregistered ID
@@ -361,3 +400,490 @@ func TestRegistrationPutHandler(t *testing.T) {
 		t.Errorf("Expected status code %d for invalid JSON, got %d", http.StatusBadRequest, status)
 	}
 }
+
+// TestRegistrationCountryValidation tests that the country of a registration is checked against REST Countries.
+// It verifies:
+// 1. A missing ISO code is filled in from the country's name, and the name is normalized.
+// 2. A missing country name is filled in from the ISO code.
+// 3. Unknown countries, unknown ISO codes and inconsistent pairs return 422 (unprocessable entity).
+func TestRegistrationCountryValidation(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	if err := populateRegistrationFile(); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	//Enable database stub
+	stubServer := httptest.NewServer(http.HandlerFunc(stubs.DatabaseDashboardHandler))
+	defer stubServer.Close()
+	util.DatabaseStubPort = portOf(stubServer.URL)
+
+	//*******VALID TESTING*******
+	valid := []struct {
+		input           util.Registration
+		expectedCountry string
+		expectedIsoCode string
+	}{
+		{util.Registration{Country: "sweden"}, "Sweden", "SE"},
+		{util.Registration{IsoCode: "dk"}, "Denmark", "DK"},
+		{util.Registration{Country: "Republic of Finland", IsoCode: "FIN"}, "Finland", "FI"},
+	}
+	for _, test := range valid {
+		body, _ := json.Marshal(test.input)
+		request := httptest.NewRequest(http.MethodPost, util.REGISTRATION_PATH, bytes.NewBuffer(body))
+		responseRecorder := httptest.NewRecorder()
+		handler.RegistrationHandler(responseRecorder, request)
+
+		if responseRecorder.Code != http.StatusCreated {
+			t.Errorf("Expected status code %d for %v, got %d", http.StatusCreated, test.input, responseRecorder.Code)
+			continue
+		}
+
+		//Read back the stored registration
+		var result map[string]string
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), &result); err != nil {
+			t.Fatal("Could not decode response:", err)
+		}
+		request = httptest.NewRequest(http.MethodGet, util.REGISTRATION_PATH+result["id"], nil)
+		responseRecorder = httptest.NewRecorder()
+		handler.RegistrationHandler(responseRecorder, request)
+
+		var stored util.Registration
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), &stored); err != nil {
+			t.Fatal("Could not decode the stored registration:", err)
+		}
+		if stored.Country != test.expectedCountry || stored.IsoCode != test.expectedIsoCode {
+			t.Errorf("Expected %v/%v, got %v/%v", test.expectedCountry, test.expectedIsoCode, stored.Country, stored.IsoCode)
+		}
+	}
+
+	//*******INVALID TESTING*******
+	invalid := []util.Registration{
+		{Country: "Norwy"},
+		{IsoCode: "XX"},
+		{Country: "Norway", IsoCode: "SE"},
+		{},
+		{IsoCodes: []string{"NO", "XX"}},
+	}
+	for _, input := range invalid {
+		body, _ := json.Marshal(input)
+		request := httptest.NewRequest(http.MethodPost, util.REGISTRATION_PATH, bytes.NewBuffer(body))
+		responseRecorder := httptest.NewRecorder()
+		handler.RegistrationHandler(responseRecorder, request)
+
+		if responseRecorder.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status code %d for %v, got %d", http.StatusUnprocessableEntity, input, responseRecorder.Code)
+		}
+	}
+
+	//Updates are validated too
+	body, _ := json.Marshal(util.Registration{Country: "Norwy", IsoCode: "NO"})
+	request := httptest.NewRequest(http.MethodPut, util.REGISTRATION_PATH+"1", bytes.NewBuffer(body))
+	responseRecorder := httptest.NewRecorder()
+	handler.RegistrationHandler(responseRecorder, request)
+
+	if responseRecorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code %d for an invalid update, got %d", http.StatusUnprocessableEntity, responseRecorder.Code)
+	}
+}
+
+// TestRegistrationStrictValidation tests that registrations are decoded strictly, and that every invalid field is
+// listed in the response.
+// It verifies:
+// 1. Unknown fields, fields in the wrong case and fields of the wrong type return 422 (unprocessable entity).
+// 2. A client-supplied ID, a missing country, blank names and invalid currencies return 422 with one error per field.
+// 3. Target currencies in lower case are accepted and stored in upper case.
+// 4. A body that is not a JSON object returns 400 (bad request).
+func TestRegistrationStrictValidation(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	if err := populateRegistrationFile(); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	//Enable database stub
+	stubServer := httptest.NewServer(http.HandlerFunc(stubs.DatabaseDashboardHandler))
+	defer stubServer.Close()
+	util.DatabaseStubPort = portOf(stubServer.URL)
+
+	//*******INVALID TESTING*******
+	invalid := []struct {
+		body           string
+		expectedFields []string
+	}{
+		{`{"isoCode": "NO", "colour": "red"}`, []string{"colour"}},
+		{`{"Country": "Norway"}`, []string{"Country"}},
+		{`{"isoCode": "NO", "features": {"area": "yes", "wind": true}}`, []string{"features.area", "features.wind"}},
+		{`{"isoCode": "NO", "features": {"targetCurrencies": "EUR"}}`, []string{"features.targetCurrencies"}},
+		{`{"id": "123", "isoCode": "NO"}`, []string{"id"}},
+		{`{"features": {"area": true}}`, []string{"country"}},
+		{`{"country": "  ", "isoCode": "NO"}`, []string{"country"}},
+		{`{"isoCode": "Norway"}`, []string{"isoCode"}},
+		{`{"isoCode": "NO", "features": {"targetCurrencies": ["euro", "EUR", "eur"]}}`,
+			[]string{"features.targetCurrencies[0]", "features.targetCurrencies[2]"}},
+		{`{"isoCode": "NO", "isoCodes": ["SE", "D"], "snapshots": "weekly"}`, []string{"isoCode", "isoCodes[1]", "snapshots"}},
+		{`{"isoCode": "XX"}`, []string{"isoCode"}},
+	}
+	for _, test := range invalid {
+		request := httptest.NewRequest(http.MethodPost, util.REGISTRATION_PATH, strings.NewReader(test.body))
+		responseRecorder := httptest.NewRecorder()
+		handler.RegistrationHandler(responseRecorder, request)
+
+		if responseRecorder.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status code %d for %v, got %d", http.StatusUnprocessableEntity, test.body, responseRecorder.Code)
+			continue
+		}
+
+		var result struct {
+			Message string            `json:"message"`
+			Errors  []util.FieldError `json:"errors"`
+		}
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Could not decode the response for %v: %v", test.body, err)
+		}
+		var fields []string
+		for _, fieldErr := range result.Errors {
+			if fieldErr.Reason == "" {
+				t.Errorf("Expected a reason for the field %v of %v", fieldErr.Field, test.body)
+			}
+			fields = append(fields, fieldErr.Field)
+		}
+		if strings.Join(fields, ",") != strings.Join(test.expectedFields, ",") {
+			t.Errorf("Expected the invalid fields %v for %v, got %v", test.expectedFields, test.body, fields)
+		}
+	}
+
+	//Malformed JSON
+	for _, body := range []string{`{"isoCode": "NO"`, `"NO"`, `null`} {
+		request := httptest.NewRequest(http.MethodPost, util.REGISTRATION_PATH, strings.NewReader(body))
+		responseRecorder := httptest.NewRecorder()
+		handler.RegistrationHandler(responseRecorder, request)
+
+		if responseRecorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %v, got %d", http.StatusBadRequest, body, responseRecorder.Code)
+		}
+	}
+
+	//*******VALID TESTING*******
+	body := `{"isoCode": "NO", "features": {"targetCurrencies": ["eur", "usd"]}}`
+	request := httptest.NewRequest(http.MethodPost, util.REGISTRATION_PATH, strings.NewReader(body))
+	responseRecorder := httptest.NewRecorder()
+	handler.RegistrationHandler(responseRecorder, request)
+
+	if responseRecorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d for %v, got %d", http.StatusCreated, body, responseRecorder.Code)
+	}
+	var result map[string]string
+	if err := json.Unmarshal(responseRecorder.Body.Bytes(), &result); err != nil {
+		t.Fatal("Could not decode response:", err)
+	}
+
+	request = httptest.NewRequest(http.MethodGet, util.REGISTRATION_PATH+result["id"], nil)
+	responseRecorder = httptest.NewRecorder()
+	handler.RegistrationHandler(responseRecorder, request)
+
+	var stored util.Registration
+	if err := json.Unmarshal(responseRecorder.Body.Bytes(), &stored); err != nil {
+		t.Fatal("Could not decode the stored registration:", err)
+	}
+	if strings.Join(stored.Features.TargetCurrencies, ",") != "EUR,USD" {
+		t.Errorf("Expected the target currencies EUR,USD, got %v", stored.Features.TargetCurrencies)
+	}
+}
+
+// TestRegistrationPatchHandler tests the PATCH method with JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902), in
+// stub-database mode.
+// It verifies:
+// 1. A merge patch merges nested objects, so other features are kept, and null removes a member.
+// 2. A JSON patch adds, replaces, removes and tests values.
+// 3. The patched registration is validated, and invalid results return 422 (unprocessable entity) without storing them.
+// 4. Malformed patches return 400, patches that can't be applied 409, and other content types 415.
+// 5. A patch invokes a single CHANGE event, and a patch of only the ISO code or the name replaces the country.
+func TestRegistrationPatchHandler(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	if err := populateRegistrationFile(); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	//Enable database stub
+	stubServer := httptest.NewServer(http.HandlerFunc(stubs.DatabaseDashboardHandler))
+	defer stubServer.Close()
+	util.DatabaseStubPort = portOf(stubServer.URL)
+
+	events, unsubscribe := notifications.Subscribe(models.NotificationDatabaseModel{Event: util.EVENT_CHANGE})
+	defer unsubscribe()
+	changes := func() int {
+		for count := 0; ; count++ {
+			select {
+			case <-events:
+			default:
+				return count
+			}
+		}
+	}
+
+	patch := func(contentType string, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPatch, util.REGISTRATION_PATH+"1", strings.NewReader(body))
+		request.Header.Set(util.CONTENT_TYPE, contentType)
+		responseRecorder := httptest.NewRecorder()
+		handler.RegistrationHandler(responseRecorder, request)
+		return responseRecorder
+	}
+	stored := func() util.Registration {
+		request := httptest.NewRequest(http.MethodGet, util.REGISTRATION_PATH+"1", nil)
+		responseRecorder := httptest.NewRecorder()
+		handler.RegistrationHandler(responseRecorder, request)
+
+		var registration util.Registration
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), &registration); err != nil {
+			t.Fatal("Could not decode the stored registration:", err)
+		}
+		return registration
+	}
+
+	//*******MERGE PATCH*******
+	res := patch(util.MIMETYPE_MERGE_PATCH, `{"features": {"area": false, "languages": true}, "snapshots": "daily"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d for a merge patch, got %d: %v", http.StatusOK, res.Code, res.Body.String())
+	}
+	registration := stored()
+	if registration.Features.Area || !registration.Features.Languages || !registration.Features.Capital ||
+		registration.Snapshots != util.SCHEDULE_DAILY || registration.Country != "Norway" {
+		t.Errorf("The merge patch was not applied as expected: %+v", registration)
+	}
+	if registration.LastChange == "2024-04-10 14:09" {
+		t.Error("Expected the patch to update lastChange")
+	}
+	if count := changes(); count != 1 {
+		t.Errorf("Expected the patch to invoke 1 CHANGE event, got %d", count)
+	}
+
+	res = patch(util.MIMETYPE_MERGE_PATCH, `{"snapshots": null, "features": {"targetCurrencies": null}}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d for a merge patch with null, got %d", http.StatusOK, res.Code)
+	}
+	if registration = stored(); registration.Snapshots != "" || len(registration.Features.TargetCurrencies) != 0 {
+		t.Errorf("Expected null to remove the members, got %+v", registration)
+	}
+
+	//*******JSON PATCH*******
+	res = patch(util.MIMETYPE_JSON_PATCH, `[
+		{"op": "test", "path": "/isoCode", "value": "NO"},
+		{"op": "add", "path": "/features/targetCurrencies", "value": ["EUR"]},
+		{"op": "add", "path": "/features/targetCurrencies/-", "value": "usd"},
+		{"op": "add", "path": "/features/targetCurrencies/0", "value": "SEK"},
+		{"op": "replace", "path": "/features/temperature", "value": false},
+		{"op": "copy", "from": "/features/capital", "path": "/features/flag"}
+	]`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d for a JSON patch, got %d: %v", http.StatusOK, res.Code, res.Body.String())
+	}
+	var response util.Registration
+	if err := json.Unmarshal(res.Body.Bytes(), &response); err != nil {
+		t.Fatal("Could not decode the patched registration:", err)
+	}
+	registration = stored()
+	if strings.Join(registration.Features.TargetCurrencies, ",") != "SEK,EUR,USD" ||
+		registration.Features.Temperature || !registration.Features.Flag {
+		t.Errorf("The JSON patch was not applied as expected: %+v", registration)
+	}
+	if strings.Join(response.Features.TargetCurrencies, ",") != "SEK,EUR,USD" || response.ID != "1" {
+		t.Errorf("Expected the patched registration in the response, got %+v", response)
+	}
+
+	//*******INVALID TESTING*******
+	invalid := []struct {
+		contentType    string
+		body           string
+		expectedStatus int
+	}{
+		{util.MIMETYPE_MERGE_PATCH, `{"features": {"targetCurrencies": ["euro"]}}`, http.StatusUnprocessableEntity},
+		{util.MIMETYPE_MERGE_PATCH, `{"Features.Temperature": true}`, http.StatusUnprocessableEntity},
+		{util.MIMETYPE_MERGE_PATCH, `{"id": "2"}`, http.StatusUnprocessableEntity},
+		{util.MIMETYPE_MERGE_PATCH, `{"isoCode": "XX", "country": null}`, http.StatusUnprocessableEntity},
+		{util.MIMETYPE_MERGE_PATCH, `["NO"]`, http.StatusUnprocessableEntity},
+		{util.MIMETYPE_MERGE_PATCH, `{"features": `, http.StatusBadRequest},
+		{util.MIMETYPE_JSON_PATCH, `[{"op": "remove", "path": "/country"}, {"op": "remove", "path": "/isoCode"}]`,
+			http.StatusUnprocessableEntity},
+		{util.MIMETYPE_JSON_PATCH, `[{"op": "test", "path": "/isoCode", "value": "SE"}]`, http.StatusConflict},
+		{util.MIMETYPE_JSON_PATCH, `[{"op": "remove", "path": "/features/wind"}]`, http.StatusConflict},
+		{util.MIMETYPE_JSON_PATCH, `[{"op": "replace", "path": "/features/targetCurrencies/5", "value": "NOK"}]`,
+			http.StatusConflict},
+		{util.MIMETYPE_JSON_PATCH, `[{"op": "rename", "path": "/country"}]`, http.StatusBadRequest},
+		{util.MIMETYPE_JSON_PATCH, `{"op": "remove", "path": "/country"}`, http.StatusBadRequest},
+		{util.MIMETYPE_JSON_PATCH, `[{"op": "add", "path": "features"}]`, http.StatusBadRequest},
+		{util.MIMETYPE_PLAINTEXT, `country=Sweden`, http.StatusUnsupportedMediaType},
+	}
+	for _, test := range invalid {
+		res := patch(test.contentType, test.body)
+		if res.Code != test.expectedStatus {
+			t.Errorf("Expected status code %d for %v, got %d", test.expectedStatus, test.body, res.Code)
+		}
+	}
+	if res := patch(util.MIMETYPE_PLAINTEXT, ""); res.Header().Get(util.ACCEPT_PATCH) == "" {
+		t.Error("Expected the Accept-Patch header for an unsupported content type")
+	}
+
+	//Nothing invalid was stored
+	if after := stored(); strings.Join(after.Features.TargetCurrencies, ",") != "SEK,EUR,USD" || after.IsoCode != "NO" {
+		t.Errorf("Expected invalid patches not to be stored, got %+v", after)
+	}
+
+	//*******NEW COUNTRY*******
+	//Only the ISO code or the name is patched, and the country is replaced as a whole
+	for _, test := range []struct{ body, country, isoCode string }{
+		{`{"isoCode": "se"}`, "Sweden", "SE"},
+		{`{"country": "Norway"}`, "Norway", "NO"},
+	} {
+		if res := patch(util.MIMETYPE_MERGE_PATCH, test.body); res.Code != http.StatusOK {
+			t.Errorf("Expected status code %d for %v, got %d: %v", http.StatusOK, test.body, res.Code,
+				res.Body.String())
+		}
+		if after := stored(); after.Country != test.country || after.IsoCode != test.isoCode {
+			t.Errorf("Expected %v to give %v (%v), got %+v", test.body, test.country, test.isoCode, after)
+		}
+	}
+
+	//Unknown registrations
+	request := httptest.NewRequest(http.MethodPatch, util.REGISTRATION_PATH+"404", strings.NewReader(`{}`))
+	request.Header.Set(util.CONTENT_TYPE, util.MIMETYPE_MERGE_PATCH)
+	responseRecorder := httptest.NewRecorder()
+	handler.RegistrationHandler(responseRecorder, request)
+	if responseRecorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for an unknown registration, got %d", http.StatusNotFound, responseRecorder.Code)
+	}
+}
+
+// TestRegistrationLabels tests names, descriptions and labels of registrations, and searching for them.
+// It verifies:
+// 1. Names, descriptions and labels are stored, and invalid ones return 422 (unprocessable entity).
+// 2. Listings are filtered by label selectors and by free text in the name and description.
+// 3. A search that matches nothing returns an empty list, and invalid selectors return 400 (bad request).
+func TestRegistrationLabels(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	registrations := []util.Registration{
+		{ID: "1", Name: "Finance Nordics", Description: "Exchange rates for the Oslo office", Country: "Norway",
+			IsoCode: "NO", Labels: map[string]string{"team": "finance", "env": "prod"}},
+		{ID: "2", Name: "Weather Sweden", Description: "Forecasts for the Stockholm office", Country: "Sweden",
+			IsoCode: "SE", Labels: map[string]string{"team": "weather", "env": "test"}},
+		{ID: "3", Country: "Denmark", IsoCode: "DK"},
+	}
+	if err := util.PopulateTestFile(util.STUB_DATABASE_REGISTRATIONS, registrations); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	//Enable database stub
+	stubServer := httptest.NewServer(http.HandlerFunc(stubs.DatabaseDashboardHandler))
+	defer stubServer.Close()
+	util.DatabaseStubPort = portOf(stubServer.URL)
+
+	//*******SEARCH*******
+	searches := []struct {
+		query       string
+		expectedIDs string
+	}{
+		{"", "1,2,3"},
+		{"?label=team=finance", "1"},
+		{"?label=team==finance", "1"},
+		{"?label=team!=finance", "2,3"},
+		{"?label=team", "1,2"},
+		{"?label=!team", "3"},
+		{"?label=team,env=test", "2"},
+		{"?label=team&label=env=prod", "1"},
+		{"?q=office", "1,2"},
+		{"?q=OSLO+fin", "1"},
+		{"?q=stockholm&label=team=finance", ""},
+		{"?q=bergen", ""},
+	}
+	for _, test := range searches {
+		request := httptest.NewRequest(http.MethodGet, util.REGISTRATION_PATH+test.query, nil)
+		responseRecorder := httptest.NewRecorder()
+		handler.RegistrationHandler(responseRecorder, request)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Errorf("Expected status code %d for %v, got %d", http.StatusOK, test.query, responseRecorder.Code)
+			continue
+		}
+		var found []util.Registration
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), &found); err != nil {
+			t.Fatalf("Could not decode the registrations for %v: %v", test.query, err)
+		}
+		var ids []string
+		for _, registration := range found {
+			ids = append(ids, registration.ID)
+		}
+		if strings.Join(ids, ",") != test.expectedIDs {
+			t.Errorf("Expected the registrations %v for %v, got %v", test.expectedIDs, test.query, ids)
+		}
+	}
+
+	for _, query := range []string{"?label=", "?label=team=fin%20ance", "?label=-team"} {
+		request := httptest.NewRequest(http.MethodGet, util.REGISTRATION_PATH+query, nil)
+		responseRecorder := httptest.NewRecorder()
+		handler.RegistrationHandler(responseRecorder, request)
+
+		if responseRecorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %v, got %d", http.StatusBadRequest, query, responseRecorder.Code)
+		}
+	}
+
+	//*******VALIDATION*******
+	body := `{"isoCode": "FI", "name": "  Finland  ", "description": "Helsinki", "labels": {"team": "finance", "tier": ""}}`
+	request := httptest.NewRequest(http.MethodPost, util.REGISTRATION_PATH, strings.NewReader(body))
+	responseRecorder := httptest.NewRecorder()
+	handler.RegistrationHandler(responseRecorder, request)
+	if responseRecorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d for %v, got %d", http.StatusCreated, body, responseRecorder.Code)
+	}
+
+	request = httptest.NewRequest(http.MethodGet, util.REGISTRATION_PATH+"?label=tier&q=helsinki", nil)
+	responseRecorder = httptest.NewRecorder()
+	handler.RegistrationHandler(responseRecorder, request)
+	var found []util.Registration
+	if err := json.Unmarshal(responseRecorder.Body.Bytes(), &found); err != nil {
+		t.Fatal("Could not decode the registrations:", err)
+	}
+	if len(found) != 1 || found[0].Name != "Finland" || found[0].Labels["team"] != "finance" {
+		t.Errorf("Expected the new registration to be found with its name and labels, got %+v", found)
+	}
+
+	invalid := []struct {
+		body           string
+		expectedFields []string
+	}{
+		{`{"isoCode": "FI", "name": "   "}`, []string{"name"}},
+		{`{"isoCode": "FI", "name": "` + strings.Repeat("n", util.MAX_NAME_LENGTH+1) + `"}`, []string{"name"}},
+		{`{"isoCode": "FI", "labels": {"-team": "finance", "env": "prod!", "ok": "yes"}}`,
+			[]string{"labels.-team", "labels.env"}},
+		{`{"isoCode": "FI", "labels": {"team": 1}}`, []string{"labels"}},
+	}
+	for _, test := range invalid {
+		request := httptest.NewRequest(http.MethodPost, util.REGISTRATION_PATH, strings.NewReader(test.body))
+		responseRecorder := httptest.NewRecorder()
+		handler.RegistrationHandler(responseRecorder, request)
+
+		if responseRecorder.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status code %d for %v, got %d", http.StatusUnprocessableEntity, test.body, responseRecorder.Code)
+			continue
+		}
+		var result struct {
+			Errors []util.FieldError `json:"errors"`
+		}
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Could not decode the response for %v: %v", test.body, err)
+		}
+		var fields []string
+		for _, fieldErr := range result.Errors {
+			fields = append(fields, fieldErr.Field)
+		}
+		if strings.Join(fields, ",") != strings.Join(test.expectedFields, ",") {
+			t.Errorf("Expected the invalid fields %v for %v, got %v", test.expectedFields, test.body, fields)
+		}
+	}
+}
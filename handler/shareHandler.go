@@ -0,0 +1,277 @@
+package handler
+
+import (
+	"assignment2/crypto"
+	"assignment2/database"
+	"assignment2/util"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the times share links are valid, used if config.yaml does not say otherwise.
+const (
+	DEFAULT_SHARE_TTL     = 7 * 24 * time.Hour
+	DEFAULT_SHARE_MAX_TTL = 30 * 24 * time.Hour
+)
+
+// shareKey is the key that signs share tokens. See getShareKey.
+var (
+	shareKey     []byte
+	shareKeyOnce sync.Once
+)
+
+// getShareKey returns the key that signs share tokens. The key is 'share_key' in config.yaml. If it is not set, a
+// random key is generated once, and share links stop working when the service restarts.
+func getShareKey() []byte {
+	shareKeyOnce.Do(func() {
+		if util.Config.Secrets.ShareKey != "" {
+			shareKey = []byte(util.Config.Secrets.ShareKey)
+			return
+		}
+
+		log.Println("No share_key is configured. Share links are signed with a random key, and stop working when the " +
+			"service restarts")
+		key, err := myCrypto.RandomKey()
+		if err != nil {
+			log.Fatalf("Failed to generate a key for share links: %v", err)
+		}
+		shareKey = key
+	})
+	return shareKey
+}
+
+// shareTTL returns how long share links are valid, unless another time is asked for.
+func shareTTL() time.Duration {
+	if util.Config.Shares.DefaultTTL > 0 {
+		return min(util.Config.Shares.DefaultTTL, shareMaxTTL())
+	}
+	return min(DEFAULT_SHARE_TTL, shareMaxTTL())
+}
+
+// shareMaxTTL returns the longest time a share link may be valid.
+func shareMaxTTL() time.Duration {
+	if util.Config.Shares.MaxTTL > 0 {
+		return util.Config.Shares.MaxTTL
+	}
+	return DEFAULT_SHARE_MAX_TTL
+}
+
+// handleRegistrationSharesRequest handles the share links of a registration, on {id}/shares.
+// A share link renders the registration's dashboard to anyone that has it, without access to the rest of the service.
+// See SharedDashboardHandler.
+//
+// It handles the following:
+// - POST: Creates a share link. The body is optional, and may set how long the link is valid: {"ttl": "72h"}
+// - GET: Retrieves the share links of the registration that have not expired.
+// - DELETE: Revokes a share link on {id}/shares/{shareId}, or every share link of the registration on {id}/shares.
+func handleRegistrationSharesRequest(w http.ResponseWriter, r *http.Request, id string, shareID string) {
+	if _, err := database.GetSingleRegistrationByID(id); err != nil {
+		util.HttpError(w, "could not find the registration '"+id+"'", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && shareID == "":
+		createShare(w, r, id)
+	case r.Method == http.MethodGet && shareID == "":
+		getShares(w, id)
+	case r.Method == http.MethodDelete:
+		revokeShares(w, id, shareID)
+	default:
+		util.HttpError(w, "This method is not supported! Only POST, GET and DELETE are supported on the shares of a "+
+			"registration, and only DELETE on a share", http.StatusMethodNotAllowed)
+	}
+}
+
+// createShare creates a share link of a registration's dashboard. The link expires after the time in the 'ttl' field
+// of the body, or after the default time in config.yaml. The time is limited by the 'max_ttl' in config.yaml.
+//
+// Responds with 201 Created, and the share with its token and URL.
+func createShare(w http.ResponseWriter, r *http.Request, registrationID string) {
+	var request struct {
+		TTL string `json:"ttl"`
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		util.HttpError(w, "could not read body", http.StatusBadRequest)
+		return
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		err := util.DecodeStrict(bytes.NewReader(body), &request)
+		var errs util.ValidationError
+		if errors.As(err, &errs) {
+			util.HttpValidationError(w, "the share is invalid", errs)
+			return
+		}
+		if err != nil {
+			util.HttpError(w, "could not parse body. "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ttl := shareTTL()
+	if request.TTL != "" {
+		ttl, err = time.ParseDuration(request.TTL)
+		if err != nil || ttl <= 0 {
+			util.HttpValidationError(w, "the share is invalid",
+				util.ValidationError{{Field: "ttl", Reason: "must be a positive duration, like '72h' or '30m'"}})
+			return
+		}
+	}
+	if ttl > shareMaxTTL() {
+		util.HttpValidationError(w, "the share is invalid",
+			util.ValidationError{{Field: "ttl", Reason: "must be at most " + shareMaxTTL().String()}})
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	share := util.Share{
+		ID:             myCrypto.GetMD5Hash(registrationID + time.Now().String()),
+		RegistrationID: registrationID,
+		Created:        now,
+		Expires:        now.Add(ttl).Truncate(time.Second),
+	}
+	if err := database.AddShare(share); err != nil {
+		log.Printf("Error storing share of registration %v: %v\n", registrationID, err)
+		util.HttpError(w, "failed to store the share", http.StatusInternalServerError)
+		return
+	}
+
+	signShare(&share)
+	w.Header().Set(util.CONTENT_TYPE, util.MIMETYPE_JSON)
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(share); err != nil {
+		log.Printf("Error writing response: %v\n", err)
+	}
+}
+
+// getShares returns the share links of a registration that have not expired, with their tokens and URLs.
+// If there are none, an empty array is returned.
+func getShares(w http.ResponseWriter, registrationID string) {
+	shares, err := database.GetSharesOfRegistration(registrationID)
+	if err != nil {
+		log.Printf("Error getting shares of registration %v: %v\n", registrationID, err)
+		util.HttpError(w, "failed to get shares", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	active := make([]util.Share, 0, len(shares))
+	for _, share := range shares {
+		if now.Before(share.Expires) {
+			signShare(&share)
+			active = append(active, share)
+		}
+	}
+
+	w.Header().Set(util.CONTENT_TYPE, util.MIMETYPE_JSON)
+	if err := json.NewEncoder(w).Encode(active); err != nil {
+		log.Printf("Error writing response: %v\n", err)
+	}
+}
+
+// revokeShares revokes a share link of a registration, or every share link of the registration if no share ID is
+// given. Is idempotent, so 204 is returned whether a share was revoked or not. A share of another registration is
+// not found.
+func revokeShares(w http.ResponseWriter, registrationID string, shareID string) {
+	if shareID == "" {
+		if err := database.DeleteSharesOfRegistration(registrationID); err != nil {
+			log.Printf("Error revoking shares of registration %v: %v\n", registrationID, err)
+			util.HttpError(w, "failed to revoke the shares", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	share, err := database.GetShare(shareID)
+	if err == nil && share.RegistrationID != registrationID {
+		util.HttpError(w, "the registration has no share '"+shareID+"'", http.StatusNotFound)
+		return
+	}
+	if err != nil && !errors.Is(err, database.ErrShareNotFound) {
+		log.Printf("Error getting share %v: %v\n", shareID, err)
+		util.HttpError(w, "failed to revoke the share", http.StatusInternalServerError)
+		return
+	}
+
+	if err := database.DeleteShare(shareID); err != nil {
+		log.Printf("Error revoking share %v: %v\n", shareID, err)
+		util.HttpError(w, "failed to revoke the share", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// signShare sets the token and the URL of a share. Tokens are not stored, since the same token is signed again from
+// the share.
+func signShare(share *util.Share) {
+	share.Token = myCrypto.SignShareToken(myCrypto.ShareClaims{
+		ID:             share.ID,
+		RegistrationID: share.RegistrationID,
+		Expires:        share.Expires.Unix(),
+	}, getShareKey())
+	share.URL = util.SHARED_PATH + share.Token
+}
+
+// SharedDashboardHandler is the entry point of share links. It renders the dashboard of the registration in the
+// token, and nothing else: the registration itself, other dashboards and the sub-resources of the dashboard are not
+// reachable from a share link.
+//
+// The token must be signed with the share key, must not have expired, and its share must not have been revoked. Like
+// a dashboard, it is written as HTML to browsers, and the '.html' extension always returns the HTML view.
+//
+// Example: GET /dashboard/v1/shared/eyJzaWQiOiIxIiwicmlkIjoiMTIzIiwiZXhwIjoxNzEzNDQzNDAwfQ.<signature>
+func SharedDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		util.HttpError(w, "This method is not supported! Only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The token is in the URL, so it must not be sent to other sites, such as the host of the flag, or be indexed
+	w.Header().Set(util.REFERRER_POLICY, "no-referrer")
+	w.Header().Set(util.X_ROBOTS_TAG, "noindex")
+	w.Header().Set(util.CACHE_CONTROL, "private, no-store")
+
+	token, resource := util.SplitResourcePath(r.URL.Path, util.SHARED_PATH)
+	if resource != "" {
+		util.HttpError(w, "only the dashboard can be shared", http.StatusNotFound)
+		return
+	}
+
+	claims, err := myCrypto.VerifyShareToken(strings.TrimSuffix(token, ".html"), getShareKey(), time.Now())
+	if errors.Is(err, myCrypto.ErrTokenExpired) {
+		util.HttpError(w, "the share link has expired", http.StatusGone)
+		return
+	}
+	if err != nil {
+		util.HttpError(w, "the share link is invalid", http.StatusNotFound)
+		return
+	}
+
+	share, err := database.GetShare(claims.ID)
+	if errors.Is(err, database.ErrShareNotFound) || (err == nil && share.RegistrationID != claims.RegistrationID) {
+		util.HttpError(w, "the share link has been revoked", http.StatusGone)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting share %v: %v\n", claims.ID, err)
+		util.HttpError(w, "failed to get the shared dashboard", http.StatusInternalServerError)
+		return
+	}
+
+	registration, err := database.GetSingleRegistrationByID(claims.RegistrationID)
+	if err != nil {
+		util.HttpError(w, "the shared dashboard no longer exists", http.StatusGone)
+		return
+	}
+
+	serveDashboard(w, r, registration)
+}
@@ -0,0 +1,172 @@
+package handler_test
+
+import (
+	"assignment2/crypto"
+	"assignment2/handler"
+	"assignment2/util"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestShareHandler tests creating, using and revoking share links of dashboards.
+// It verifies:
+// 1. POST on {id}/shares creates a share link that expires after the default time, or the time in the body.
+// 2. The share link renders the dashboard, and nothing else, without leaking the token in the Referer header.
+// 3. Tampered, expired and revoked tokens are refused.
+// 4. Invalid times and unknown registrations are refused.
+// 5. Deleting the registration revokes its share links.
+// 6. Expired shares are deleted from the database when a share is created.
+func TestShareHandler(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+	util.Config.Secrets.ShareKey = "a key that is only used for testing"
+
+	if err := populateRegistrationFile(); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+	if err := populateNotificationsFile(); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+	lastYear := time.Now().UTC().AddDate(-1, 0, 0)
+	stale := util.Share{ID: "stale", RegistrationID: "2", Created: lastYear, Expires: lastYear.Add(time.Hour)}
+	if err := util.PopulateTestFile(util.STUB_DATABASE_SHARES, []util.Share{stale}); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	defer startStubDatabase()()
+
+	request := func(method string, path string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set(util.ACCEPT, "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+		responseRecorder := httptest.NewRecorder()
+		if strings.HasPrefix(path, util.SHARED_PATH) {
+			handler.SharedDashboardHandler(responseRecorder, r)
+		} else {
+			handler.RegistrationHandler(responseRecorder, r)
+		}
+		return responseRecorder
+	}
+	created := func(body string) util.Share {
+		res := request(http.MethodPost, util.REGISTRATION_PATH+"1/shares", body)
+		if res.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d: %v", http.StatusCreated, res.Code, res.Body.String())
+		}
+		var share util.Share
+		if err := json.Unmarshal(res.Body.Bytes(), &share); err != nil {
+			t.Fatal("Could not decode the share:", err)
+		}
+		return share
+	}
+
+	//*******CREATE*******
+	weekly := created("")
+	if weekly.RegistrationID != "1" || weekly.Token == "" || weekly.URL != util.SHARED_PATH+weekly.Token ||
+		weekly.Expires.Sub(weekly.Created) != handler.DEFAULT_SHARE_TTL {
+		t.Errorf("Unexpected share: %+v", weekly)
+	}
+	hourly := created(`{"ttl": "1h"}`)
+	if hourly.Expires.Sub(hourly.Created) != time.Hour || hourly.ID == weekly.ID {
+		t.Errorf("Expected a share that expires in an hour, got %+v", hourly)
+	}
+	if file, err := os.ReadFile(util.STUB_DATABASE_SHARES); err != nil || strings.Contains(string(file), `"stale"`) {
+		t.Errorf("Expected the expired share to be deleted, got %s (%v)", file, err)
+	}
+
+	//*******PUBLIC LINK*******
+	for _, path := range []string{weekly.URL, weekly.URL + ".html"} {
+		res := request(http.MethodGet, path, "")
+		if res.Code != http.StatusOK || !strings.HasPrefix(res.Header().Get(util.CONTENT_TYPE), util.MIMETYPE_HTML) {
+			t.Fatalf("Expected the shared dashboard as HTML for %v, got %d: %v", path, res.Code, res.Body.String())
+		}
+		if !strings.Contains(res.Body.String(), "<h2>Norway") {
+			t.Errorf("The shared dashboard does not contain the country")
+		}
+		if res.Header().Get(util.REFERRER_POLICY) != "no-referrer" {
+			t.Errorf("Expected the token to be kept out of the Referer header, got %q", res.Header().Get(util.REFERRER_POLICY))
+		}
+	}
+
+	// Tamper with the registration ID in the claims, keeping the signature
+	claims, signature, _ := strings.Cut(weekly.Token, ".")
+	forged := myCrypto.SignShareToken(myCrypto.ShareClaims{ID: weekly.ID, RegistrationID: "2",
+		Expires: weekly.Expires.Unix()}, []byte("another key"))
+	forgedClaims, _, _ := strings.Cut(forged, ".")
+	expired := myCrypto.SignShareToken(myCrypto.ShareClaims{ID: weekly.ID, RegistrationID: "1",
+		Expires: time.Now().Add(-time.Minute).Unix()}, []byte(util.Config.Secrets.ShareKey))
+
+	refused := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{weekly.URL + "/chart.svg", http.StatusNotFound},
+		{util.SHARED_PATH + forgedClaims + "." + signature, http.StatusNotFound},
+		{util.SHARED_PATH + claims, http.StatusNotFound},
+		{util.SHARED_PATH + forged, http.StatusNotFound},
+		{util.SHARED_PATH + expired, http.StatusGone},
+	}
+	for _, test := range refused {
+		if res := request(http.MethodGet, test.path, ""); res.Code != test.expectedStatus {
+			t.Errorf("Expected status code %d for %v, got %d", test.expectedStatus, test.path, res.Code)
+		}
+	}
+	if res := request(http.MethodPost, weekly.URL, ""); res.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status code %d for POST on a share link, got %d", http.StatusMethodNotAllowed, res.Code)
+	}
+
+	//*******INVALID TESTING*******
+	invalid := []struct {
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{http.MethodPost, util.REGISTRATION_PATH + "1/shares", `{"ttl": "forever"}`, http.StatusUnprocessableEntity},
+		{http.MethodPost, util.REGISTRATION_PATH + "1/shares", `{"ttl": "-1h"}`, http.StatusUnprocessableEntity},
+		{http.MethodPost, util.REGISTRATION_PATH + "1/shares", `{"ttl": "9999h"}`, http.StatusUnprocessableEntity},
+		{http.MethodPost, util.REGISTRATION_PATH + "1/shares", `{"expires": "1h"}`, http.StatusUnprocessableEntity},
+		{http.MethodPost, util.REGISTRATION_PATH + "1/shares", `"1h"`, http.StatusBadRequest},
+		{http.MethodPost, util.REGISTRATION_PATH + "404/shares", "", http.StatusNotFound},
+		{http.MethodPut, util.REGISTRATION_PATH + "1/shares", "", http.StatusMethodNotAllowed},
+	}
+	for _, test := range invalid {
+		if res := request(test.method, test.path, test.body); res.Code != test.expectedStatus {
+			t.Errorf("Expected status code %d for %v %v %v, got %d", test.expectedStatus, test.method, test.path,
+				test.body, res.Code)
+		}
+	}
+
+	//*******LIST*******
+	res := request(http.MethodGet, util.REGISTRATION_PATH+"1/shares", "")
+	var shares []util.Share
+	if err := json.Unmarshal(res.Body.Bytes(), &shares); err != nil {
+		t.Fatal("Could not decode the shares:", err)
+	}
+	if len(shares) != 2 || shares[0].Token != weekly.Token || shares[1].Token != hourly.Token {
+		t.Errorf("Expected the two shares with their tokens, got %+v", shares)
+	}
+
+	//*******REVOKE*******
+	for i := 0; i < 2; i++ {
+		if res := request(http.MethodDelete, util.REGISTRATION_PATH+"1/shares/"+weekly.ID, ""); res.Code != http.StatusNoContent {
+			t.Errorf("Expected status code %d for revoking, got %d", http.StatusNoContent, res.Code)
+		}
+	}
+	if res := request(http.MethodGet, weekly.URL, ""); res.Code != http.StatusGone {
+		t.Errorf("Expected status code %d for a revoked share, got %d", http.StatusGone, res.Code)
+	}
+	if res := request(http.MethodGet, hourly.URL, ""); res.Code != http.StatusOK {
+		t.Errorf("Expected the other share to keep working, got %d", res.Code)
+	}
+
+	if res := request(http.MethodDelete, util.REGISTRATION_PATH+"1", ""); res.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d for deleting the registration, got %d", http.StatusNoContent, res.Code)
+	}
+	if res := request(http.MethodGet, hourly.URL, ""); res.Code != http.StatusGone {
+		t.Errorf("Expected the shares of a deleted registration to be revoked, got %d", res.Code)
+	}
+}
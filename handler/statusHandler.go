@@ -3,6 +3,7 @@ package handler
 import (
 	"assignment2/database"
 	"assignment2/models"
+	"assignment2/upstream"
 	"assignment2/util"
 	"encoding/json"
 	"log"
@@ -32,45 +33,14 @@ func StatusHandler(w http.ResponseWriter, r *http.Request) {
 func handleStatusGetRequest(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("content-type", "application/json")
 
-	var err error
-	// Get status code for the REST Countires API:
-	var countryStatusCode int
-	if util.Config.Stubs.RestCountries == true {
-		countryStatusCode, err = getStatusCode(util.LOCALHOST + util.REST_COUNTRIES_PORT + "/") // Use the stub-service
-	} else {
-		countryStatusCode, err = getStatusCode(util.COUNTRY_URL + "/alpha/no") // Use the real-service
-	}
-	if err != nil {
-		http.Error(w, "Error during connection to RESTCountry API", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-
-	// Get status code for the Open Meteo (Weather) API:
-	var metoStatusCode int
-	if util.Config.Stubs.Weather == true {
-		metoStatusCode, err = getStatusCode(util.LOCALHOST + util.OPENWEATHER_PORT + "/") // Use the stub-service
-	} else {
-		metoStatusCode, err = getStatusCode(util.OPEN_METO_URL) // Use the real-service
-	}
-	if err != nil {
-		http.Error(w, "Error during connection to Open Meteo API", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
-
-	// Get status code for the Currencies API:
-	var currencyStatusCode int
-	if util.Config.Stubs.Currencies == true {
-		currencyStatusCode, err = getStatusCode(util.LOCALHOST + util.CURRENCIES_PORT + "/") // Use the stub-service
-	} else {
-		currencyStatusCode, err = getStatusCode(util.CURRENCY_URL + "/NOK") // Use the real-service
-	}
-	if err != nil {
-		http.Error(w, "Error during connection to Currency API", http.StatusInternalServerError)
-		log.Println(err)
-		return
-	}
+	// Get status codes for the REST Countries, Open Meteo and MET Norway (Weather), Currencies and ECB APIs (or the
+	// stub-services).
+	// A service that could not be reached in time has the status code 0. Its breaker tells why.
+	countryStatusCode := getUpstreamStatusCode(upstream.Countries.Client, "/alpha/no")
+	metoStatusCode := getUpstreamStatusCode(upstream.Weather.Client, "")
+	metStatusCode := getUpstreamStatusCode(upstream.MetNorway.Client, upstream.MET_NORWAY_COMPACT_PATH+"?lat=60&lon=10")
+	currencyStatusCode := getUpstreamStatusCode(upstream.Currencies.Client, "/NOK")
+	ecbStatusCode := getUpstreamStatusCode(upstream.ECB.Client, upstream.ECB_DAILY_PATH)
 
 	// Get status code from the Notification database.
 	notificationStatusCode, err := getStatusCode("http://localhost:8080/dashboard/v1/notifications/123123")
@@ -94,11 +64,19 @@ func handleStatusGetRequest(w http.ResponseWriter, r *http.Request) {
 	diagnosticsMessage := util.Diagnostics{
 		Countriesapi:    countryStatusCode,                    // Statuscode for Country API
 		Meteoapi:        metoStatusCode,                       // Statuscode for Weather api
+		METapi:          metStatusCode,                        // Statuscode for MET Norway's weather api
 		Currencyapi:     currencyStatusCode,                   // Statuscode for Currencies api
+		ECBapi:          ecbStatusCode,                        // Statuscode for the ECB reference rates
 		Notificationapi: notificationStatusCode,               // Statuscode for the Notification database
 		NumWebhooks:     webhookNumber,                        // Number of Webhooks
 		Version:         "v1",                                 //version 1
 		Uptime:          int(time.Since(startTime).Seconds()), //calculated seconds since start
+		Breakers:        map[string]util.BreakerStatus{},      // Circuit breakers of the upstream services
+		Metrics:         map[string]util.UpstreamMetrics{},    // Calls to the upstream services
+	}
+	for name, client := range upstreamClients() {
+		diagnosticsMessage.Breakers[name] = client.Breaker.Status()
+		diagnosticsMessage.Metrics[name] = client.Metrics()
 	}
 
 	// Encode the response:
@@ -111,12 +89,49 @@ func handleStatusGetRequest(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "", http.StatusOK)
 }
 
+// upstreamClients returns the clients of the upstream services, by the same names as their status codes.
+func upstreamClients() map[string]*upstream.Client {
+	return map[string]*upstream.Client{
+		"countriesapi": upstream.Countries.Client,
+		"meto_api":     upstream.Weather.Client,
+		"met_api":      upstream.MetNorway.Client,
+		"currency_api": upstream.Currencies.Client,
+		"ecb_api":      upstream.ECB.Client,
+	}
+}
+
+// getUpstreamStatusCode retrieves the status code of a path below an upstream service's base URL. The request is not
+// retried, and is limited by the service's time limit, so a service that hangs doesn't hang the status.
+//
+// Returns:
+// - The status code, or 0 if the service could not be reached in time.
+func getUpstreamStatusCode(client *upstream.Client, path string) int {
+	httpClient := http.Client{Timeout: client.Timeout}
+	req, err := http.NewRequest(http.MethodGet, client.BaseURL()+path, nil)
+	if err != nil {
+		log.Printf("Failed to get the status of %v: %v\n", client.Name, err)
+		return 0
+	}
+	if client.UserAgent != "" {
+		req.Header.Set(util.USER_AGENT, client.UserAgent)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		log.Printf("Failed to get the status of %v: %v\n", client.Name, err)
+		return 0
+	}
+	res.Body.Close()
+
+	return res.StatusCode
+}
+
 // getStatusCode retrieves the status codes for a chosen url and returns it.
 func getStatusCode(url string) (int, error) {
 	// Make and issue a new GET-request
 	res, err := http.Get(url)
 	if err != nil {
-		return res.StatusCode, err
+		return 0, err
 	}
 	res.Body.Close() // Close the body.
 
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"assignment2/crypto"
+	"assignment2/models"
+	"assignment2/notifications"
+	"assignment2/util"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// SubscriptionHandler is the entry point for the WebSocket channel of notifications.
+//
+// A client subscribes to events by sending a models.SubscriptionDTO, and receives the same
+// models.InvocationNotificationModel as a webhook with the same filter would. A client may have several subscriptions
+// on one connection. Every subscription ends when the connection is closed.
+var SubscriptionHandler = websocket.Handler(handleSubscriptions)
+
+// handleSubscriptions reads subscription messages from a WebSocket connection until it is closed.
+func handleSubscriptions(ws *websocket.Conn) {
+	defer ws.Close()
+
+	// Unsubscribe functions by subscription ID
+	subscriptions := map[string]func(){}
+	var senders sync.WaitGroup
+	defer func() {
+		for _, unsubscribe := range subscriptions {
+			unsubscribe()
+		}
+		senders.Wait()
+	}()
+
+	for {
+		var message models.SubscriptionDTO
+		if err := websocket.JSON.Receive(ws, &message); err != nil {
+			// The client closed the connection, or sent something that is not JSON. Either way, the channel ends.
+			return
+		}
+
+		switch strings.ToUpper(message.Action) {
+		case models.ACTION_SUBSCRIBE:
+			message.Action = models.ACTION_SUBSCRIBE
+			message.Event = strings.ToUpper(message.Event)
+			message.Country = strings.ToUpper(message.Country)
+			if err := util.ValidateEvents(message.Event); err != nil {
+				message.Error = "field 'event' is invalid. " + err.Error()
+				break
+			}
+			if message.Event == util.EVENT_THRESHOLD {
+				message.Error = "field 'event' is invalid. 'THRESHOLD' events need conditions, and are only sent to webhooks"
+				break
+			}
+
+			message.Id = myCrypto.GetMD5Hash(message.Event + message.Country + time.Now().String())
+			events, unsubscribe := notifications.Subscribe(models.NotificationDatabaseModel{
+				Id:      message.Id,
+				Event:   message.Event,
+				Country: message.Country,
+			})
+			subscriptions[message.Id] = unsubscribe
+
+			senders.Add(1)
+			go func() {
+				defer senders.Done()
+				for event := range events {
+					if err := websocket.JSON.Send(ws, event); err != nil {
+						log.Printf("Failed to send %v event to WebSocket subscription: %v\n", event.Event, err)
+					}
+				}
+			}()
+		case models.ACTION_UNSUBSCRIBE:
+			message.Action = models.ACTION_UNSUBSCRIBE
+			unsubscribe, ok := subscriptions[message.Id]
+			if !ok {
+				message.Error = "no subscription is found by the field 'id'"
+				break
+			}
+			unsubscribe()
+			delete(subscriptions, message.Id)
+		default:
+			message.Error = "field 'action' must be 'SUBSCRIBE' or 'UNSUBSCRIBE'"
+		}
+
+		if err := websocket.JSON.Send(ws, message); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package handler_test
+
+import (
+	"assignment2/handler"
+	"assignment2/models"
+	"assignment2/notifications"
+	"assignment2/util"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// TestSubscriptionHandler tests that a WebSocket client receives the events it subscribed to, and nothing else.
+//
+// Requirements:
+// - Subscribing returns the subscription's ID
+// - Only events matching the subscription's event and country are received
+// - Invalid messages are answered with an error, without closing the connection
+// - Unsubscribing stops the events
+func TestSubscriptionHandler(t *testing.T) {
+	util.FixStubPaths()
+
+	server := httptest.NewServer(handler.SubscriptionHandler)
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+util.NOTIFICATION_SOCKET_PATH, "", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to open the WebSocket connection.\n%v\n", err)
+	}
+	defer ws.Close()
+
+	exchange := func(message models.SubscriptionDTO) models.SubscriptionDTO {
+		if err := websocket.JSON.Send(ws, message); err != nil {
+			t.Fatalf("Failed to send %v.\n%v\n", message, err)
+		}
+		var reply models.SubscriptionDTO
+		if err := websocket.JSON.Receive(ws, &reply); err != nil {
+			t.Fatalf("Failed to receive a reply to %v.\n%v\n", message, err)
+		}
+		return reply
+	}
+
+	// Subscribe
+	subscription := exchange(models.SubscriptionDTO{Action: "subscribe", Event: "change", Country: "no"})
+	if subscription.Id == "" || subscription.Error != "" || subscription.Event != util.EVENT_CHANGE || subscription.Country != "NO" {
+		t.Fatalf("Expected a subscription to CHANGE events in NO, got %+v", subscription)
+	}
+
+	// Invalid messages
+	if reply := exchange(models.SubscriptionDTO{Action: models.ACTION_SUBSCRIBE, Event: "CREATE"}); reply.Error == "" || reply.Id != "" {
+		t.Errorf("Expected an error for an invalid event, got %+v", reply)
+	}
+	if reply := exchange(models.SubscriptionDTO{Action: "LISTEN"}); reply.Error == "" {
+		t.Errorf("Expected an error for an invalid action, got %+v", reply)
+	}
+
+	// Only the matching event is received
+	_ = notifications.InvokeEvent("SE", util.EVENT_CHANGE)
+	_ = notifications.InvokeEvent("NO", util.EVENT_DELETE)
+	_ = notifications.InvokeEvent("NO", util.EVENT_CHANGE)
+
+	var event models.InvocationNotificationModel
+	if err := ws.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("Failed to set a read deadline.\n%v\n", err)
+	}
+	if err := websocket.JSON.Receive(ws, &event); err != nil {
+		t.Fatalf("Failed to receive the event.\n%v\n", err)
+	}
+	if event.Id != subscription.Id || event.Event != util.EVENT_CHANGE || event.Country != "NO" || event.Time.IsZero() {
+		t.Errorf("Expected a CHANGE event in NO for subscription %v, got %+v", subscription.Id, event)
+	}
+
+	// Unsubscribe
+	if reply := exchange(models.SubscriptionDTO{Action: models.ACTION_UNSUBSCRIBE, Id: subscription.Id}); reply.Error != "" {
+		t.Errorf("Expected to unsubscribe, got %+v", reply)
+	}
+	if reply := exchange(models.SubscriptionDTO{Action: models.ACTION_UNSUBSCRIBE, Id: subscription.Id}); reply.Error == "" {
+		t.Errorf("Expected an error when unsubscribing twice, got %+v", reply)
+	}
+}
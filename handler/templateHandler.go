@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"assignment2/dashboards"
+	"assignment2/database"
+	"assignment2/util"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// TemplateHandler is the main entry point for the template endpoint. Templates are named sets of features that
+// registrations are created from, see HandleRegistrationPostRequest.
+//
+// It handles the following:
+// - GET: Retrieve a template by its name, or all templates if no name is given.
+// - PUT: Creates or replaces a template by its name.
+// - DELETE: Removes a template.
+//
+// If an unrecognized method is detected, an appropriate error is returned.
+func TemplateHandler(w http.ResponseWriter, r *http.Request) {
+	name, _ := util.SplitResourcePath(r.URL.Path, util.TEMPLATE_PATH)
+
+	switch r.Method {
+	case http.MethodGet:
+		if name == "" {
+			getAllTemplates(w)
+		} else {
+			getTemplate(w, name)
+		}
+	case http.MethodPut:
+		if name == "" {
+			util.HttpError(w, "method 'PUT' requires the name of the template", http.StatusBadRequest)
+			return
+		}
+		putTemplate(w, r, name)
+	case http.MethodDelete:
+		if name == "" {
+			util.HttpError(w, "method 'DELETE' requires the name of the template", http.StatusBadRequest)
+			return
+		}
+		deleteTemplate(w, name)
+	default:
+		util.HttpError(w, "This method is not supported! Only GET, PUT and DELETE are supported",
+			http.StatusMethodNotAllowed)
+	}
+}
+
+// getAllTemplates returns all templates to the client. If there are no templates, an empty array is returned.
+func getAllTemplates(w http.ResponseWriter) {
+	templates, err := database.GetAllTemplates()
+	if err != nil {
+		log.Printf("Error getting all templates: %v\n", err)
+		util.HttpError(w, "failed to get templates", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(util.CONTENT_TYPE, util.MIMETYPE_JSON)
+	if err := json.NewEncoder(w).Encode(templates); err != nil {
+		log.Printf("Error writing response: %v\n", err)
+	}
+}
+
+// getTemplate returns a template by its name to the client.
+func getTemplate(w http.ResponseWriter, name string) {
+	template, err := database.GetTemplate(name)
+	if errors.Is(err, database.ErrTemplateNotFound) {
+		util.HttpError(w, "no template is named '"+name+"'", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting template %v: %v\n", name, err)
+		util.HttpError(w, "failed to get the template", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(util.CONTENT_TYPE, util.MIMETYPE_JSON)
+	if err := json.NewEncoder(w).Encode(template); err != nil {
+		log.Printf("Error writing response: %v\n", err)
+	}
+}
+
+// putTemplate creates or replaces a template by its name. The body is decoded and validated as strictly as a
+// registration (see decodeRegistration). The name may be left out of the body, but must match the name in the URL if
+// it is given.
+//
+// Responds with 201 Created if the template is new, and 200 OK if it replaced a template.
+func putTemplate(w http.ResponseWriter, r *http.Request, name string) {
+	var template util.Template
+	err := util.DecodeStrict(r.Body, &template)
+	var errs util.ValidationError
+	if errors.As(err, &errs) {
+		util.HttpValidationError(w, "the template is invalid", errs)
+		return
+	}
+	if err != nil {
+		util.HttpError(w, "could not parse body. "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if template.Name != "" && template.Name != name {
+		errs = append(errs, util.FieldError{Field: "name", Reason: "must be the name in the URL, '" + name + "'"})
+	}
+	template.Name = name
+	errs = append(errs, util.ValidateTemplate(&template)...)
+	if err := dashboards.ValidateComputed(template.Features); err != nil {
+		errs = append(errs, util.FieldError{Field: "features.computed", Reason: err.Error()})
+	}
+	if len(errs) > 0 {
+		util.HttpValidationError(w, "the template is invalid", errs)
+		return
+	}
+
+	_, err = database.GetTemplate(name)
+	created := errors.Is(err, database.ErrTemplateNotFound)
+	if err != nil && !created {
+		log.Printf("Error getting template %v: %v\n", name, err)
+		util.HttpError(w, "failed to store the template", http.StatusInternalServerError)
+		return
+	}
+
+	template.LastChange = time.Now().Format("2006-01-02 15:04")
+	if err := database.SetTemplate(template); err != nil {
+		log.Printf("Error storing template %v: %v\n", name, err)
+		util.HttpError(w, "failed to store the template", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(util.CONTENT_TYPE, util.MIMETYPE_JSON)
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	if err := json.NewEncoder(w).Encode(template); err != nil {
+		log.Printf("Error writing response: %v\n", err)
+	}
+}
+
+// deleteTemplate deletes a template by its name. Is idempotent, so 204 is returned whether a template was deleted or
+// not.
+func deleteTemplate(w http.ResponseWriter, name string) {
+	if err := database.DeleteTemplate(name); err != nil {
+		log.Printf("Error deleting template %v: %v\n", name, err)
+		util.HttpError(w, "failed to delete the template", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
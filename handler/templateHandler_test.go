@@ -0,0 +1,243 @@
+package handler_test
+
+import (
+	"assignment2/handler"
+	"assignment2/models"
+	"assignment2/notifications"
+	"assignment2/util"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestTemplateHandler tests creating, retrieving and deleting registration templates.
+// It verifies:
+// 1. PUT creates a template (201), and replaces it the next time (200).
+// 2. Invalid templates return 422 (unprocessable entity) with every invalid field.
+// 3. GET returns a template by name, or all templates, and 404 for unknown names.
+// 4. DELETE is idempotent.
+func TestTemplateHandler(t *testing.T) {
+	util.FixStubPaths()
+	util.Config.Stubs.Database = true
+	defer startStubDatabase()()
+	if err := util.PopulateTestFile(util.STUB_DATABASE_TEMPLATES, []util.Template{}); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	request := func(method string, name string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, util.TEMPLATE_PATH+name, strings.NewReader(body))
+		responseRecorder := httptest.NewRecorder()
+		handler.TemplateHandler(responseRecorder, r)
+		return responseRecorder
+	}
+
+	//*******VALID TESTING*******
+	body := `{"features": {"temperature": true, "capital": true, "targetCurrencies": ["eur", "USD"]}}`
+	if res := request(http.MethodPut, "nordic-default", body); res.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d for a new template, got %d: %v", http.StatusCreated, res.Code, res.Body.String())
+	}
+	body = `{"name": "nordic-default", "features": {"temperature": true, "population": true, "targetCurrencies": ["EUR"]}}`
+	if res := request(http.MethodPut, "nordic-default", body); res.Code != http.StatusOK {
+		t.Errorf("Expected status code %d for a replaced template, got %d", http.StatusOK, res.Code)
+	}
+	if res := request(http.MethodPut, "minimal", `{}`); res.Code != http.StatusCreated {
+		t.Errorf("Expected status code %d for an empty template, got %d", http.StatusCreated, res.Code)
+	}
+
+	res := request(http.MethodGet, "nordic-default", "")
+	var template util.Template
+	if err := json.Unmarshal(res.Body.Bytes(), &template); err != nil {
+		t.Fatal("Could not decode the template:", err)
+	}
+	if template.Name != "nordic-default" || !template.Features.Population || template.Features.Capital ||
+		strings.Join(template.Features.TargetCurrencies, ",") != "EUR" || template.LastChange == "" {
+		t.Errorf("Unexpected template: %+v", template)
+	}
+
+	res = request(http.MethodGet, "", "")
+	var templates []util.Template
+	if err := json.Unmarshal(res.Body.Bytes(), &templates); err != nil {
+		t.Fatal("Could not decode the templates:", err)
+	}
+	if len(templates) != 2 || templates[0].Name != "minimal" || templates[1].Name != "nordic-default" {
+		t.Errorf("Expected the templates minimal and nordic-default, got %+v", templates)
+	}
+
+	//*******INVALID TESTING*******
+	invalid := []struct {
+		name           string
+		body           string
+		expectedFields []string
+	}{
+		{"nordic", `{"features": {"targetCurrencies": ["euro"], "wind": true}}`,
+			[]string{"features.wind"}},
+		{"nordic", `{"features": {"targetCurrencies": ["euro"]}}`, []string{"features.targetCurrencies[0]"}},
+		{"nordic", `{"name": "baltic"}`, []string{"name"}},
+		{"Nordic_Default", `{}`, []string{"name"}},
+		{"nordic", `{"lastChange": "2024-04-10 14:09"}`, []string{"lastChange"}},
+		{"nordic", `{"features": {"computed": {"density": "population / area"}}}`, []string{"features.computed"}},
+	}
+	for _, test := range invalid {
+		res := request(http.MethodPut, test.name, test.body)
+		if res.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status code %d for %v, got %d", http.StatusUnprocessableEntity, test.body, res.Code)
+			continue
+		}
+
+		var result struct {
+			Errors []util.FieldError `json:"errors"`
+		}
+		if err := json.Unmarshal(res.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Could not decode the response for %v: %v", test.body, err)
+		}
+		var fields []string
+		for _, fieldErr := range result.Errors {
+			fields = append(fields, fieldErr.Field)
+		}
+		if strings.Join(fields, ",") != strings.Join(test.expectedFields, ",") {
+			t.Errorf("Expected the invalid fields %v for %v, got %v", test.expectedFields, test.body, fields)
+		}
+	}
+
+	if res := request(http.MethodGet, "baltic", ""); res.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for an unknown template, got %d", http.StatusNotFound, res.Code)
+	}
+	if res := request(http.MethodPut, "", `{}`); res.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d without a name, got %d", http.StatusBadRequest, res.Code)
+	}
+
+	//*******DELETE*******
+	for i := 0; i < 2; i++ {
+		if res := request(http.MethodDelete, "minimal", ""); res.Code != http.StatusNoContent {
+			t.Errorf("Expected status code %d for deletion, got %d", http.StatusNoContent, res.Code)
+		}
+	}
+	if res := request(http.MethodGet, "minimal", ""); res.Code != http.StatusNotFound {
+		t.Errorf("Expected the deleted template to be gone, got %d", res.Code)
+	}
+}
+
+// TestRegistrationFromTemplate tests creating registrations from templates, and cloning registrations.
+// It verifies:
+// 1. A registration created from a template has the template's features and the country in the query.
+// 2. A clone copies the features of a registration, and may change its country and override fields.
+// 3. Both invoke REGISTER notifications.
+// 4. Unknown templates return 422, unknown registrations to clone 404, and invalid overrides 422.
+func TestRegistrationFromTemplate(t *testing.T) {
+	util.FixStubPaths()
+	defer startStubServices()()
+
+	if err := populateRegistrationFile(); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+	if err := populateNotificationsFile(); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+	template := util.Template{Name: "nordic-default", Features: util.Features{
+		Temperature: true, Population: true, TargetCurrencies: []string{"EUR", "USD"}}}
+	if err := util.PopulateTestFile(util.STUB_DATABASE_TEMPLATES, []util.Template{template}); err != nil {
+		t.Fatalf("Failed to populate the test data. %v\n", err)
+	}
+
+	defer startStubDatabase()()
+
+	events, unsubscribe := notifications.Subscribe(models.NotificationDatabaseModel{Event: util.EVENT_REGISTER})
+	defer unsubscribe()
+
+	post := func(path string, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		responseRecorder := httptest.NewRecorder()
+		handler.RegistrationHandler(responseRecorder, request)
+		return responseRecorder
+	}
+	created := func(res *httptest.ResponseRecorder) util.Registration {
+		if res.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d: %v", http.StatusCreated, res.Code, res.Body.String())
+		}
+		var result map[string]string
+		if err := json.Unmarshal(res.Body.Bytes(), &result); err != nil {
+			t.Fatal("Could not decode response:", err)
+		}
+
+		request := httptest.NewRequest(http.MethodGet, util.REGISTRATION_PATH+result["id"], nil)
+		responseRecorder := httptest.NewRecorder()
+		handler.RegistrationHandler(responseRecorder, request)
+
+		var registration util.Registration
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), &registration); err != nil {
+			t.Fatal("Could not decode the stored registration:", err)
+		}
+		return registration
+	}
+	expectEvent := func(isoCode string) {
+		select {
+		case event := <-events:
+			if event.Country != isoCode {
+				t.Errorf("Expected a REGISTER event for %v, got %+v", isoCode, event)
+			}
+		default:
+			t.Errorf("Expected a REGISTER event for %v", isoCode)
+		}
+	}
+
+	//*******TEMPLATES*******
+	registration := created(post(util.REGISTRATION_PATH+"?template=nordic-default&isoCode=SE", ""))
+	if registration.Country != "Sweden" || registration.IsoCode != "SE" || !registration.Features.Temperature ||
+		!registration.Features.Population || strings.Join(registration.Features.TargetCurrencies, ",") != "EUR,USD" {
+		t.Errorf("The registration was not created from the template as expected: %+v", registration)
+	}
+	expectEvent("SE")
+
+	registration = created(post(util.REGISTRATION_PATH+"?template=nordic-default&country=Denmark",
+		`{"features": {"area": true, "targetCurrencies": ["NOK"]}, "snapshots": "daily"}`))
+	if registration.IsoCode != "DK" || !registration.Features.Area || !registration.Features.Temperature ||
+		strings.Join(registration.Features.TargetCurrencies, ",") != "NOK" || registration.Snapshots != "daily" {
+		t.Errorf("The template was not overridden as expected: %+v", registration)
+	}
+	expectEvent("DK")
+
+	//*******CLONES*******
+	registration = created(post(util.REGISTRATION_PATH+"1/clone?isoCode=FI", ""))
+	if registration.Country != "Finland" || registration.IsoCode != "FI" || !registration.Features.Capital ||
+		strings.Join(registration.Features.TargetCurrencies, ",") != "EUR,USD,SEK" || registration.ID == "1" {
+		t.Errorf("The registration was not cloned as expected: %+v", registration)
+	}
+	expectEvent("FI")
+
+	registration = created(post(util.REGISTRATION_PATH+"1/clone", `{"isoCode": "SE", "features": {"area": false}}`))
+	if registration.Country != "Sweden" || registration.Features.Area || !registration.Features.Population {
+		t.Errorf("The clone was not overridden as expected: %+v", registration)
+	}
+	expectEvent("SE")
+
+	registration = created(post(util.REGISTRATION_PATH+"1/clone", ""))
+	if registration.Country != "Norway" || registration.IsoCode != "NO" {
+		t.Errorf("Expected a plain clone to keep the country, got %+v", registration)
+	}
+	expectEvent("NO")
+
+	//*******INVALID TESTING*******
+	invalid := []struct {
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{util.REGISTRATION_PATH + "?template=baltic&isoCode=EE", "", http.StatusUnprocessableEntity},
+		{util.REGISTRATION_PATH + "?template=nordic-default", "", http.StatusUnprocessableEntity},
+		{util.REGISTRATION_PATH + "?template=nordic-default&isoCode=XX", "", http.StatusUnprocessableEntity},
+		{util.REGISTRATION_PATH + "?template=nordic-default&isoCode=SE", `{"colour": "red"}`, http.StatusUnprocessableEntity},
+		{util.REGISTRATION_PATH + "?template=nordic-default&isoCode=SE", `["SE"]`, http.StatusBadRequest},
+		{util.REGISTRATION_PATH + "404/clone", "", http.StatusNotFound},
+		{util.REGISTRATION_PATH + "1/clone", `{"features": {"targetCurrencies": ["euro"]}}`, http.StatusUnprocessableEntity},
+	}
+	for _, test := range invalid {
+		if res := post(test.path, test.body); res.Code != test.expectedStatus {
+			t.Errorf("Expected status code %d for %v %v, got %d", test.expectedStatus, test.path, test.body, res.Code)
+		}
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no REGISTER events for invalid registrations, got %v", len(events))
+	}
+}
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"assignment2/dashboards"
 	"assignment2/database"
 	"assignment2/handler"
 	"assignment2/stubs"
+	"assignment2/upstream"
 	"assignment2/util"
+	"assignment2/views"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 )
 
@@ -22,6 +26,12 @@ func main() {
 		log.Println("Initialized config")
 	}
 
+	// Apply the base URLs, time limits and attempts of the upstream services, and choose the weather and currency
+	// providers
+	if err := upstream.Configure(); err != nil {
+		log.Fatalf("Error configuring the upstream services: %v", err)
+	}
+
 	// Initialize database
 	if util.Config.Stubs.Database == true {
 		// Database stub
@@ -58,6 +68,25 @@ func main() {
 		go stubs.Country_stub()
 	}
 
+	if util.Config.Stubs.ECB == true {
+		go stubs.ECB_stub()
+	}
+
+	if util.Config.Stubs.MetNorway == true {
+		go stubs.MetNorway_stub()
+	}
+
+	// Store the dashboards of registrations with snapshots
+	go dashboards.ScheduleSnapshots()
+
+	// Check the conditions of THRESHOLD notifications
+	go dashboards.ScheduleThresholds()
+
+	// Refresh the upstream data of the registrations, so dashboards are served from the cache. Only when it is on.
+	if upstream.Caching() {
+		go dashboards.ScheduleWarming()
+	}
+
 	// Run the main server
 	go func() {
 		port := os.Getenv("PORT")
@@ -67,8 +96,14 @@ func main() {
 		}
 		http.HandleFunc(util.REGISTRATION_PATH, handler.RegistrationHandler)
 		http.HandleFunc(util.DASHBOARD_PATH, handler.DashboardHandler)
+		// Ad-hoc dashboards are requested without a trailing slash. Avoids redirecting POST requests.
+		http.HandleFunc(strings.TrimSuffix(util.DASHBOARD_PATH, "/"), handler.DashboardHandler)
 		http.HandleFunc(util.NOTIFICATION_PATH, handler.NotificationHandler)
+		http.Handle(util.NOTIFICATION_SOCKET_PATH, handler.SubscriptionHandler)
+		http.HandleFunc(util.TEMPLATE_PATH, handler.TemplateHandler)
+		http.HandleFunc(util.SHARED_PATH, handler.SharedDashboardHandler)
 		http.HandleFunc(util.STATUS_PATH, handler.StatusHandler)
+		http.Handle(util.STATIC_PATH, views.StaticHandler())
 
 		log.Println("Service is listening on port: " + port)
 		log.Fatal(http.ListenAndServe(":"+port, nil))
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Features a condition can be set on. Exchange rates use the prefix followed by the currency code. Example:
+// "targetCurrencies.EUR"
+const (
+	FEATURE_TEMPERATURE     = "temperature"
+	FEATURE_PRECIPITATION   = "precipitation"
+	FEATURE_POPULATION      = "population"
+	FEATURE_AREA            = "area"
+	FEATURE_CURRENCY_PREFIX = "targetCurrencies."
+)
+
+// Operators that compare a feature's value with a condition's value.
+const (
+	OPERATOR_LESS          = "<"
+	OPERATOR_LESS_EQUAL    = "<="
+	OPERATOR_GREATER       = ">"
+	OPERATOR_GREATER_EQUAL = ">="
+)
+
+// Condition is a line that a dashboard value may cross. Example: temperature < -10
+type Condition struct {
+	Feature  string  `json:"feature"`  // Feature is the dashboard value to check. See 'FEATURE_*'.
+	Operator string  `json:"operator"` // Operator compares the value with Value. See 'OPERATOR_*'.
+	Value    float64 `json:"value"`    // Value is the line to compare with.
+}
+
+// ThresholdState is sent to webhook subscribers when a condition starts or stops holding.
+type ThresholdState struct {
+	Condition
+	Actual float64 `json:"actual"` // Actual is the feature's value when the condition was checked.
+	Holds  bool    `json:"holds"`  // Holds is true if the condition started holding, and false if it stopped.
+}
+
+// Validate ensures that the condition's feature and operator are known. The currency code of an exchange rate is
+// converted to uppercase.
+func (c *Condition) Validate() error {
+	switch {
+	case c.Feature == FEATURE_TEMPERATURE, c.Feature == FEATURE_PRECIPITATION,
+		c.Feature == FEATURE_POPULATION, c.Feature == FEATURE_AREA:
+	case strings.HasPrefix(c.Feature, FEATURE_CURRENCY_PREFIX) && len(c.Currency()) == 3:
+		c.Feature = FEATURE_CURRENCY_PREFIX + strings.ToUpper(c.Currency())
+	default:
+		return fmt.Errorf("the feature must be 'temperature', 'precipitation', 'population', 'area' or " +
+			"'targetCurrencies.' followed by a currency code")
+	}
+
+	switch c.Operator {
+	case OPERATOR_LESS, OPERATOR_LESS_EQUAL, OPERATOR_GREATER, OPERATOR_GREATER_EQUAL:
+		return nil
+	default:
+		return fmt.Errorf("the operator must be '<', '<=', '>' or '>='")
+	}
+}
+
+// Currency returns the currency code of an exchange rate condition, or an empty string for other features.
+func (c *Condition) Currency() string {
+	currency, ok := strings.CutPrefix(c.Feature, FEATURE_CURRENCY_PREFIX)
+	if !ok {
+		return ""
+	}
+	return currency
+}
+
+// Holds checks whether a value satisfies the condition.
+func (c *Condition) Holds(actual float64) bool {
+	switch c.Operator {
+	case OPERATOR_LESS:
+		return actual < c.Value
+	case OPERATOR_LESS_EQUAL:
+		return actual <= c.Value
+	case OPERATOR_GREATER:
+		return actual > c.Value
+	case OPERATOR_GREATER_EQUAL:
+		return actual >= c.Value
+	default:
+		return false
+	}
+}
+
+// String formats the condition the way it is written. Example: temperature < -10
+func (c *Condition) String() string {
+	return fmt.Sprintf("%v %v %v", c.Feature, c.Operator, c.Value)
+}
@@ -8,9 +8,10 @@ import (
 // NotificationDTO is a data transfer object that contains data transferred from the client to our server.
 // To learn more about available events, please look at 'EVENT_*' in assignment2.util.events
 type NotificationDTO struct {
-	Url     string `json:"url"`   // Url is the url we will POST. This is provided by the client.
-	Event   string `json:"event"` // Event is the type of event to be invoked.
-	Country string `json:"country,omitempty"`
+	Url        string      `json:"url"`   // Url is the url we will POST. This is provided by the client.
+	Event      string      `json:"event"` // Event is the type of event to be invoked.
+	Country    string      `json:"country,omitempty"`
+	Conditions []Condition `json:"conditions,omitempty"` // Conditions are required for, and only allowed on, THRESHOLD events.
 }
 
 // NotificationDatabaseModel is the datastructure that we store in our database.
@@ -22,6 +23,8 @@ type NotificationDatabaseModel struct {
 	Url     string `json:"url"`               // Url is the url we will POST. This is provided by the client.
 	Event   string `json:"event,omitempty"`   // Event is the type of event to be invoked.
 	Country string `json:"country,omitempty"` // Country is used as filter to know what country a notification should be invoked on
+	// Conditions are the lines a THRESHOLD notification is invoked on, whenever one of them starts or stops holding
+	Conditions []Condition `json:"conditions,omitempty"`
 }
 
 // InvocationNotificationModel is send data to webhook subscribers.
@@ -30,6 +33,26 @@ type InvocationNotificationModel struct {
 	Country string    `json:"country"`
 	Event   string    `json:"event"`
 	Time    time.Time `json:"time"`
+	// Threshold is the condition that started or stopped holding. Only sent for THRESHOLD events.
+	Threshold *ThresholdState `json:"threshold,omitempty"`
+}
+
+// Actions a WebSocket client may send in a SubscriptionDTO.
+const (
+	ACTION_SUBSCRIBE   = "SUBSCRIBE"
+	ACTION_UNSUBSCRIBE = "UNSUBSCRIBE"
+)
+
+// SubscriptionDTO is a message on the WebSocket channel. The client sends it to subscribe to events, or to unsubscribe
+// from them. The server answers with the same message, with Id filled in, or with Error if it was rejected.
+//
+// Event and Country filter the events the same way as a NotificationDatabaseModel does.
+type SubscriptionDTO struct {
+	Action  string `json:"action"`            // Action is 'ACTION_SUBSCRIBE' or 'ACTION_UNSUBSCRIBE'.
+	Id      string `json:"id,omitempty"`      // Id is the subscription's identifier. Required to unsubscribe.
+	Event   string `json:"event,omitempty"`   // Event is the type of event to subscribe to. Empty means all events.
+	Country string `json:"country,omitempty"` // Country is the ISO code to subscribe to. Empty means all countries.
+	Error   string `json:"error,omitempty"`   // Error is why the server rejected the message.
 }
 
 // PopulateFromMap fills out the NotificationDatabaseModel with fields from a map of strings.
@@ -46,6 +69,32 @@ func (w *NotificationDatabaseModel) PopulateFromMap(data map[string]interface{})
 	if val, ok := data["Country"].(string); ok {
 		w.Country = val
 	}
+	if val, ok := data["Conditions"].([]interface{}); ok {
+		w.Conditions = conditionsFromMap(val)
+	}
+}
+
+// conditionsFromMap converts conditions stored in the database to Condition objects.
+func conditionsFromMap(data []interface{}) []Condition {
+	conditions := make([]Condition, 0, len(data))
+	for _, item := range data {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var c Condition
+		c.Feature, _ = fields["Feature"].(string)
+		c.Operator, _ = fields["Operator"].(string)
+		switch val := fields["Value"].(type) {
+		case float64:
+			c.Value = val
+		case int64:
+			c.Value = float64(val)
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions
 }
 
 // ValidateFromClient ensures that all required fields from the client are filled out.
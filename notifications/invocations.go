@@ -27,6 +27,19 @@ import (
 //
 // Output: No output, but all dashboard configurations with "NO" will be found.
 func InvokeEvent(country string, event string) error {
+	return InvokeEventForCountries([]string{country}, event)
+}
+
+// InvokeEventForCountries invokes an event that concerns several countries at once, like a change of a comparison
+// registration. Every notification receives the event at most once: a notification filtered on one of the countries
+// receives it for that country, and a notification without a country receives it for the first country.
+//
+// # Example
+//
+// notifications.InvokeEventForCountries([]string{"NO", "SE"}, util.EVENT_CHANGE)
+//
+// Output: No output, but notifications for "NO", for "SE" and for any country each receive one CHANGE event.
+func InvokeEventForCountries(countries []string, event string) error {
 	validateEvent := util.ValidateEvents(event)
 
 	// This event should only be used internally. If an error is invoked, it means developers have made a mistake, and
@@ -37,32 +50,36 @@ func InvokeEvent(country string, event string) error {
 		return fmt.Errorf("failed to validate event %v. This should not happen", event)
 	}
 
+	// Webhooks and listeners inside this process receive the same payload, with the country and the event that
+	// happened. Only the ID differs, which is the ID of each notification, and the country if there are several.
+	invocation := models.InvocationNotificationModel{Event: event, Time: time.Now()}
+
+	// Listeners inside this process are told first, so they don't depend on the database being reachable.
+	publish(countries, invocation)
+
 	databaseModels, err := database.GetAllNotifications()
 	if err != nil {
 		return fmt.Errorf("unable to get all notifications. This should not happen. %v", err)
 	}
 
 	var filteredModels []models.NotificationDatabaseModel
+	var filteredCountries []string
 	for _, model := range databaseModels {
-
-		// Skip non-matching or non-empty country
-		if model.Country != "" && model.Country != country {
-			continue
-		}
-
-		// Skip non-matching event or non-empty event
-		if model.Event != "" && event != model.Event {
+		country, ok := matchingCountry(model, countries, event)
+		if !ok {
 			continue
 		}
 
 		filteredModels = append(filteredModels, model)
+		filteredCountries = append(filteredCountries, country)
 	}
 
 	// Send notification to all registered URLs
 	if len(filteredModels) > 0 {
 		// Create a HTTP post request
-		for _, model := range filteredModels {
-			err = sendNotification(model)
+		for i, model := range filteredModels {
+			invocation.Country = filteredCountries[i]
+			err = sendNotification(model, invocation)
 			if err != nil {
 				// Something went wrong with sending the notification to the client
 				log.Println("assignments02/notifications/invocations.go: Function InvokeEvent() failed, to send notification to client.")
@@ -75,16 +92,32 @@ func InvokeEvent(country string, event string) error {
 	return nil
 }
 
-// sendNotification is an internal function that sends POST request to a notification's URL.
-func sendNotification(n models.NotificationDatabaseModel) error {
-	// Select attributes to send to the client
-	out := models.InvocationNotificationModel{
-		Id:      n.Id,
-		Country: n.Country,
-		Event:   n.Event,
-		Time:    time.Now(),
-	}
+// InvokeThreshold sends a THRESHOLD notification, telling the subscriber that one of its conditions started or
+// stopped holding for a country. The notification is sent no matter its filter, so the callee must check it.
+//
+// Parameters:
+// - n: the THRESHOLD notification to send to.
+// - country: the ISO code of the country the condition was checked for.
+// - state: the condition, the value it was checked against and whether it holds.
+func InvokeThreshold(n models.NotificationDatabaseModel, country string, state models.ThresholdState) error {
+	return postNotification(n, models.InvocationNotificationModel{
+		Id:        n.Id,
+		Country:   country,
+		Event:     util.EVENT_THRESHOLD,
+		Time:      time.Now(),
+		Threshold: &state,
+	})
+}
+
+// sendNotification is an internal function that sends POST request to a notification's URL. The invocation is sent
+// with the ID of the notification.
+func sendNotification(n models.NotificationDatabaseModel, invocation models.InvocationNotificationModel) error {
+	invocation.Id = n.Id
+	return postNotification(n, invocation)
+}
 
+// postNotification is an internal function that sends an invocation to a notification's URL.
+func postNotification(n models.NotificationDatabaseModel, out models.InvocationNotificationModel) error {
 	marshalledOutput, err := json.Marshal(out)
 	if err != nil {
 		return fmt.Errorf("failed to unmarshal notification by id: %v", n.Id)
@@ -101,7 +134,7 @@ func sendNotification(n models.NotificationDatabaseModel) error {
 	client := &http.Client{}
 	res, err := client.Do(r)
 	if err != nil {
-		return fmt.Errorf("invocation [%v] was unable to reach the client URL at: %v", n.Event, n.Url)
+		return fmt.Errorf("invocation [%v] was unable to reach the client URL at: %v", out.Event, n.Url)
 	}
 
 	defer func(Body io.ReadCloser) {
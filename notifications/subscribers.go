@@ -0,0 +1,100 @@
+package notifications
+
+import (
+	"assignment2/models"
+	"sync"
+)
+
+// subscriberBuffer is the number of events a subscriber may fall behind before new events are dropped for it.
+const subscriberBuffer = 16
+
+// subscriber is a listener inside this process that receives events invoked by InvokeEvent.
+type subscriber struct {
+	filter models.NotificationDatabaseModel
+	events chan models.InvocationNotificationModel
+}
+
+var (
+	subscribers      = map[*subscriber]struct{}{}
+	subscribersMutex sync.Mutex
+)
+
+// Subscribe registers a listener for events invoked by InvokeEvent. It receives the same events as a webhook with the
+// same filter would, without a callback URL. The filter's URL is ignored, and its ID is used as the ID of the events.
+//
+// # Example
+//
+// events, unsubscribe := notifications.Subscribe(models.NotificationDatabaseModel{Country: "NO"})
+// defer unsubscribe()
+//
+// Output: every event invoked for "NO" is received on the events channel until unsubscribe is called.
+//
+// A subscriber that falls behind misses events rather than blocking InvokeEvent. unsubscribe closes the channel.
+func Subscribe(filter models.NotificationDatabaseModel) (<-chan models.InvocationNotificationModel, func()) {
+	s := &subscriber{filter: filter, events: make(chan models.InvocationNotificationModel, subscriberBuffer)}
+
+	subscribersMutex.Lock()
+	subscribers[s] = struct{}{}
+	subscribersMutex.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			subscribersMutex.Lock()
+			delete(subscribers, s)
+			subscribersMutex.Unlock()
+			close(s.events)
+		})
+	}
+	return s.events, unsubscribe
+}
+
+// publish sends an event about one or more countries to every subscriber with a matching filter, once, with the ID of
+// the subscriber's filter and the country it matched. See matchingCountry.
+func publish(countries []string, invocation models.InvocationNotificationModel) {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+
+	for s := range subscribers {
+		country, ok := matchingCountry(s.filter, countries, invocation.Event)
+		if !ok {
+			continue
+		}
+
+		event := invocation
+		event.Id = s.filter.Id
+		event.Country = country
+		select {
+		case s.events <- event:
+		default:
+			// The subscriber is not keeping up. The event is dropped rather than blocking the caller.
+		}
+	}
+}
+
+// matchingCountry finds the first of the countries of an event that a notification matches. A notification without a
+// country matches the first one, so it is only sent the event once.
+func matchingCountry(model models.NotificationDatabaseModel, countries []string, event string) (string, bool) {
+	for _, country := range countries {
+		if matches(model, country, event) {
+			return country, true
+		}
+	}
+	return "", false
+}
+
+// matches checks whether an event should be sent to a notification. An empty country or event on the notification
+// matches any country or event.
+func matches(model models.NotificationDatabaseModel, country string, event string) bool {
+	// Skip non-matching or non-empty country
+	if model.Country != "" && model.Country != country {
+		return false
+	}
+
+	// Skip non-matching event or non-empty event
+	if model.Event != "" && event != model.Event {
+		return false
+	}
+
+	return true
+}
@@ -21,6 +21,9 @@ func DatabaseStub() {
 	dbMux := http.NewServeMux()
 	dbMux.HandleFunc(util.REGISTRATION_PATH, stubs.DatabaseDashboardHandler)
 	dbMux.HandleFunc(util.NOTIFICATION_PATH, stubs.DatabaseNotificationHandler)
+	dbMux.HandleFunc(util.TEMPLATE_PATH, stubs.DatabaseTemplateHandler)
+	dbMux.HandleFunc(util.STUB_SNAPSHOTS_PATH, stubs.DatabaseSnapshotHandler)
+	dbMux.HandleFunc(util.STUB_SHARES_PATH, stubs.DatabaseShareHandler)
 
 	log.Println("Database Stub Service is listening on port: " + util.DATABASE_PORT)
 	log.Fatal(http.ListenAndServe(":"+util.DATABASE_PORT, dbMux))
@@ -0,0 +1,21 @@
+package stubs
+
+import (
+	stubHandler "assignment2/stubs/handler"
+	"assignment2/util"
+	"log"
+	"net/http"
+)
+
+// ECB_stub starts a stub-service, listening on a specific port
+// to return mocked information, which is stored in an XML-file and is
+// an old response-body from the European Central Bank's daily euro
+// reference rates, to the client instead of sending a request to the
+// actual service.
+func ECB_stub() {
+	ecbMux := http.NewServeMux()
+	ecbMux.HandleFunc("/", stubHandler.StubECBHandler)
+
+	log.Println("ECB Stub Service is listening on port: " + util.ECB_PORT)
+	log.Fatal(http.ListenAndServe(":"+util.ECB_PORT, ecbMux))
+}
@@ -0,0 +1,130 @@
+package stubs
+
+import (
+	"assignment2/util"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// stubCollection is a collection of the database stub that is stored in a JSON file. The file holds JSON arrays of
+// documents, like the files of the other collections, followed by the documents that were added one by one, so adding
+// a document appends it to the file instead of rewriting the file.
+//
+// The stub serves requests concurrently, so the file is only read and written while the mutex is held.
+type stubCollection[T any] struct {
+	file  *string // file is the path of the JSON file. It is a pointer, as util.FixStubPaths changes the paths.
+	mutex sync.Mutex
+}
+
+// all reads every document of the collection. A missing file has no documents.
+func (c *stubCollection[T]) all() ([]T, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.read()
+}
+
+// add appends a document to the collection.
+func (c *stubCollection[T]) add(document T) error {
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("error marshalling data")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	file, err := os.OpenFile(*c.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("unable to open database file")
+	}
+	if _, err := file.Write(append(encoded, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("unable to write database file")
+	}
+	return file.Close()
+}
+
+// update replaces the documents of the collection by the documents change returns. The file is only rewritten if
+// change tells that something changed. change is called while the mutex is held.
+func (c *stubCollection[T]) update(change func(documents []T) ([]T, bool)) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	documents, err := c.read()
+	if err != nil {
+		return err
+	}
+	documents, changed := change(documents)
+	if !changed {
+		return nil
+	}
+
+	encoded, err := json.Marshal(documents)
+	if err != nil {
+		return fmt.Errorf("error marshalling data")
+	}
+	if err := os.WriteFile(*c.file, encoded, 0666); err != nil {
+		return fmt.Errorf("unable to write database file")
+	}
+	return nil
+}
+
+// read reads every document of the collection. c.mutex must be held.
+func (c *stubCollection[T]) read() ([]T, error) {
+	file, err := os.Open(*c.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return []T{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read database file")
+	}
+	defer file.Close()
+
+	documents := []T{}
+	decoder := json.NewDecoder(file)
+	for {
+		var value json.RawMessage
+		err := decoder.Decode(&value)
+		if errors.Is(err, io.EOF) {
+			return documents, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshalling data")
+		}
+
+		value = bytes.TrimSpace(value)
+		switch {
+		case bytes.Equal(value, []byte("null")):
+		case bytes.HasPrefix(value, []byte("[")):
+			var batch []T
+			if err := json.Unmarshal(value, &batch); err != nil {
+				return nil, fmt.Errorf("error unmarshalling data")
+			}
+			documents = append(documents, batch...)
+		default:
+			var document T
+			if err := json.Unmarshal(value, &document); err != nil {
+				return nil, fmt.Errorf("error unmarshalling data")
+			}
+			documents = append(documents, document)
+		}
+	}
+}
+
+// writeStubJSON writes a response of the database stub as JSON.
+func writeStubJSON(w http.ResponseWriter, status int, response any) {
+	w.Header().Set(util.CONTENT_TYPE, util.MIMETYPE_JSON)
+	w.Header().Set(util.X_CONTENT_TYPE_OPTION, "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("failed to return marshalled object. %v", err)
+	}
+}
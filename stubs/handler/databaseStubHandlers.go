@@ -3,7 +3,6 @@ package stubs
 import (
 	myCrypto "assignment2/crypto"
 	"assignment2/models"
-	"assignment2/notifications"
 	"assignment2/util"
 	"encoding/json"
 	"fmt"
@@ -287,11 +286,6 @@ func stub_handleRegistrationPutRequest(w http.ResponseWriter, r *http.Request, i
 	//sets the "new" registration to the same id as url
 	registration.ID = id
 
-	// Invoke notification event for changing a registration
-	if err := notifications.InvokeEvent(registration.IsoCode, util.EVENT_CHANGE); err != nil {
-		log.Println("Error invoking event:", err)
-	}
-
 	// Update registration on the database
 	var allRegistrations []util.Registration
 	if err := json.Unmarshal(file, &allRegistrations); err != nil {
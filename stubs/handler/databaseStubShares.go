@@ -0,0 +1,114 @@
+package stubs
+
+import (
+	"assignment2/util"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// shares is the share collection of the database stub. A share is appended to the file when it is created.
+var shares = stubCollection[util.Share]{file: &util.STUB_DATABASE_SHARES}
+
+// DatabaseShareHandler is the stub entry point for the share links of dashboards.
+// It handles the following:
+// - Retrieving the share by the ID in the path, or the shares of the registration in the 'registrationId' parameter
+// - Adding a share to the database
+// - Deleting the share by the ID in the path, the shares of the registration in the 'registrationId' parameter, or
+// the shares that expired at or before the time in the 'expiredBefore' parameter (RFC 3339)
+//
+// If an illegal method is used, an appropriate message is sent to the client.
+func DatabaseShareHandler(w http.ResponseWriter, r *http.Request) {
+	id, _ := util.SplitResourcePath(r.URL.Path, util.STUB_SHARES_PATH)
+
+	switch r.Method {
+	case http.MethodGet:
+		stub_getShares(w, r, id)
+	case http.MethodPost:
+		var share util.Share
+		if err := json.NewDecoder(r.Body).Decode(&share); err != nil {
+			util.HttpError(w, "could not parse body. "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := shares.add(share); err != nil {
+			log.Println("Failed to add share:", err)
+			util.HttpError(w, "failed to add share", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		stub_deleteShares(w, r, id)
+	default:
+		util.HttpError(w, "This method is not supported! Only POST, GET and DELETE are supported",
+			http.StatusMethodNotAllowed)
+	}
+}
+
+// stub_getShares returns the share by an ID if it is not empty, or else the shares of a registration.
+func stub_getShares(w http.ResponseWriter, r *http.Request, id string) {
+	allShares, err := shares.all()
+	if err != nil {
+		log.Println("Failed to get shares:", err)
+		util.HttpError(w, "failed to get shares", http.StatusInternalServerError)
+		return
+	}
+
+	if id != "" {
+		for _, share := range allShares {
+			if share.ID == id {
+				writeStubJSON(w, http.StatusOK, share)
+				return
+			}
+		}
+		util.HttpError(w, "share not found", http.StatusNotFound)
+		return
+	}
+
+	out := []util.Share{}
+	for _, share := range allShares {
+		if share.RegistrationID == r.URL.Query().Get("registrationId") {
+			out = append(out, share)
+		}
+	}
+	writeStubJSON(w, http.StatusOK, out)
+}
+
+// stub_deleteShares deletes the share by an ID if it is not empty, or else the shares of a registration, or the
+// shares that have expired.
+func stub_deleteShares(w http.ResponseWriter, r *http.Request, id string) {
+	query := r.URL.Query()
+	expiredBefore, err := parseStubTime(query.Get("expiredBefore"))
+	if err != nil {
+		util.HttpError(w, "'expiredBefore' must be an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+
+	var deleted func(share util.Share) bool
+	switch {
+	case id != "":
+		deleted = func(share util.Share) bool { return share.ID == id }
+	case query.Has("registrationId"):
+		deleted = func(share util.Share) bool { return share.RegistrationID == query.Get("registrationId") }
+	case !expiredBefore.IsZero():
+		deleted = func(share util.Share) bool { return !share.Expires.After(expiredBefore) }
+	default:
+		util.HttpError(w, "a share ID, 'registrationId' or 'expiredBefore' is required", http.StatusBadRequest)
+		return
+	}
+
+	err = shares.update(func(allShares []util.Share) ([]util.Share, bool) {
+		kept := make([]util.Share, 0, len(allShares))
+		for _, share := range allShares {
+			if !deleted(share) {
+				kept = append(kept, share)
+			}
+		}
+		return kept, len(kept) != len(allShares)
+	})
+	if err != nil {
+		log.Println("Failed to delete shares:", err)
+		util.HttpError(w, "failed to delete shares", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
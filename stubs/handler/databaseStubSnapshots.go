@@ -0,0 +1,108 @@
+package stubs
+
+import (
+	"assignment2/util"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// snapshots is the snapshot collection of the database stub. A snapshot is appended to the file when it is taken.
+var snapshots = stubCollection[util.Snapshot]{file: &util.STUB_DATABASE_SNAPSHOTS}
+
+// DatabaseSnapshotHandler is the stub entry point for the snapshots of dashboards.
+// It handles the following:
+// - Retrieving the snapshots of the registration in the 'registrationId' parameter, taken between the times in the
+// 'from' and 'to' parameters (RFC 3339), if they are given
+// - Adding a snapshot to the database
+// - Deleting every snapshot taken before the time in the 'before' parameter (RFC 3339). Responds with the number of
+// deleted snapshots: {"deleted": 2}
+//
+// If an illegal method is used, an appropriate message is sent to the client.
+func DatabaseSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		stub_getSnapshots(w, r)
+	case http.MethodPost:
+		var snapshot util.Snapshot
+		if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+			util.HttpError(w, "could not parse body. "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := snapshots.add(snapshot); err != nil {
+			log.Println("Failed to add snapshot:", err)
+			util.HttpError(w, "failed to add snapshot", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		stub_deleteSnapshotsBefore(w, r)
+	default:
+		util.HttpError(w, "This method is not supported! Only POST, GET and DELETE are supported",
+			http.StatusMethodNotAllowed)
+	}
+}
+
+// stub_getSnapshots returns the snapshots of a registration taken between two times, in the order they were added.
+func stub_getSnapshots(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, fromErr := parseStubTime(query.Get("from"))
+	to, toErr := parseStubTime(query.Get("to"))
+	if fromErr != nil || toErr != nil {
+		util.HttpError(w, "'from' and 'to' must be RFC 3339 times", http.StatusBadRequest)
+		return
+	}
+
+	allSnapshots, err := snapshots.all()
+	if err != nil {
+		log.Println("Failed to get snapshots:", err)
+		util.HttpError(w, "failed to get snapshots", http.StatusInternalServerError)
+		return
+	}
+
+	out := []util.Snapshot{}
+	for _, snapshot := range allSnapshots {
+		if snapshot.RegistrationId == query.Get("registrationId") &&
+			(from.IsZero() || !snapshot.Time.Before(from)) && (to.IsZero() || !snapshot.Time.After(to)) {
+			out = append(out, snapshot)
+		}
+	}
+	writeStubJSON(w, http.StatusOK, out)
+}
+
+// stub_deleteSnapshotsBefore deletes every snapshot taken before a time, no matter which registration it belongs to.
+func stub_deleteSnapshotsBefore(w http.ResponseWriter, r *http.Request) {
+	before, err := parseStubTime(r.URL.Query().Get("before"))
+	if err != nil || before.IsZero() {
+		util.HttpError(w, "'before' must be an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+
+	deleted := 0
+	err = snapshots.update(func(allSnapshots []util.Snapshot) ([]util.Snapshot, bool) {
+		kept := make([]util.Snapshot, 0, len(allSnapshots))
+		for _, snapshot := range allSnapshots {
+			if snapshot.Time.Before(before) {
+				deleted++
+			} else {
+				kept = append(kept, snapshot)
+			}
+		}
+		return kept, deleted > 0
+	})
+	if err != nil {
+		log.Println("Failed to delete snapshots:", err)
+		util.HttpError(w, "failed to delete snapshots", http.StatusInternalServerError)
+		return
+	}
+	writeStubJSON(w, http.StatusOK, map[string]int{"deleted": deleted})
+}
+
+// parseStubTime parses a time in a query parameter of the database stub. An empty parameter is the zero time.
+func parseStubTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
@@ -0,0 +1,100 @@
+package stubs
+
+import (
+	"assignment2/util"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// templates is the template collection of the database stub.
+var templates = stubCollection[util.Template]{file: &util.STUB_DATABASE_TEMPLATES}
+
+// DatabaseTemplateHandler is the stub entry point for registration templates. Templates are stored by their name.
+// It handles the following:
+// - Retrieving every template, or the template by the name in the path
+// - Storing the template by the name in the path, replacing a template by the same name
+// - Deleting the template by the name in the path
+//
+// If an illegal method is used, an appropriate message is sent to the client.
+func DatabaseTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	name, _ := util.SplitResourcePath(r.URL.Path, util.TEMPLATE_PATH)
+	if name == "" && r.Method != http.MethodGet {
+		util.HttpError(w, "a template name is required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		stub_getTemplates(w, name)
+	case http.MethodPut:
+		stub_setTemplate(w, r, name)
+	case http.MethodDelete:
+		err := templates.update(func(allTemplates []util.Template) ([]util.Template, bool) {
+			kept := make([]util.Template, 0, len(allTemplates))
+			for _, template := range allTemplates {
+				if template.Name != name {
+					kept = append(kept, template)
+				}
+			}
+			return kept, len(kept) != len(allTemplates)
+		})
+		if err != nil {
+			log.Println("Failed to delete template:", err)
+			util.HttpError(w, "failed to delete template", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		util.HttpError(w, "This method is not supported! Only GET, PUT and DELETE are supported",
+			http.StatusMethodNotAllowed)
+	}
+}
+
+// stub_getTemplates returns every template, or the template by a name if it is not empty.
+func stub_getTemplates(w http.ResponseWriter, name string) {
+	allTemplates, err := templates.all()
+	if err != nil {
+		log.Println("Failed to get templates:", err)
+		util.HttpError(w, "failed to get templates", http.StatusInternalServerError)
+		return
+	}
+
+	if name == "" {
+		writeStubJSON(w, http.StatusOK, allTemplates)
+		return
+	}
+	for _, template := range allTemplates {
+		if template.Name == name {
+			writeStubJSON(w, http.StatusOK, template)
+			return
+		}
+	}
+	util.HttpError(w, "template not found", http.StatusNotFound)
+}
+
+// stub_setTemplate stores a template by a name, replacing a template by the same name.
+func stub_setTemplate(w http.ResponseWriter, r *http.Request, name string) {
+	var template util.Template
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		util.HttpError(w, "could not parse body. "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	template.Name = name
+
+	err := templates.update(func(allTemplates []util.Template) ([]util.Template, bool) {
+		for i, stored := range allTemplates {
+			if stored.Name == name {
+				allTemplates[i] = template
+				return allTemplates, true
+			}
+		}
+		return append(allTemplates, template), true
+	})
+	if err != nil {
+		log.Println("Failed to store template:", err)
+		util.HttpError(w, "failed to store template", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,21 +2,80 @@ package stubs
 
 import (
 	"assignment2/util"
+	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
 )
 
 // StubCountryHandler returns a mocked response from the content of the file country.json.
 // It handles the following methods:
 // - GET: Returns mocked Country information.
+//
+// Like the real service, /alpha/{code} only returns the country with a matching ISO 3166-1 alpha-2 or alpha-3 code,
+// and /name/{name} only returns the country with a matching common or official name (as with ?fullText=true).
+// Every other path returns all the mocked countries.
 func StubCountryHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		log.Println("Received " + r.Method + " request on Country stub handler. Returning mocked information")
 		w.Header().Add("content-type", "application/json")
 		response := util.ParseFile(util.STUB_COUNTRY_RESPONSE) // Get the content of the file.
+
+		segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(segments) == 2 && segments[0] == "alpha" {
+			response = filterCountries(w, response, func(country map[string]any) bool {
+				cca2, _ := country["cca2"].(string)
+				cca3, _ := country["cca3"].(string)
+				return strings.EqualFold(cca2, segments[1]) || strings.EqualFold(cca3, segments[1])
+			})
+			if response == nil {
+				return
+			}
+		} else if len(segments) == 2 && segments[0] == "name" {
+			response = filterCountries(w, response, func(country map[string]any) bool {
+				name, _ := country["name"].(map[string]any)
+				common, _ := name["common"].(string)
+				official, _ := name["official"].(string)
+				return strings.EqualFold(common, segments[1]) || strings.EqualFold(official, segments[1])
+			})
+			if response == nil {
+				return
+			}
+		}
+
 		http.Error(w, string(response), http.StatusOK)
 	default:
 		http.Error(w, "Method not supported!", http.StatusNotImplemented)
 	}
 }
+
+// filterCountries keeps only the mocked countries that match. If no country matches, the same error as the real
+// service is written to the client and nil is returned.
+func filterCountries(w http.ResponseWriter, content []byte, match func(map[string]any) bool) []byte {
+	var countries []map[string]any
+	if err := json.Unmarshal(content, &countries); err != nil {
+		log.Println("Failed to decode the mocked countries:", err)
+		http.Error(w, "{\"status\": 500, \"message\": \"Internal Server Error\"}", http.StatusInternalServerError)
+		return nil
+	}
+
+	var matching []map[string]any
+	for _, country := range countries {
+		if match(country) {
+			matching = append(matching, country)
+		}
+	}
+	if len(matching) == 0 {
+		http.Error(w, "{\"status\": 404, \"message\": \"Not Found\"}", http.StatusNotFound)
+		return nil
+	}
+
+	out, err := json.Marshal(matching)
+	if err != nil {
+		log.Println("Failed to encode the mocked countries:", err)
+		http.Error(w, "{\"status\": 500, \"message\": \"Internal Server Error\"}", http.StatusInternalServerError)
+		return nil
+	}
+	return out
+}
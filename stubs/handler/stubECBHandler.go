@@ -0,0 +1,22 @@
+package stubs
+
+import (
+	"assignment2/util"
+	"log"
+	"net/http"
+)
+
+// StubECBHandler returns a mocked response from the content of the file ecb.xml.
+// It handles the following methods:
+// - GET: Returns mocked euro reference rates.
+func StubECBHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		log.Println("Received " + r.Method + " request on ECB stub handler. Returning mocked information")
+		w.Header().Set(util.CONTENT_TYPE, "text/xml")
+		response := util.ParseFile(util.STUB_ECB_RESPONSE) // Get the content of the file.
+		_, _ = w.Write(response)
+	default:
+		http.Error(w, "Method not supported!", http.StatusNotImplemented)
+	}
+}
@@ -0,0 +1,22 @@
+package stubs
+
+import (
+	"assignment2/util"
+	"log"
+	"net/http"
+)
+
+// StubMetNorwayHandler returns a mocked response from the content of the file metnorway.json.
+// It handles the following methods:
+// - GET: Returns mocked Weather information in MET Norway's compact format.
+func StubMetNorwayHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		log.Println("Received " + r.Method + " request on MET Norway stub handler. Returning mocked information")
+		w.Header().Add("content-type", "application/json")
+		response := util.ParseFile(util.STUB_MET_NORWAY_RESPONSE) // Get the content of the file.
+		http.Error(w, string(response), http.StatusOK)
+	default:
+		http.Error(w, "Method not supported!", http.StatusNotImplemented)
+	}
+}
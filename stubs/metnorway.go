@@ -0,0 +1,20 @@
+package stubs
+
+import (
+	stubHandler "assignment2/stubs/handler"
+	"assignment2/util"
+	"log"
+	"net/http"
+)
+
+// MetNorway_stub starts a stub-service, listening on a specific port
+// to return mocked information, which is stored in a JSON-file and is
+// an old response-body from MET Norway's Locationforecast API, to the
+// client instead of sending a request to the actual service.
+func MetNorway_stub() {
+	metNorwayMux := http.NewServeMux()
+	metNorwayMux.HandleFunc("/", stubHandler.StubMetNorwayHandler)
+
+	log.Println("MET Norway Stub Service is listening on port: " + util.MET_NORWAY_PORT)
+	log.Fatal(http.ListenAndServe(":"+util.MET_NORWAY_PORT, metNorwayMux))
+}
@@ -0,0 +1,151 @@
+package upstream
+
+import (
+	"assignment2/util"
+	"errors"
+	"sync"
+	"time"
+)
+
+// States of a circuit breaker.
+const (
+	BREAKER_CLOSED    = "closed"    // Requests are sent to the service.
+	BREAKER_OPEN      = "open"      // Requests fail at once, without being sent.
+	BREAKER_HALF_OPEN = "half-open" // One request at a time probes whether the service is back.
+)
+
+// Defaults of the circuit breakers, used until Configure is called.
+const (
+	DEFAULT_BREAKER_THRESHOLD = 5
+	DEFAULT_BREAKER_COOLDOWN  = 30 * time.Second
+)
+
+// PROBE_RETRY_AFTER is how long a request that is refused while the breaker is half-open is told to wait. The probe
+// closes or opens the breaker again within the time limit of a request.
+const PROBE_RETRY_AFTER = time.Second
+
+// Breaker is a circuit breaker that stops requests to a service that keeps failing, so requests fail fast instead of
+// waiting for the service's time limit.
+//
+// # Description
+//
+// The breaker is closed while the service works. After 'Threshold' failures in a row it opens, and requests fail
+// with ErrCircuitOpen. When 'Cooldown' has passed, the breaker is half-open: one request is let through as a probe.
+// The breaker closes if the probe passes, and opens again if it fails.
+//
+// Only failures of the service itself count: timeouts, unreachable services, 5xx and 429 responses, and invalid
+// responses. A 404 Not Found means the service works.
+type Breaker struct {
+	Threshold int           // Threshold is the number of failures in a row that opens the breaker.
+	Cooldown  time.Duration // Cooldown is how long the breaker stays open before it lets a probe through.
+
+	mutex         sync.Mutex
+	state         string
+	probing       bool
+	failures      int
+	totalFailures int
+	lastError     string
+	lastFailure   time.Time
+	openedAt      time.Time
+}
+
+// newBreaker creates a closed breaker with the default settings.
+func newBreaker() *Breaker {
+	return &Breaker{
+		Threshold: DEFAULT_BREAKER_THRESHOLD,
+		Cooldown:  DEFAULT_BREAKER_COOLDOWN,
+		state:     BREAKER_CLOSED,
+	}
+}
+
+// allow asks the breaker whether a request may be sent. A request that is allowed must be followed by a call to done.
+//
+// Returns:
+// - nil if the request may be sent.
+// - ErrCircuitOpen if the breaker is open, or another request is probing the service, with the time until a request
+// may be let through. That is the rest of the cooldown, or PROBE_RETRY_AFTER while a probe is sent.
+func (b *Breaker) allow() (time.Duration, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case BREAKER_OPEN:
+		if remaining := b.Cooldown - time.Since(b.openedAt); remaining > 0 {
+			return remaining, ErrCircuitOpen
+		}
+		b.state = BREAKER_HALF_OPEN
+		fallthrough
+	case BREAKER_HALF_OPEN:
+		if b.probing {
+			return PROBE_RETRY_AFTER, ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return 0, nil
+}
+
+// done tells the breaker the result of a request it allowed. Requests that were cancelled by the caller have no
+// result, and only let another request probe the service.
+func (b *Breaker) done(err error, cancelled bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.probing = false
+	switch {
+	case cancelled:
+		return
+	case !isFailure(err):
+		b.state = BREAKER_CLOSED
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	b.totalFailures++
+	b.lastError = err.Error()
+	b.lastFailure = time.Now()
+
+	// A failed probe opens the breaker again at once
+	if b.state == BREAKER_HALF_OPEN || b.failures >= b.Threshold {
+		b.state = BREAKER_OPEN
+		b.openedAt = b.lastFailure
+	}
+}
+
+// Status returns the state of the breaker and its failures.
+func (b *Breaker) Status() util.BreakerStatus {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	status := util.BreakerStatus{
+		State:         b.state,
+		Failures:      b.failures,
+		TotalFailures: b.totalFailures,
+		LastError:     b.lastError,
+	}
+	if !b.lastFailure.IsZero() {
+		lastFailure := b.lastFailure
+		status.LastFailure = &lastFailure
+	}
+	if b.state == BREAKER_OPEN {
+		openUntil := b.openedAt.Add(b.Cooldown)
+		status.OpenUntil = &openUntil
+	}
+	return status
+}
+
+// Reset closes the breaker and forgets its failures.
+func (b *Breaker) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.state = BREAKER_CLOSED
+	b.probing = false
+	b.failures, b.totalFailures = 0, 0
+	b.lastError, b.lastFailure, b.openedAt = "", time.Time{}, time.Time{}
+}
+
+// isFailure checks whether an error is a failure of the service itself.
+func isFailure(err error) bool {
+	return errors.Is(err, ErrUnavailable) || errors.Is(err, ErrTimeout) || errors.Is(err, ErrInvalidResponse)
+}
@@ -0,0 +1,79 @@
+package upstream
+
+import (
+	"context"
+	"time"
+)
+
+// DEFAULT_CACHE_TTL is how long a response is served from the cache, used until Configure is called. The cache is off
+// unless a cache_ttl is configured.
+const DEFAULT_CACHE_TTL time.Duration = 0
+
+// Caching checks whether the cache of any upstream service is on. See Client.CacheTTL.
+func Caching() bool {
+	clients := []*Client{Countries.Client, Weather.Client, MetNorway.Client, Currencies.Client, ECB.Client}
+	for _, client := range clients {
+		if client.CacheTTL > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheEntry is a response body in the cache of a client.
+type cacheEntry struct {
+	body   []byte
+	stored time.Time
+}
+
+// refreshKey is the context key of WithRefresh.
+type refreshKey struct{}
+
+// WithRefresh returns a context whose requests skip the cache, and store their response in it. It is used to keep
+// the cache warm before the entries expire.
+func WithRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, refreshKey{}, true)
+}
+
+// refreshing checks whether the requests of a context skip the cache. See WithRefresh.
+func refreshing(ctx context.Context) bool {
+	refresh, _ := ctx.Value(refreshKey{}).(bool)
+	return refresh
+}
+
+// cached returns the body of a response in the cache, if it has not expired.
+func (c *Client) cached(key string) ([]byte, bool) {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+
+	entry, ok := c.cache[key]
+	if !ok || c.CacheTTL <= 0 || time.Since(entry.stored) >= c.CacheTTL {
+		return nil, false
+	}
+	return entry.body, true
+}
+
+// store stores the body of a response in the cache, and removes the entries that have expired.
+func (c *Client) store(key string, body []byte) {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+
+	if c.CacheTTL <= 0 {
+		return
+	}
+	now := time.Now()
+	for oldKey, entry := range c.cache {
+		if now.Sub(entry.stored) >= c.CacheTTL {
+			delete(c.cache, oldKey)
+		}
+	}
+	c.cache[key] = cacheEntry{body: body, stored: now}
+}
+
+// ClearCache removes every response from the cache.
+func (c *Client) ClearCache() {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+
+	c.cache = map[string]cacheEntry{}
+}
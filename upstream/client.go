@@ -0,0 +1,470 @@
+// upstream package has a client for each of the upstream services: REST Countries, Open-Meteo and MET Norway for
+// weather forecasts, and the Currency API and the European Central Bank for exchange rates.
+//
+// Every request has a time limit, and failed requests are retried with a growing, randomized wait between the
+// attempts. Failures are returned as an *Error, so handlers can tell a missing resource from a service that is down.
+// Services that are stubbed in config.yaml are requested from the stub service instead.
+package upstream
+
+import (
+	"assignment2/util"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	neturl "net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of the clients, used until Configure is called.
+const (
+	DEFAULT_TIMEOUT    = 10 * time.Second
+	DEFAULT_ATTEMPTS   = 3
+	DEFAULT_RETRY_WAIT = 200 * time.Millisecond
+
+	// MAX_RETRY_WAIT limits the wait between attempts, including waits asked for with Retry-After.
+	MAX_RETRY_WAIT = 5 * time.Second
+	// MAX_RESPONSE_SIZE limits how much of a response is read.
+	MAX_RESPONSE_SIZE = 16 << 20
+)
+
+// Client requests JSON from an upstream service.
+type Client struct {
+	Name      string        // Name is the name of the service in errors. Example: "REST Countries"
+	URL       string        // URL is the base URL of the real service.
+	Timeout   time.Duration // Timeout is the time limit of each attempt.
+	Attempts  int           // Attempts is the number of tries of a request. Only failures that may pass are retried.
+	RetryWait time.Duration // RetryWait is the wait before the first retry. It doubles for every retry.
+	Breaker   *Breaker      // Breaker stops requests while the service keeps failing.
+	UserAgent string        // UserAgent identifies the service in the requests, if it is set.
+	CacheTTL  time.Duration // CacheTTL is how long responses are served from the cache. Not positive turns it off.
+
+	// stub returns the URL of the stub service, and whether the service is stubbed. It is checked on every request,
+	// as the stub configuration and ports are set after the clients are created.
+	stub func() (string, bool)
+	http *http.Client
+
+	flights      map[string]*flight // flights are the requests in flight, by their key. See get.
+	flightsMutex sync.Mutex
+	cache        map[string]cacheEntry // cache holds the latest response of each request. See CacheTTL.
+	cacheMutex   sync.Mutex
+	calls        atomic.Int64 // calls is the number of calls to Get and GetXML.
+	cacheHits    atomic.Int64 // cacheHits is the number of calls that were served from the cache.
+	requests     atomic.Int64 // requests is the number of attempts sent to the service.
+	coalesced    atomic.Int64 // coalesced is the number of calls that shared the response of another call.
+}
+
+// newClient creates a client with the default settings.
+func newClient(name string, url string, stub func() (string, bool)) *Client {
+	return &Client{
+		Name:      name,
+		URL:       url,
+		Timeout:   DEFAULT_TIMEOUT,
+		Attempts:  DEFAULT_ATTEMPTS,
+		RetryWait: DEFAULT_RETRY_WAIT,
+		Breaker:   newBreaker(),
+		CacheTTL:  DEFAULT_CACHE_TTL,
+		stub:      stub,
+		http:      &http.Client{},
+		flights:   map[string]*flight{},
+		cache:     map[string]cacheEntry{},
+	}
+}
+
+// flight is a request that is in flight, and is shared by every identical call until it is done.
+type flight struct {
+	done    chan struct{}      // done is closed when body and err are set.
+	body    []byte             // body is the body of the response.
+	err     error              // err is the error of the request.
+	waiters int                // waiters is the number of callers that wait for the request.
+	cancel  context.CancelFunc // cancel cancels the request.
+
+	// deadlines are the deadlines of the callers that wait for the request, for the callers that have one.
+	deadlines []time.Time
+}
+
+// Configure applies the settings in config.yaml to the clients. It must be called after util.InitializeConfig.
+//
+// Returns:
+// - An error if the weather provider or a currency provider in config.yaml is unknown.
+func Configure() error {
+	Countries.configure(util.Config.Upstreams.RestCountries)
+	Weather.configure(util.Config.Upstreams.Weather)
+	MetNorway.configure(util.Config.Upstreams.MetNorway)
+	Currencies.configure(util.Config.Upstreams.Currencies)
+	ECB.configure(util.Config.Upstreams.ECB)
+
+	SetRateLimits(util.Config.Upstreams.RateLimit, util.Config.Upstreams.HostRateLimits,
+		util.Config.Upstreams.QueueTimeout)
+
+	if err := SetWeatherProvider(util.Config.Upstreams.WeatherProvider); err != nil {
+		return err
+	}
+	return SetCurrencyProviders(util.Config.Upstreams.CurrencyProviders...)
+}
+
+// configure applies the settings of a service in config.yaml. Settings that are not set keep their current value.
+func (c *Client) configure(config util.UpstreamConfig) {
+	if config.BaseURL != "" {
+		c.URL = config.BaseURL
+	}
+	if config.Timeout > 0 {
+		c.Timeout = config.Timeout
+	}
+	if config.Attempts > 0 {
+		c.Attempts = config.Attempts
+	}
+	if config.BreakerThreshold > 0 {
+		c.Breaker.Threshold = config.BreakerThreshold
+	}
+	if config.BreakerCooldown > 0 {
+		c.Breaker.Cooldown = config.BreakerCooldown
+	}
+	if config.UserAgent != "" {
+		c.UserAgent = config.UserAgent
+	}
+	if config.CacheTTL != 0 {
+		c.CacheTTL = config.CacheTTL
+	}
+}
+
+// Metrics returns the number of calls to the client, how many of them were served from the cache or shared the
+// response of another call, and the number of requests that were sent.
+func (c *Client) Metrics() util.UpstreamMetrics {
+	return util.UpstreamMetrics{
+		Calls:     c.calls.Load(),
+		CacheHits: c.cacheHits.Load(),
+		Coalesced: c.coalesced.Load(),
+		Requests:  c.requests.Load(),
+	}
+}
+
+// BaseURL returns the URL requests are sent to: the stub service if the service is stubbed, and the real service
+// otherwise.
+func (c *Client) BaseURL() string {
+	if url, ok := c.stubbed(); ok {
+		return url
+	}
+	return c.URL
+}
+
+// stubbed returns the URL of the stub service, and whether the service is stubbed.
+func (c *Client) stubbed() (string, bool) {
+	if c.stub == nil {
+		return "", false
+	}
+	return c.stub()
+}
+
+// Get requests a path below the base URL, and decodes the JSON response into content.
+//
+// Parameters:
+// - ctx: cancels the request, including the waits between attempts.
+// - path: the path below the base URL. Example: "/alpha/NO"
+// - query: the query parameters, or nil.
+// - content: a pointer to decode the response into.
+//
+// Returns:
+// - nil if the response was decoded into content.
+// - An *Error otherwise. Network failures, timeouts, 429 Too Many Requests and 5xx responses are retried, other
+// failures are returned at once. While the breaker is open, ErrCircuitOpen is returned without a request, and
+// ErrRateLimited if the request would wait too long for the rate limit of the service's host.
+func (c *Client) Get(ctx context.Context, path string, query neturl.Values, content any) error {
+	return c.get(ctx, path, query, content, util.MIMETYPE_JSON, decodeJSON)
+}
+
+// GetXML requests a path below the base URL like Get, but decodes an XML response into content.
+func (c *Client) GetXML(ctx context.Context, path string, query neturl.Values, content any) error {
+	return c.get(ctx, path, query, content, util.MIMETYPE_XML, decodeXML)
+}
+
+// decoder decodes a response body into content.
+type decoder func(body io.Reader, content any) error
+
+func decodeJSON(body io.Reader, content any) error { return json.NewDecoder(body).Decode(content) }
+func decodeXML(body io.Reader, content any) error  { return xml.NewDecoder(body).Decode(content) }
+
+// get requests a path below the base URL, accepting the media type, and decodes the response with decode.
+//
+// Responses are served from the cache until they are older than CacheTTL, unless the context says to refresh them
+// (see WithRefresh). Identical requests that are in flight at the same time are coalesced: only the first is sent,
+// and the others wait for it and share its response. Each caller decodes the response into its own content, so
+// callers never share maps or slices.
+//
+// The shared request is not cancelled by the caller that started it, so a caller that gives up does not fail the
+// others. Each caller stops waiting for it when its own context is done, and it is cancelled when no caller waits for
+// it anymore. It has a time limit of its own (see flightTimeout), but does not wait for the rate limit longer than the
+// earliest deadline of the callers that wait for it.
+func (c *Client) get(ctx context.Context, path string, query neturl.Values, content any, accept string,
+	decode decoder) error {
+	url := strings.TrimSuffix(c.BaseURL(), "/") + path
+	if len(query) > 0 {
+		url += "?" + query.Encode()
+	}
+
+	c.calls.Add(1)
+	key := accept + " " + url
+	if !refreshing(ctx) {
+		if body, ok := c.cached(key); ok {
+			c.cacheHits.Add(1)
+			if err := decode(bytes.NewReader(body), content); err != nil {
+				return c.error(url, 0, ErrInvalidResponse, err)
+			}
+			return nil
+		}
+	}
+
+	f, shared := c.join(ctx, key, url, content, accept, decode)
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		c.leave(ctx, key, f)
+		return c.error(url, 0, kindOf(ctx.Err()), ctx.Err())
+	}
+	// Every caller but the one that sent the request shared it, whether it passed or failed
+	if shared {
+		c.coalesced.Add(1)
+	}
+	if f.err != nil {
+		return f.err
+	}
+
+	if err := decode(bytes.NewReader(f.body), content); err != nil {
+		return c.error(url, 0, ErrInvalidResponse, err)
+	}
+	return nil
+}
+
+// join joins the flight of an identical request, or sends the request in a new flight if there is none.
+//
+// Returns:
+// - The flight, and whether it was shared with another caller.
+func (c *Client) join(ctx context.Context, key string, url string, content any, accept string,
+	decode decoder) (*flight, bool) {
+	c.flightsMutex.Lock()
+	defer c.flightsMutex.Unlock()
+
+	f, shared := c.flights[key]
+	if !shared {
+		flightCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.flightTimeout())
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		c.flights[key] = f
+
+		// The response is checked by decoding it into a value of its own, as the callers may stop waiting for it
+		scratch := reflect.New(reflect.TypeOf(content).Elem()).Interface()
+		go c.fly(flightCtx, key, f, url, scratch, accept, decode)
+	}
+	f.waiters++
+	// The flight reads the deadlines while holding the mutex, so it sees this one before it waits for the rate limit
+	if deadline, ok := ctx.Deadline(); ok {
+		f.deadlines = append(f.deadlines, deadline)
+	}
+	return f, shared
+}
+
+// fly sends the request of a flight, stores its response in the cache and tells the callers that it is done.
+func (c *Client) fly(ctx context.Context, key string, f *flight, url string, content any, accept string,
+	decode decoder) {
+	defer f.cancel()
+	body, err := c.send(ctx, f, url, content, accept, decode)
+	if err == nil {
+		c.store(key, body)
+	}
+
+	c.flightsMutex.Lock()
+	if c.flights[key] == f {
+		delete(c.flights, key)
+	}
+	c.flightsMutex.Unlock()
+
+	f.body, f.err = body, err
+	close(f.done)
+}
+
+// leave stops a caller from waiting for a flight. The request is cancelled when no caller waits for it anymore, and
+// calls after that send a new request.
+func (c *Client) leave(ctx context.Context, key string, f *flight) {
+	c.flightsMutex.Lock()
+	defer c.flightsMutex.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if i := slices.IndexFunc(f.deadlines, deadline.Equal); i >= 0 {
+			f.deadlines = slices.Delete(f.deadlines, i, i+1)
+		}
+	}
+	f.waiters--
+	if f.waiters > 0 {
+		return
+	}
+	if c.flights[key] == f {
+		delete(c.flights, key)
+	}
+	f.cancel()
+}
+
+// waitDeadline returns the earliest deadline of the callers that wait for a flight, or false if none of them has a
+// deadline. The request must not wait for the rate limit longer than that, as that caller gives up before it is sent.
+func (c *Client) waitDeadline(f *flight) (time.Time, bool) {
+	c.flightsMutex.Lock()
+	defer c.flightsMutex.Unlock()
+
+	if len(f.deadlines) == 0 {
+		return time.Time{}, false
+	}
+	return slices.MinFunc(f.deadlines, func(a, b time.Time) int { return a.Compare(b) }), true
+}
+
+// flightTimeout returns the time limit of a request that is shared by coalesced callers: enough for every attempt,
+// and the longest waits between them.
+func (c *Client) flightTimeout() time.Duration {
+	attempts := time.Duration(max(c.Attempts, 1))
+	return attempts*c.Timeout + (attempts-1)*MAX_RETRY_WAIT
+}
+
+// send sends a request, and retries it while it fails in a way that may pass.
+//
+// Returns:
+// - The body of the response, which is decoded into content.
+// - An *Error if every attempt failed.
+func (c *Client) send(ctx context.Context, f *flight, url string, content any, accept string,
+	decode decoder) ([]byte, error) {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if cooldown, breakerErr := c.Breaker.allow(); breakerErr != nil {
+			return nil, &Error{Service: c.Name, URL: url, Kind: breakerErr, Err: err, RetryAfter: cooldown}
+		}
+		// A request that is not sent tells the breaker nothing
+		deadline, ok := c.waitDeadline(f)
+		if waitErr := c.waitForTurn(ctx, url, deadline, ok); waitErr != nil {
+			c.Breaker.done(nil, true)
+			return nil, waitErr
+		}
+
+		var retry bool
+		var wait time.Duration
+		var body []byte
+		c.requests.Add(1)
+		retry, wait, body, err = c.try(ctx, url, content, accept, decode)
+		c.Breaker.done(err, ctx.Err() != nil)
+		if err == nil {
+			return body, nil
+		}
+		if !retry || attempt >= c.Attempts {
+			return nil, err
+		}
+
+		if waitErr := sleep(ctx, max(wait, backoff(c.RetryWait, attempt))); waitErr != nil {
+			return nil, c.error(url, 0, kindOf(waitErr), waitErr)
+		}
+	}
+}
+
+// try makes one attempt of a request.
+//
+// Returns:
+// - Whether the request may pass if it is tried again, and how long the service asked to wait before that.
+// - The body of the response, which is decoded into content.
+// - An *Error if the attempt failed.
+func (c *Client) try(ctx context.Context, url string, content any, accept string, decode decoder) (bool,
+	time.Duration, []byte, error) {
+	attemptCtx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(attemptCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, 0, nil, c.error(url, 0, ErrRejected, err)
+	}
+	req.Header.Set(util.ACCEPT, accept)
+	if c.UserAgent != "" {
+		req.Header.Set(util.USER_AGENT, c.UserAgent)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		// The caller gave up, so there is no point in trying again
+		if ctx.Err() != nil {
+			return false, 0, nil, c.error(url, 0, kindOf(ctx.Err()), ctx.Err())
+		}
+		return true, 0, nil, c.error(url, 0, kindOf(err), err)
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return false, 0, nil, c.error(url, res.StatusCode, ErrNotFound, nil)
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError:
+		return true, retryAfter(res), nil, c.error(url, res.StatusCode, ErrUnavailable, nil)
+	case res.StatusCode >= http.StatusBadRequest:
+		return false, 0, nil, c.error(url, res.StatusCode, ErrRejected, nil)
+	case res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices:
+		return false, 0, nil, c.error(url, res.StatusCode, ErrInvalidResponse, nil)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, MAX_RESPONSE_SIZE))
+	if err != nil {
+		// The time ran out while the body was read
+		if attemptCtx.Err() != nil && ctx.Err() == nil {
+			return true, 0, nil, c.error(url, res.StatusCode, ErrTimeout, err)
+		}
+		return true, 0, nil, c.error(url, res.StatusCode, kindOf(err), err)
+	}
+	if err := decode(bytes.NewReader(body), content); err != nil {
+		return false, 0, nil, c.error(url, res.StatusCode, ErrInvalidResponse, err)
+	}
+	return false, 0, body, nil
+}
+
+// error creates an *Error of the client.
+func (c *Client) error(url string, statusCode int, kind error, err error) error {
+	return &Error{Service: c.Name, URL: url, StatusCode: statusCode, Kind: kind, Err: err}
+}
+
+// kindOf returns the kind of a network or context error.
+func kindOf(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	return ErrUnavailable
+}
+
+// backoff returns the wait before a retry. The wait doubles for every attempt, and is randomized by ±50 %, so
+// clients that failed at the same time don't retry at the same time.
+func backoff(wait time.Duration, attempt int) time.Duration {
+	wait <<= attempt - 1
+	if wait <= 0 || wait > MAX_RETRY_WAIT {
+		wait = MAX_RETRY_WAIT
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait)+1))
+}
+
+// retryAfter returns the wait the service asked for in the Retry-After header, in seconds. Dates are not supported.
+func retryAfter(res *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(res.Header.Get(util.RETRY_AFTER))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return min(time.Duration(seconds)*time.Second, MAX_RETRY_WAIT)
+}
+
+// sleep waits for a duration, or until the context is done.
+func sleep(ctx context.Context, wait time.Duration) error {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
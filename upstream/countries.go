@@ -0,0 +1,54 @@
+package upstream
+
+import (
+	"assignment2/util"
+	"context"
+	"fmt"
+	neturl "net/url"
+)
+
+// DEFAULT_COUNTRIES_URL is the base URL of REST Countries, unless config.yaml says otherwise.
+const DEFAULT_COUNTRIES_URL = "http://129.241.150.113:8080/v3.1"
+
+// CountriesClient is the client of REST Countries.
+type CountriesClient struct {
+	*Client
+}
+
+// Countries is the client of REST Countries, or its stub service.
+var Countries = CountriesClient{newClient("REST Countries", DEFAULT_COUNTRIES_URL, func() (string, bool) {
+	return util.LOCALHOST + util.CountryStubPort, util.Config.Stubs.RestCountries
+})}
+
+// ByCode retrieves a country by its ISO 3166-1 alpha-2 or alpha-3 code.
+//
+// Returns:
+// - The country is returned if the service found it.
+// - An *Error of the kind ErrNotFound is returned if no country has the code.
+func (c CountriesClient) ByCode(ctx context.Context, isoCode string) (util.Country, error) {
+	var countries []util.Country
+	if err := c.Get(ctx, "/alpha/"+neturl.PathEscape(isoCode), nil, &countries); err != nil {
+		return util.Country{}, err
+	}
+	if len(countries) == 0 {
+		return util.Country{}, c.error(c.BaseURL()+"/alpha/"+isoCode, 0, ErrNotFound,
+			fmt.Errorf("no country was found by ISO code %q", isoCode))
+	}
+	return countries[0], nil
+}
+
+// ByName retrieves the countries whose common or official name is exactly the name.
+//
+// Returns:
+// - The countries that are named exactly the same as name. This is normally only one country.
+// - An *Error of the kind ErrNotFound is returned if no country has the name.
+func (c CountriesClient) ByName(ctx context.Context, name string) ([]util.Country, error) {
+	var countries []util.Country
+	if err := c.Get(ctx, "/name/"+neturl.PathEscape(name), neturl.Values{"fullText": {"true"}}, &countries); err != nil {
+		return nil, err
+	}
+	if len(countries) == 0 {
+		return nil, c.error(c.BaseURL()+"/name/"+name, 0, ErrNotFound, fmt.Errorf("no country is named %q", name))
+	}
+	return countries, nil
+}
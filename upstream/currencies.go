@@ -0,0 +1,118 @@
+package upstream
+
+import (
+	"assignment2/util"
+	"context"
+	"fmt"
+	neturl "net/url"
+	"sync"
+)
+
+// DEFAULT_CURRENCIES_URL is the base URL of the Currency API, unless config.yaml says otherwise.
+const DEFAULT_CURRENCIES_URL = "http://129.241.150.113:9090/currency"
+
+// Names of the currency providers in config.yaml.
+const (
+	PROVIDER_CURRENCY_API = "currency_api"
+	PROVIDER_ECB          = "ecb"
+)
+
+// CurrencyProvider provides exchange rates.
+type CurrencyProvider interface {
+	// Rates retrieves the exchange rates for a base currency. The rate of the base currency itself is 1.
+	//
+	// Parameters:
+	// - currencyCode: the base currency's three-letter code. Example: NOK
+	Rates(ctx context.Context, currencyCode string) (util.Currency, error)
+}
+
+// currencyProviders are the currency providers by their names in config.yaml.
+var currencyProviders = map[string]CurrencyProvider{
+	PROVIDER_CURRENCY_API: Currencies,
+	PROVIDER_ECB:          ECB,
+}
+
+// currencyOrder is the order the currency providers are tried in. See SetCurrencyProviders.
+var (
+	currencyOrder      = []CurrencyProvider{Currencies, ECB}
+	currencyOrderMutex sync.RWMutex
+)
+
+// SetCurrencyProviders sets the currency providers CurrencyRates tries, in order. No names keeps the current order.
+//
+// Parameters:
+// - names: names of currency providers. Example: "currency_api", "ecb"
+//
+// Returns:
+// - An error if a name is unknown. The order is not changed then.
+func SetCurrencyProviders(names ...string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	order := make([]CurrencyProvider, 0, len(names))
+	for _, name := range names {
+		provider, ok := currencyProviders[name]
+		if !ok {
+			return fmt.Errorf("unknown currency provider %q. Must be %q or %q", name, PROVIDER_CURRENCY_API,
+				PROVIDER_ECB)
+		}
+		order = append(order, provider)
+	}
+
+	currencyOrderMutex.Lock()
+	defer currencyOrderMutex.Unlock()
+	currencyOrder = order
+	return nil
+}
+
+// CurrencyRates retrieves the exchange rates for a base currency from the first currency provider that has them.
+// The next provider is tried when a provider fails, or doesn't know the currency.
+//
+// Parameters:
+// - currencyCode: the base currency's three-letter code. Example: NOK
+//
+// Returns:
+// - The rates of the first provider that had them.
+// - The error of the first provider if all the providers failed.
+func CurrencyRates(ctx context.Context, currencyCode string) (util.Currency, error) {
+	currencyOrderMutex.RLock()
+	order := currencyOrder
+	currencyOrderMutex.RUnlock()
+
+	var firstErr error
+	for _, provider := range order {
+		currency, err := provider.Rates(ctx, currencyCode)
+		if err == nil {
+			return currency, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		// The caller gave up, so the other providers are not asked
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return util.Currency{}, firstErr
+}
+
+// CurrenciesClient is the client of the Currency API.
+type CurrenciesClient struct {
+	*Client
+}
+
+// Currencies is the client of the Currency API, or its stub service.
+var Currencies = CurrenciesClient{newClient("Currency API", DEFAULT_CURRENCIES_URL, func() (string, bool) {
+	return util.LOCALHOST + util.CurrenciesStubPort, util.Config.Stubs.Currencies
+})}
+
+// Rates retrieves the exchange rates for a base currency.
+//
+// Parameters:
+// - currencyCode: the base currency's three-letter code. Example: NOK
+func (c CurrenciesClient) Rates(ctx context.Context, currencyCode string) (util.Currency, error) {
+	var currency util.Currency
+	err := c.Get(ctx, "/"+neturl.PathEscape(currencyCode), nil, &currency)
+	return currency, err
+}
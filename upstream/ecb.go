@@ -0,0 +1,88 @@
+package upstream
+
+import (
+	"assignment2/util"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DEFAULT_ECB_URL is the base URL of the European Central Bank's euro reference rates, unless config.yaml says
+// otherwise.
+const DEFAULT_ECB_URL = "https://www.ecb.europa.eu/stats/eurofxref"
+
+// ECB_DAILY_PATH is the path of the daily reference rates below the base URL.
+const ECB_DAILY_PATH = "/eurofxref-daily.xml"
+
+// ECBClient is the client of the European Central Bank's euro reference rates.
+type ECBClient struct {
+	*Client
+}
+
+// ECB is the client of the European Central Bank's euro reference rates, or its stub service.
+var ECB = ECBClient{newClient("ECB", DEFAULT_ECB_URL, func() (string, bool) {
+	return util.LOCALHOST + util.ECBStubPort, util.Config.Stubs.ECB
+})}
+
+// ecbEnvelope is the daily reference rates document of the ECB. The rates are of one euro, and are nested in three
+// levels of 'Cube' elements:
+//
+//	<gesmes:Envelope>
+//	  <Cube>
+//	    <Cube time="2024-04-17">
+//	      <Cube currency="USD" rate="1.0635"/>
+//	    </Cube>
+//	  </Cube>
+//	</gesmes:Envelope>
+type ecbEnvelope struct {
+	Cube struct {
+		Day struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string  `xml:"currency,attr"`
+				Rate     float64 `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+// Rates retrieves the euro reference rates, and converts them to a base currency. The rate of a currency is the
+// euro rate of the currency divided by the euro rate of the base currency.
+//
+// Parameters:
+// - currencyCode: the base currency's three-letter code. Example: NOK
+//
+// Returns:
+// - The rates for the base currency, including EUR.
+// - An *Error of the kind ErrNotFound if the ECB has no rate for the base currency.
+func (c ECBClient) Rates(ctx context.Context, currencyCode string) (util.Currency, error) {
+	var envelope ecbEnvelope
+	if err := c.GetXML(ctx, ECB_DAILY_PATH, nil, &envelope); err != nil {
+		return util.Currency{}, err
+	}
+
+	// The rates are of one euro, and the euro itself is not listed
+	euroRates := map[string]float64{"EUR": 1}
+	for _, rate := range envelope.Cube.Day.Rates {
+		if rate.Currency != "" && rate.Rate > 0 {
+			euroRates[strings.ToUpper(rate.Currency)] = rate.Rate
+		}
+	}
+	if len(euroRates) == 1 {
+		return util.Currency{}, c.error(c.BaseURL()+ECB_DAILY_PATH, 0, ErrInvalidResponse,
+			errors.New("the document has no rates"))
+	}
+
+	base, ok := euroRates[strings.ToUpper(currencyCode)]
+	if !ok {
+		return util.Currency{}, c.error(c.BaseURL()+ECB_DAILY_PATH, 0, ErrNotFound,
+			fmt.Errorf("no reference rate for %q", currencyCode))
+	}
+
+	rates := make(map[string]float64, len(euroRates))
+	for code, rate := range euroRates {
+		rates[code] = rate / base
+	}
+	return util.Currency{Rates: rates}, nil
+}
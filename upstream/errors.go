@@ -0,0 +1,58 @@
+package upstream
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Kinds of upstream errors. An Error wraps one of them, so callers can check the kind with errors.Is.
+var (
+	// ErrNotFound is returned when the requested resource does not exist (404 Not Found).
+	ErrNotFound = errors.New("the resource was not found")
+	// ErrTimeout is returned when the upstream service did not respond in time.
+	ErrTimeout = errors.New("the service did not respond in time")
+	// ErrUnavailable is returned when the upstream service could not be reached, or failed (5xx or 429).
+	ErrUnavailable = errors.New("the service is unavailable")
+	// ErrRejected is returned when the upstream service rejected the request (4xx other than 404 and 429).
+	ErrRejected = errors.New("the service rejected the request")
+	// ErrInvalidResponse is returned when the response could not be decoded.
+	ErrInvalidResponse = errors.New("the service returned an invalid response")
+	// ErrCircuitOpen is returned without sending the request, when the service has failed too many times in a row.
+	// See Breaker.
+	ErrCircuitOpen = errors.New("the service is failing, and is not asked until it has had time to recover")
+	// ErrRateLimited is returned without sending the request, when the request would have to wait too long for the
+	// rate limit of the service's host. See SetRateLimits.
+	ErrRateLimited = errors.New("too many requests are sent to the service")
+)
+
+// Error is returned by the clients when a request to an upstream service fails.
+type Error struct {
+	Service    string // Service is the name of the upstream service. Example: "REST Countries"
+	URL        string // URL is the requested URL.
+	StatusCode int    // StatusCode is the status code of the last response, or 0 if there was no response.
+	Kind       error  // Kind is one of 'Err*'.
+	Err        error  // Err is the underlying error, if any.
+
+	// RetryAfter is how long to wait before the request may pass, if it is known.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	message := fmt.Sprintf("%v: %v", e.Service, e.Kind)
+	if e.StatusCode != 0 {
+		message += fmt.Sprintf(" (status %d)", e.StatusCode)
+	}
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+// Unwrap returns both the kind and the underlying error, so errors.Is matches either.
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
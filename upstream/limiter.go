@@ -0,0 +1,127 @@
+package upstream
+
+import (
+	"assignment2/util"
+	"context"
+	"fmt"
+	neturl "net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Defaults of the rate limits, used until Configure is called.
+const (
+	DEFAULT_RATE_LIMIT    = 10 // DEFAULT_RATE_LIMIT is the number of requests per second to each host.
+	DEFAULT_RATE_BURST    = 20 // DEFAULT_RATE_BURST is the number of requests that may be sent at once to each host.
+	DEFAULT_QUEUE_TIMEOUT = 2 * time.Second
+)
+
+// Rate limits of the upstream hosts. Each host has a token bucket that is filled with 'Rate' tokens per second, up to
+// 'Burst' tokens. Every request to the host, including retries, takes a token. A request that finds the bucket empty
+// waits in line for a token, but fails with ErrRateLimited if it would wait longer than the queue timeout.
+//
+// The limits are per host, not per service, as services on the same host are throttled together. Stub services are
+// not limited.
+var (
+	rateLimit      = util.RateLimit{Rate: DEFAULT_RATE_LIMIT, Burst: DEFAULT_RATE_BURST}
+	hostRateLimits = map[string]util.RateLimit{}
+	queueTimeout   = DEFAULT_QUEUE_TIMEOUT
+	limiters       = map[string]*rate.Limiter{}
+	limitersMutex  sync.Mutex
+)
+
+// SetRateLimits sets the rate limits of the upstream hosts, and empties the buckets' history.
+//
+// Parameters:
+// - limit: the limit of hosts that are not in hosts. Values that are not positive keep the defaults.
+// - hosts: the limits by host name, without the port. Example: "129.241.150.113". Values that are not positive are
+// taken from limit.
+// - queue: the longest time a request waits for its turn. Values that are not positive keep the default.
+func SetRateLimits(limit util.RateLimit, hosts map[string]util.RateLimit, queue time.Duration) {
+	limit = withDefaults(limit, util.RateLimit{Rate: DEFAULT_RATE_LIMIT, Burst: DEFAULT_RATE_BURST})
+	if queue <= 0 {
+		queue = DEFAULT_QUEUE_TIMEOUT
+	}
+
+	limitersMutex.Lock()
+	defer limitersMutex.Unlock()
+
+	rateLimit = limit
+	hostRateLimits = make(map[string]util.RateLimit, len(hosts))
+	for host, hostLimit := range hosts {
+		hostRateLimits[host] = withDefaults(hostLimit, limit)
+	}
+	queueTimeout = queue
+	limiters = map[string]*rate.Limiter{}
+}
+
+// withDefaults replaces the values of a limit that are not positive with the defaults.
+func withDefaults(limit util.RateLimit, defaults util.RateLimit) util.RateLimit {
+	if limit.Rate <= 0 {
+		limit.Rate = defaults.Rate
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = defaults.Burst
+	}
+	return limit
+}
+
+// limiterOf returns the limiter of a host, and the queue timeout.
+func limiterOf(host string) (*rate.Limiter, time.Duration) {
+	limitersMutex.Lock()
+	defer limitersMutex.Unlock()
+
+	limiter, ok := limiters[host]
+	if !ok {
+		limit, ok := hostRateLimits[host]
+		if !ok {
+			limit = rateLimit
+		}
+		limiter = rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+		limiters[host] = limiter
+	}
+	return limiter, queueTimeout
+}
+
+// waitForTurn waits until a request to the URL's host is within the host's rate limit. Stub services are local, and
+// are not limited. The wait is bounded by the deadline of ctx, and by the callers' deadline if hasDeadline is true,
+// since ctx is the flight's own context. See Client.waitDeadline.
+//
+// Returns:
+// - nil when the request may be sent.
+// - An *Error of the kind ErrRateLimited, with the time until the request could be sent, if the wait would be longer
+// than the queue timeout or the callers' deadline.
+// - An *Error of the kind ErrTimeout or ErrUnavailable if the caller gave up while waiting.
+func (c *Client) waitForTurn(ctx context.Context, url string, deadline time.Time, hasDeadline bool) error {
+	if _, stubbed := c.stubbed(); stubbed {
+		return nil
+	}
+
+	parsed, err := neturl.Parse(url)
+	if err != nil {
+		return c.error(url, 0, ErrRejected, err)
+	}
+	limiter, queue := limiterOf(parsed.Hostname())
+
+	reservation := limiter.Reserve()
+	delay := reservation.Delay()
+	if flightDeadline, ok := ctx.Deadline(); ok {
+		queue = min(queue, time.Until(flightDeadline))
+	}
+	if hasDeadline {
+		queue = min(queue, time.Until(deadline))
+	}
+	if !reservation.OK() || delay > queue {
+		reservation.Cancel()
+		return &Error{Service: c.Name, URL: url, Kind: ErrRateLimited, RetryAfter: delay,
+			Err: fmt.Errorf("the next request to %v may be sent in %v", parsed.Hostname(), delay.Round(time.Millisecond))}
+	}
+
+	if err := sleep(ctx, delay); err != nil {
+		reservation.Cancel()
+		return c.error(url, 0, kindOf(err), err)
+	}
+	return nil
+}
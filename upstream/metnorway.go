@@ -0,0 +1,116 @@
+package upstream
+
+import (
+	"assignment2/util"
+	"context"
+	"errors"
+	neturl "net/url"
+	"strconv"
+	"time"
+)
+
+// DEFAULT_MET_NORWAY_URL is the base URL of MET Norway's Locationforecast, unless config.yaml says otherwise.
+const DEFAULT_MET_NORWAY_URL = "https://api.met.no/weatherapi/locationforecast/2.0"
+
+// MET_NORWAY_COMPACT_PATH is the path of the compact forecast below the base URL.
+const MET_NORWAY_COMPACT_PATH = "/compact"
+
+// DEFAULT_MET_NORWAY_USER_AGENT identifies the service to MET Norway, which rejects requests without one, unless
+// config.yaml says otherwise.
+const DEFAULT_MET_NORWAY_USER_AGENT = "assignment2-dashboards/1.0"
+
+// MetNorwayClient is the client of MET Norway's Locationforecast.
+type MetNorwayClient struct {
+	*Client
+}
+
+// MetNorway is the client of MET Norway's Locationforecast, or its stub service.
+var MetNorway = newMetNorwayClient()
+
+// newMetNorwayClient creates the client of MET Norway's Locationforecast, with a User-Agent.
+func newMetNorwayClient() MetNorwayClient {
+	client := newClient("MET Norway", DEFAULT_MET_NORWAY_URL, func() (string, bool) {
+		return util.LOCALHOST + util.MetNorwayStubPort, util.Config.Stubs.MetNorway
+	})
+	client.UserAgent = DEFAULT_MET_NORWAY_USER_AGENT
+	return MetNorwayClient{client}
+}
+
+// metNorwayForecast is the compact forecast of MET Norway. It is a time series where each entry has the instant
+// values at its time, and the summaries of the next 1, 6 and 12 hours. Only the first days have entries every hour,
+// and only the hourly entries have a summary of the next hour.
+type metNorwayForecast struct {
+	Properties struct {
+		Meta struct {
+			Units struct {
+				AirTemperature      string `json:"air_temperature"`      // Example: celsius
+				PrecipitationAmount string `json:"precipitation_amount"` // Example: mm
+			} `json:"units"`
+		} `json:"meta"`
+		Timeseries []struct {
+			Time time.Time `json:"time"`
+			Data struct {
+				Instant struct {
+					Details struct {
+						AirTemperature *float64 `json:"air_temperature"`
+					} `json:"details"`
+				} `json:"instant"`
+				NextHour *struct {
+					Details struct {
+						PrecipitationAmount *float64 `json:"precipitation_amount"`
+					} `json:"details"`
+				} `json:"next_1_hours"`
+			} `json:"data"`
+		} `json:"timeseries"`
+	} `json:"properties"`
+}
+
+// metNorwayUnits are the units of MET Norway by their names, in the symbols of the other weather providers.
+var metNorwayUnits = map[string]string{
+	"celsius":    "°C",
+	"fahrenheit": "°F",
+}
+
+// Forecast retrieves the hourly temperature and precipitation forecast for a set of coordinates. Only the hourly
+// part of the time series is used, so every provider's forecast has one value per hour.
+//
+// Returns:
+// - The forecast for the hours that have both an air temperature and a precipitation amount.
+// - An *Error of the kind ErrInvalidResponse if no hours have both.
+func (c MetNorwayClient) Forecast(ctx context.Context, latitude float64, longitude float64) (util.Weather, error) {
+	query := neturl.Values{
+		"lat": {strconv.FormatFloat(latitude, 'f', 2, 64)},
+		"lon": {strconv.FormatFloat(longitude, 'f', 2, 64)},
+	}
+
+	var forecast metNorwayForecast
+	if err := c.Get(ctx, MET_NORWAY_COMPACT_PATH, query, &forecast); err != nil {
+		return util.Weather{}, err
+	}
+
+	units := forecast.Properties.Meta.Units
+	weather := util.Weather{HourlyUnits: util.ForecastUnits{
+		Temperature:   units.AirTemperature,
+		Precipitation: units.PrecipitationAmount,
+	}}
+	if symbol, ok := metNorwayUnits[units.AirTemperature]; ok {
+		weather.HourlyUnits.Temperature = symbol
+	}
+
+	for _, entry := range forecast.Properties.Timeseries {
+		temperature := entry.Data.Instant.Details.AirTemperature
+		if temperature == nil || entry.Data.NextHour == nil || entry.Data.NextHour.Details.PrecipitationAmount == nil {
+			continue
+		}
+		weather.Hourly.Time = append(weather.Hourly.Time, entry.Time.UTC().Format("2006-01-02T15:04"))
+		weather.Hourly.Temperature = append(weather.Hourly.Temperature, *temperature)
+		weather.Hourly.Precipitation = append(weather.Hourly.Precipitation,
+			*entry.Data.NextHour.Details.PrecipitationAmount)
+	}
+
+	if len(weather.Hourly.Time) == 0 {
+		return util.Weather{}, c.error(c.BaseURL()+MET_NORWAY_COMPACT_PATH, 0, ErrInvalidResponse,
+			errors.New("the forecast has no hourly values"))
+	}
+	return weather, nil
+}
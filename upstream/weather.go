@@ -0,0 +1,121 @@
+package upstream
+
+import (
+	"assignment2/util"
+	"context"
+	"fmt"
+	neturl "net/url"
+	"strconv"
+	"sync"
+)
+
+// DEFAULT_WEATHER_URL is the base URL of the Open-Meteo forecast API, unless config.yaml says otherwise.
+const DEFAULT_WEATHER_URL = "https://api.open-meteo.com/v1/forecast"
+
+// Names of the weather providers in config.yaml.
+const (
+	PROVIDER_OPEN_METEO = "open_meteo"
+	PROVIDER_MET_NORWAY = "met_norway"
+)
+
+// WeatherProvider provides weather forecasts.
+type WeatherProvider interface {
+	// Forecast retrieves the hourly temperature and precipitation forecast for a set of coordinates.
+	Forecast(ctx context.Context, latitude float64, longitude float64) (util.Weather, error)
+}
+
+// weatherProviders are the weather providers by their names in config.yaml.
+var weatherProviders = map[string]WeatherProvider{
+	PROVIDER_OPEN_METEO: Weather,
+	PROVIDER_MET_NORWAY: MetNorway,
+}
+
+// weatherProvider is the weather provider Forecast uses. See SetWeatherProvider.
+var (
+	weatherProvider      WeatherProvider = Weather
+	weatherProviderMutex sync.RWMutex
+)
+
+// SetWeatherProvider sets the weather provider Forecast uses. No name keeps the current provider.
+//
+// Parameters:
+// - name: name of a weather provider. Example: "met_norway"
+//
+// Returns:
+// - An error if the name is unknown. The provider is not changed then.
+func SetWeatherProvider(name string) error {
+	if name == "" {
+		return nil
+	}
+
+	provider, ok := weatherProviders[name]
+	if !ok {
+		return fmt.Errorf("unknown weather provider %q. Must be %q or %q", name, PROVIDER_OPEN_METEO,
+			PROVIDER_MET_NORWAY)
+	}
+
+	weatherProviderMutex.Lock()
+	defer weatherProviderMutex.Unlock()
+	weatherProvider = provider
+	return nil
+}
+
+// Forecast retrieves the hourly temperature and precipitation forecast for a set of coordinates from the weather
+// provider in config.yaml.
+func Forecast(ctx context.Context, latitude float64, longitude float64) (util.Weather, error) {
+	weatherProviderMutex.RLock()
+	provider := weatherProvider
+	weatherProviderMutex.RUnlock()
+
+	return provider.Forecast(ctx, latitude, longitude)
+}
+
+// WeatherClient is the client of the Open-Meteo forecast API.
+type WeatherClient struct {
+	*Client
+}
+
+// Weather is the client of the Open-Meteo forecast API, or its stub service.
+var Weather = WeatherClient{newClient("Open-Meteo", DEFAULT_WEATHER_URL, func() (string, bool) {
+	return util.LOCALHOST + util.WeatherStubPort, util.Config.Stubs.Weather
+})}
+
+// openMeteoForecast is the response of the Open-Meteo forecast API. The series are in 'hourly', and their units in
+// 'hourly_units', both by the names of the variables.
+type openMeteoForecast struct {
+	HourlyUnits struct {
+		Temperature   string `json:"temperature_2m"`
+		Precipitation string `json:"precipitation"`
+	} `json:"hourly_units"`
+	Hourly struct {
+		Time          []string  `json:"time"` // ISO 8601 in UTC without seconds. Example: 2024-04-18T13:00
+		Temperature   []float64 `json:"temperature_2m"`
+		Precipitation []float64 `json:"precipitation"`
+	} `json:"hourly"`
+}
+
+// Forecast retrieves the hourly temperature and precipitation forecast for a set of coordinates.
+func (c WeatherClient) Forecast(ctx context.Context, latitude float64, longitude float64) (util.Weather, error) {
+	query := neturl.Values{
+		"latitude":  {strconv.FormatFloat(latitude, 'f', 2, 64)},
+		"longitude": {strconv.FormatFloat(longitude, 'f', 2, 64)},
+		"hourly":    {"temperature_2m,precipitation"},
+	}
+
+	var forecast openMeteoForecast
+	if err := c.Get(ctx, "", query, &forecast); err != nil {
+		return util.Weather{}, err
+	}
+
+	return util.Weather{
+		HourlyUnits: util.ForecastUnits{
+			Temperature:   forecast.HourlyUnits.Temperature,
+			Precipitation: forecast.HourlyUnits.Precipitation,
+		},
+		Hourly: util.ForecastHourly{
+			Time:          forecast.Hourly.Time,
+			Temperature:   forecast.Hourly.Temperature,
+			Precipitation: forecast.Hourly.Precipitation,
+		},
+	}, nil
+}
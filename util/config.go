@@ -3,6 +3,7 @@ package util
 import (
 	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
+	"time"
 )
 
 // Config is global access to configurations found in config.yaml
@@ -13,13 +14,69 @@ var Config config
 type config struct {
 	Secrets struct {
 		FirebaseKey string `yaml:"firebase_key"`
+		ShareKey    string `yaml:"share_key"`
 	} `yaml:"secrets"`
 	Stubs struct {
 		Database      bool `yaml:"database"`
 		Currencies    bool `yaml:"currencies"`
 		Weather       bool `yaml:"weather"`
 		RestCountries bool `yaml:"rest_countries"`
+		ECB           bool `yaml:"ecb"`
+		MetNorway     bool `yaml:"met_norway"`
 	} `yaml:"stubs"`
+	Snapshots struct {
+		RetentionDays int `yaml:"retention_days" env-default:"92"`
+	} `yaml:"snapshots"`
+	Shares struct {
+		DefaultTTL time.Duration `yaml:"default_ttl" env-default:"168h"`
+		MaxTTL     time.Duration `yaml:"max_ttl" env-default:"720h"`
+	} `yaml:"shares"`
+	Warming struct {
+		Interval    time.Duration `yaml:"interval" env-default:"10m"`
+		Concurrency int           `yaml:"concurrency" env-default:"4"`
+	} `yaml:"warming"`
+	Upstreams struct {
+		RestCountries UpstreamConfig `yaml:"rest_countries"`
+		Weather       UpstreamConfig `yaml:"weather"`
+		MetNorway     UpstreamConfig `yaml:"met_norway"`
+		Currencies    UpstreamConfig `yaml:"currencies"`
+		ECB           UpstreamConfig `yaml:"ecb"`
+
+		// RateLimit is the rate limit of each upstream host, unless HostRateLimits has the host.
+		RateLimit RateLimit `yaml:"rate_limit"`
+		// HostRateLimits are the rate limits of upstream hosts by host name, without the port.
+		HostRateLimits map[string]RateLimit `yaml:"host_rate_limits"`
+		// QueueTimeout is the longest time a request waits for the rate limit before it fails.
+		QueueTimeout time.Duration `yaml:"queue_timeout" env-default:"2s"`
+
+		// WeatherProvider is the provider of weather forecasts.
+		WeatherProvider string `yaml:"weather_provider" env-default:"open_meteo"`
+
+		// CurrencyProviders are the providers of exchange rates, in the order they are tried.
+		CurrencyProviders []string `yaml:"currency_providers" env-default:"currency_api,ecb"`
+	} `yaml:"upstreams"`
+}
+
+// UpstreamConfig configures the client of an upstream service. Services that are stubbed use the stub instead of
+// the base URL.
+type UpstreamConfig struct {
+	BaseURL  string        `yaml:"base_url"`                  // BaseURL replaces the default URL of the service.
+	Timeout  time.Duration `yaml:"timeout" env-default:"10s"` // Timeout is the time limit of each attempt.
+	Attempts int           `yaml:"attempts" env-default:"3"`  // Attempts is the number of tries of a request.
+
+	// UserAgent identifies the service in the requests. MET Norway requires one.
+	UserAgent string `yaml:"user_agent"`
+	// CacheTTL is how long responses are served from the cache. The cache is off unless it is positive.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+
+	BreakerThreshold int           `yaml:"breaker_threshold" env-default:"5"`  // Failures in a row that open the breaker.
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown" env-default:"30s"` // How long the breaker stays open.
+}
+
+// RateLimit is a token bucket: 'Rate' requests per second, and up to 'Burst' requests at once.
+type RateLimit struct {
+	Rate  float64 `yaml:"rate" env-default:"10"`
+	Burst int     `yaml:"burst" env-default:"20"`
 }
 
 // InitializeConfig must be run once. It reads variables in the config.yaml configurations file.
@@ -6,22 +6,33 @@ const (
 	DASHBOARD_PATH    = "/dashboard/v1/dashboards/"
 	NOTIFICATION_PATH = "/dashboard/v1/notifications/"
 	STATUS_PATH       = "/dashboard/v1/status/"
+	STATIC_PATH       = "/dashboard/v1/static/"
+	TEMPLATE_PATH     = "/dashboard/v1/templates/"
+	SHARED_PATH       = "/dashboard/v1/shared/"
 
-	// URLs
-	COUNTRY_URL   = "http://129.241.150.113:8080/v3.1"
-	OPEN_METO_URL = "https://api.open-meteo.com/v1/forecast"
-	CURRENCY_URL  = "http://129.241.150.113:9090/currency/"
-	LOCALHOST     = "http://localhost:"
+	NOTIFICATION_SOCKET_PATH = "/dashboard/v1/notifications/socket"
+
+	// Endpoints that are only served by the database stub
+	STUB_SNAPSHOTS_PATH = "/dashboard/v1/snapshots/"
+	STUB_SHARES_PATH    = "/dashboard/v1/shares/"
+
+	// URLs of the upstream services are in package upstream
+	LOCALHOST = "http://localhost:"
 
 	// Collections
 	DASHBOARDS               = "dashboards"
 	COLLECTION_NOTIFICATIONS = "notifications"
+	COLLECTION_SNAPSHOTS     = "snapshots"
+	COLLECTION_TEMPLATES     = "templates"
+	COLLECTION_SHARES        = "shares"
 
 	// STUB Ports
 	DATABASE_PORT       = "1881"
 	CURRENCIES_PORT     = "13272"
 	OPENWEATHER_PORT    = "17623"
 	REST_COUNTRIES_PORT = "25531"
+	ECB_PORT            = "13274"
+	MET_NORWAY_PORT     = "17625"
 )
 
 var (
@@ -30,13 +41,20 @@ var (
 	WeatherStubPort    string = OPENWEATHER_PORT
 	CurrenciesStubPort string = CURRENCIES_PORT
 	CountryStubPort    string = REST_COUNTRIES_PORT
+	ECBStubPort        string = ECB_PORT
+	MetNorwayStubPort  string = MET_NORWAY_PORT
 
 	// Stubs
 	STUB_DATABASE_REGISTRATIONS = "stubs/res/registrations.json"
 	STUB_DATABASE_NOTIFICATIONS = "stubs/res/notifications.json"
+	STUB_DATABASE_SNAPSHOTS     = "stubs/res/snapshots.json"
+	STUB_DATABASE_TEMPLATES     = "stubs/res/templates.json"
+	STUB_DATABASE_SHARES        = "stubs/res/shares.json"
 
 	// Mocked response from the real services
 	STUB_WEATHER_REPONSE     = "stubs/res/weather.json"
 	STUB_CURRENCIES_RESPONSE = "stubs/res/currency.json"
 	STUB_COUNTRY_RESPONSE    = "stubs/res/country.json"
+	STUB_ECB_RESPONSE        = "stubs/res/ecb.xml"
+	STUB_MET_NORWAY_RESPONSE = "stubs/res/metnorway.json"
 )
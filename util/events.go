@@ -12,6 +12,9 @@ const (
 	EVENT_CHANGE   = "CHANGE"
 	EVENT_DELETE   = "DELETE"
 	EVENT_INVOKE   = "INVOKE"
+
+	// EVENT_THRESHOLD is invoked when a condition on a dashboard value starts or stops holding.
+	EVENT_THRESHOLD = "THRESHOLD"
 )
 
 // ValidateEvents ensures that the event type is valid.
@@ -22,8 +25,9 @@ func ValidateEvents(event string) error {
 		e != EVENT_CHANGE &&
 		e != EVENT_DELETE &&
 		e != EVENT_INVOKE &&
+		e != EVENT_THRESHOLD &&
 		e != EVENT_ALL {
-		return fmt.Errorf("the event must be empty, 'REGISTER', 'CHANGE', 'DELETE or 'INVOKE'")
+		return fmt.Errorf("the event must be empty, 'REGISTER', 'CHANGE', 'DELETE', 'INVOKE' or 'THRESHOLD'")
 	} else {
 		return nil
 	}
@@ -0,0 +1,128 @@
+package util
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Formats are the output formats a client can ask for, either with the Accept header or the 'format' query parameter.
+const (
+	FORMAT_JSON   = "json"
+	FORMAT_CSV    = "csv"
+	FORMAT_NDJSON = "ndjson"
+	FORMAT_HTML   = "html" // Only supported by the endpoints that ask for it. See NegotiateFormat.
+)
+
+// formatMimetypes maps each mimetype to its format.
+var formatMimetypes = map[string]string{
+	MIMETYPE_JSON:   FORMAT_JSON,
+	MIMETYPE_CSV:    FORMAT_CSV,
+	MIMETYPE_NDJSON: FORMAT_NDJSON,
+	MIMETYPE_HTML:   FORMAT_HTML,
+}
+
+// NegotiateFormat finds the output format the client asked for.
+//
+// # Description
+//
+// The query parameter 'format' (json, csv or ndjson) takes precedence over the Accept header. In the Accept header, the
+// supported mimetype with the highest quality is picked. JSON is the default when the client has no preference, or
+// only accepts formats that are not supported.
+//
+// # Example
+//
+// Accept: text/csv;q=0.9, application/x-ndjson
+//
+// Output: "ndjson"
+//
+// Parameters:
+// - r: the client's request.
+// - additional: formats the endpoint supports besides JSON, CSV and NDJSON. Example: util.FORMAT_HTML
+//
+// Returns:
+// - One of 'FORMAT_*'.
+// - An error if the query parameter 'format' is not supported.
+func NegotiateFormat(r *http.Request, additional ...string) (string, error) {
+	supported := append([]string{FORMAT_JSON, FORMAT_CSV, FORMAT_NDJSON}, additional...)
+
+	if format := strings.ToLower(r.URL.Query().Get("format")); format != "" {
+		if !slices.Contains(supported, format) {
+			return "", fmt.Errorf("the format must be one of '%v'", strings.Join(supported, "', '"))
+		}
+		return format, nil
+	}
+
+	best := FORMAT_JSON
+	bestQuality := 0.0
+	for _, accepted := range strings.Split(r.Header.Get(ACCEPT), ",") {
+		mediatype, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		format, ok := formatMimetypes[mediatype]
+		if !ok || !slices.Contains(supported, format) {
+			continue
+		}
+
+		quality := 1.0
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			quality = q
+		}
+		if quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+
+	return best, nil
+}
+
+// WriteCSV writes a header and records to the client as CSV with status 200 OK.
+func WriteCSV(w http.ResponseWriter, header []string, records [][]string) error {
+	w.Header().Set(CONTENT_TYPE, MIMETYPE_CSV)
+	w.Header().Set(X_CONTENT_TYPE_OPTION, "nosniff")
+	w.Header().Add(VARY, ACCEPT)
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(records); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// WriteNDJSON writes each item to the client as newline delimited JSON with status 200 OK.
+// Each item is encoded on a line of its own.
+func WriteNDJSON[T any](w http.ResponseWriter, items []T) error {
+	w.Header().Set(CONTENT_TYPE, MIMETYPE_NDJSON)
+	w.Header().Set(X_CONTENT_TYPE_OPTION, "nosniff")
+	w.Header().Add(VARY, ACCEPT)
+	w.WriteHeader(http.StatusOK)
+
+	// The encoder terminates every value with a newline
+	encoder := json.NewEncoder(w)
+	for _, item := range items {
+		if err := encoder.Encode(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JoinList joins the values of a list into a single CSV field. Lists are separated by ';', as ',' separates fields.
+func JoinList(values []string) string {
+	return strings.Join(values, ";")
+}
+
+// FormatFloat formats a float for CSV output with the smallest number of digits necessary.
+func FormatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
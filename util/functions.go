@@ -1,11 +1,8 @@
 package util
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -27,7 +24,7 @@ func GetIdFromUrl(clientUrl string) (string, error) {
 
 	id := url[len(url)-1]
 
-	if id == "notifications" || id == "registrations" {
+	if id == "notifications" || id == "registrations" || id == "dashboards" {
 		return "", nil
 	}
 
@@ -45,35 +42,24 @@ func GetIdFromUrl(clientUrl string) (string, error) {
 	return id, nil
 }
 
-// MakeGetRequest creates a GET-request to a URL and decodes the body of the response into content.
-func MakeGetRequest(url string, content any) error {
-	// Make and issue a new GET-request
-	res, err1 := http.Get(url)
-	if err1 != nil {
-		return err1
+// SplitResourcePath splits a path below a collection into the ID and the sub-resource of the ID.
+// Paths outside the collection return empty strings.
+//
+// Example:
+// SplitResourcePath("/dashboard/v1/dashboards/123/stream", util.DASHBOARD_PATH)
+//
+// Output: "123", "stream"
+func SplitResourcePath(path string, collection string) (string, string) {
+	index := strings.Index(path, collection)
+	if index < 0 {
+		return "", ""
 	}
 
-	err2 := decodeBody(res.Body, content) // Decode the body, and store it in the original variable/struct
-	if err2 != nil {
-		return err2
+	segments := strings.SplitN(strings.Trim(path[index+len(collection):], "/"), "/", 2)
+	if len(segments) < 2 {
+		return segments[0], ""
 	}
-	// Everything is OK
-	return nil
-}
-
-// decodeBody decodes the body of a given response into a given value (content).
-func decodeBody(body io.ReadCloser, content any) error {
-	decoder := json.NewDecoder(body) // Initialize the decoder
-	// Decode the body into the data-type
-	if err1 := decoder.Decode(content); err1 != nil {
-		return err1
-	}
-	err2 := body.Close() // Closing the body.
-	if err2 != nil {
-		return err2
-	}
-	// Everything is OK
-	return nil
+	return segments[0], segments[1]
 }
 
 // ParseFile is to read through a file and return the data.
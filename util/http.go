@@ -1,6 +1,7 @@
 package util
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 )
@@ -15,6 +16,14 @@ const (
 	MIMETYPE_JSON           = "application/json"
 	MIMETYPE_PLAINTEXT      = "text/plain"
 	MIMETYPE_PLAINTEXT_UTF8 = "text/plain; charset=utf-8"
+	MIMETYPE_CSV            = "text/csv"
+	MIMETYPE_NDJSON         = "application/x-ndjson"
+	MIMETYPE_HTML           = "text/html"
+	MIMETYPE_SVG            = "image/svg+xml"
+	MIMETYPE_XML            = "application/xml"
+	MIMETYPE_EVENT_STREAM   = "text/event-stream"
+	MIMETYPE_MERGE_PATCH    = "application/merge-patch+json"
+	MIMETYPE_JSON_PATCH     = "application/json-patch+json"
 )
 
 // List of commonly used headers.
@@ -25,6 +34,17 @@ const (
 const (
 	CONTENT_TYPE          = "content-type"
 	X_CONTENT_TYPE_OPTION = "X-Content-Type-Options"
+	ACCEPT                = "Accept"
+	VARY                  = "Vary"
+	CACHE_CONTROL         = "Cache-Control"
+	LAST_EVENT_ID         = "Last-Event-ID"
+	ACCEPT_LANGUAGE       = "Accept-Language"
+	CONTENT_LANGUAGE      = "Content-Language"
+	RETRY_AFTER           = "Retry-After"
+	USER_AGENT            = "User-Agent"
+	ACCEPT_PATCH          = "Accept-Patch"
+	REFERRER_POLICY       = "Referrer-Policy"
+	X_ROBOTS_TAG          = "X-Robots-Tag"
 )
 
 // HttpError is a drop-in replacement for http.Error.
@@ -49,3 +69,27 @@ func HttpError(w http.ResponseWriter, error string, code int) {
 	w.WriteHeader(code)
 	fmt.Fprintln(w, "{\"message\": \""+error+"\"}")
 }
+
+// HttpValidationError is HttpError for request bodies with invalid fields. It responds with 422 Unprocessable Entity,
+// and lists every invalid field with the reason it is invalid.
+//
+// # Example
+//
+// util.HttpValidationError(w, "the registration is invalid",
+// util.ValidationError{{Field: "country", Reason: "is required"}})
+//
+// Output:
+//
+//	{
+//	    "message": "the registration is invalid",
+//	    "errors": [{"field": "country", "reason": "is required"}]
+//	}
+func HttpValidationError(w http.ResponseWriter, message string, errs ValidationError) {
+	w.Header().Add(CONTENT_TYPE, MIMETYPE_JSON)
+	w.Header().Set(X_CONTENT_TYPE_OPTION, "nosniff")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(struct {
+		Message string          `json:"message"`
+		Errors  ValidationError `json:"errors"`
+	}{message, errs})
+}
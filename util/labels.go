@@ -0,0 +1,160 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Limits on the labels, names and descriptions of registrations
+const (
+	MAX_LABELS             = 20
+	MAX_LABEL_LENGTH       = 63
+	MAX_NAME_LENGTH        = 100
+	MAX_DESCRIPTION_LENGTH = 1000
+)
+
+// labelKeyPattern is the format of label keys: letters, digits, '.', '_', '-' and '/', starting and ending with a
+// letter or a digit. Example: "team", "cost-center", "example.com/owner"
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+
+// labelValuePattern is the format of label values. Like keys, but '/' is not allowed, and values may be empty.
+var labelValuePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?)?$`)
+
+// Operators of label requirements
+const (
+	LABEL_EQUALS         = "="
+	LABEL_NOT_EQUALS     = "!="
+	LABEL_EXISTS         = "exists"
+	LABEL_DOES_NOT_EXIST = "!exists"
+)
+
+// LabelRequirement is a condition on one label of a registration. See ParseLabelSelector.
+type LabelRequirement struct {
+	Key      string
+	Operator string
+	Value    string
+}
+
+// Matches tells whether a registration's labels meet the requirement.
+func (l LabelRequirement) Matches(labels map[string]string) bool {
+	value, exists := labels[l.Key]
+	switch l.Operator {
+	case LABEL_EQUALS:
+		return exists && value == l.Value
+	case LABEL_NOT_EQUALS:
+		return !exists || value != l.Value
+	case LABEL_EXISTS:
+		return exists
+	default:
+		return !exists
+	}
+}
+
+// ParseLabelSelector parses label selectors into the requirements they are made of. A selector is a comma-separated
+// list of requirements, and a registration must meet all of them:
+// - key=value: the label is set to the value. 'key==value' is the same.
+// - key!=value: the label is not set to the value, or is not set at all.
+// - key: the label is set, to any value.
+// - !key: the label is not set.
+//
+// Example:
+// ParseLabelSelector([]string{"team=finance,env!=test", "owner"})
+//
+// Output: [{team = finance} {env != test} {owner exists }]
+func ParseLabelSelector(selectors []string) ([]LabelRequirement, error) {
+	var requirements []LabelRequirement
+	for _, selector := range selectors {
+		for _, part := range strings.Split(selector, ",") {
+			part = strings.TrimSpace(part)
+
+			var requirement LabelRequirement
+			if key, value, ok := strings.Cut(part, LABEL_NOT_EQUALS); ok {
+				requirement = LabelRequirement{Key: key, Operator: LABEL_NOT_EQUALS, Value: value}
+			} else if key, value, ok := strings.Cut(part, "=="); ok {
+				requirement = LabelRequirement{Key: key, Operator: LABEL_EQUALS, Value: value}
+			} else if key, value, ok := strings.Cut(part, LABEL_EQUALS); ok {
+				requirement = LabelRequirement{Key: key, Operator: LABEL_EQUALS, Value: value}
+			} else if key, ok := strings.CutPrefix(part, "!"); ok {
+				requirement = LabelRequirement{Key: key, Operator: LABEL_DOES_NOT_EXIST}
+			} else {
+				requirement = LabelRequirement{Key: part, Operator: LABEL_EXISTS}
+			}
+
+			requirement.Key = strings.TrimSpace(requirement.Key)
+			requirement.Value = strings.TrimSpace(requirement.Value)
+			if !labelKeyPattern.MatchString(requirement.Key) || !labelValuePattern.MatchString(requirement.Value) {
+				return nil, fmt.Errorf("the label selector '%v' is invalid. Use key=value, key!=value, key or !key", part)
+			}
+			requirements = append(requirements, requirement)
+		}
+	}
+	return requirements, nil
+}
+
+// MatchesLabels tells whether a registration meets every label requirement.
+func (r Registration) MatchesLabels(requirements []LabelRequirement) bool {
+	for _, requirement := range requirements {
+		if !requirement.Matches(r.Labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchesText tells whether every word of a free-text search is found in the name or the description of a
+// registration. The search is case-insensitive, and words may be part of longer words. An empty search matches every
+// registration.
+//
+// Example:
+// Registration{Name: "Finance Nordics", Description: "Exchange rates for the Oslo office"}.MatchesText("oslo fin")
+//
+// Output: true
+func (r Registration) MatchesText(search string) bool {
+	text := strings.ToLower(r.Name + "\n" + r.Description)
+	for _, word := range strings.Fields(strings.ToLower(search)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateLabels ensures that the labels, name and description of a registration are valid. Names and descriptions
+// are trimmed. Invalid fields are added to errs.
+func validateLabels(registration *Registration, errs *ValidationError) {
+	if registration.Name != "" && strings.TrimSpace(registration.Name) == "" {
+		errs.add("name", "must not be blank")
+	}
+	registration.Name = strings.TrimSpace(registration.Name)
+	if len([]rune(registration.Name)) > MAX_NAME_LENGTH {
+		errs.add("name", "is longer than %d characters", MAX_NAME_LENGTH)
+	}
+	registration.Description = strings.TrimSpace(registration.Description)
+	if len([]rune(registration.Description)) > MAX_DESCRIPTION_LENGTH {
+		errs.add("description", "is longer than %d characters", MAX_DESCRIPTION_LENGTH)
+	}
+
+	if len(registration.Labels) > MAX_LABELS {
+		errs.add("labels", "a registration may have at most %d labels", MAX_LABELS)
+	}
+	// Sort the keys, so the invalid labels are always listed in the same order
+	keys := make([]string, 0, len(registration.Labels))
+	for key := range registration.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field := "labels." + key
+		value := registration.Labels[key]
+		if len(key) > MAX_LABEL_LENGTH || !labelKeyPattern.MatchString(key) {
+			errs.add(field, "the key must be at most %d letters, digits, '.', '_', '-' or '/', starting and ending "+
+				"with a letter or a digit", MAX_LABEL_LENGTH)
+		} else if len(value) > MAX_LABEL_LENGTH || !labelValuePattern.MatchString(value) {
+			errs.add(field, "the value must be empty, or at most %d letters, digits, '.', '_' or '-', starting and "+
+				"ending with a letter or a digit", MAX_LABEL_LENGTH)
+		}
+	}
+}
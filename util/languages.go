@@ -0,0 +1,103 @@
+package util
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// LANGUAGE_DEFAULT is the language of responses when the client asks for none, or only for unsupported languages.
+const LANGUAGE_DEFAULT = "en"
+
+// languageKeys maps each supported language (ISO 639-1) to its key in the translations of REST Countries (ISO 639-3).
+// Norwegian, Danish and Icelandic are not translated by REST Countries, but are found in the native names of the
+// countries that speak them.
+var languageKeys = map[string]string{
+	"en": "eng",
+	"da": "dan",
+	"de": "deu",
+	"es": "spa",
+	"et": "est",
+	"fi": "fin",
+	"fr": "fra",
+	"is": "isl",
+	"it": "ita",
+	"ja": "jpn",
+	"nb": "nob",
+	"nl": "nld",
+	"nn": "nno",
+	"no": "nob",
+	"pl": "pol",
+	"pt": "por",
+	"ru": "rus",
+	"sv": "swe",
+	"zh": "zho",
+}
+
+// NegotiateLanguage finds the language the client asked for.
+//
+// # Description
+//
+// The query parameter 'lang' takes precedence over the Accept-Language header. In the Accept-Language header, the
+// supported language with the highest quality is picked. Only the primary language is considered, so "de-AT" is
+// German. English is the default when the client has no preference, or only asks for languages that are not
+// supported.
+//
+// # Example
+//
+// Accept-Language: nb-NO, de;q=0.8, en;q=0.5
+//
+// Output: "nb"
+//
+// Returns:
+// - A supported ISO 639-1 language code.
+func NegotiateLanguage(r *http.Request) string {
+	if lang := primaryLanguage(r.URL.Query().Get("lang")); lang != "" {
+		if _, ok := languageKeys[lang]; ok {
+			return lang
+		}
+		return LANGUAGE_DEFAULT
+	}
+
+	best := LANGUAGE_DEFAULT
+	bestQuality := 0.0
+	for _, accepted := range strings.Split(r.Header.Get(ACCEPT_LANGUAGE), ",") {
+		tag, params, _ := strings.Cut(accepted, ";")
+		lang := primaryLanguage(tag)
+		if _, ok := languageKeys[lang]; !ok {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = lang, quality
+		}
+	}
+
+	return best
+}
+
+// LanguageKey returns the key of a language in the translations and native names of REST Countries. Example: "deu"
+func LanguageKey(lang string) string {
+	return languageKeys[lang]
+}
+
+// primaryLanguage returns the primary language of a language tag in lowercase. Example: "en-GB" is "en"
+func primaryLanguage(tag string) string {
+	tag = strings.TrimSpace(tag)
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	return strings.ToLower(tag)
+}
+
+// SetLanguage tells the client and caches which language a response is in.
+func SetLanguage(w http.ResponseWriter, lang string) {
+	w.Header().Set(CONTENT_LANGUAGE, lang)
+	w.Header().Add(VARY, ACCEPT_LANGUAGE)
+}
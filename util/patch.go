@@ -0,0 +1,343 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPatch is returned when a patch document is malformed.
+var ErrInvalidPatch = errors.New("invalid patch")
+
+// ErrPatchConflict is returned when a patch can't be applied to a document, for example when a path does not exist or
+// a 'test' operation fails.
+var ErrPatchConflict = errors.New("the patch can't be applied")
+
+// ApplyMergePatch applies a JSON Merge Patch (RFC 7396) to a JSON document.
+//
+// # Description
+//
+// The members of an object in the patch replace the members of the document by the same names, and are merged
+// recursively into objects. A member that is null removes the member from the document. Anything that is not an
+// object, like a list, replaces the document's value as a whole.
+//
+// # Example
+//
+// ApplyMergePatch(`{"features": {"area": true, "capital": true}}`, `{"features": {"area": false, "capital": null}}`)
+//
+// Output: {"features": {"area": false}}
+func ApplyMergePatch(document []byte, patch []byte) ([]byte, error) {
+	var target, changes any
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, fmt.Errorf("%w: the merge patch is not JSON", ErrInvalidPatch)
+	}
+
+	return json.Marshal(mergePatch(target, changes))
+}
+
+// mergePatch merges a patch into a decoded JSON value. See ApplyMergePatch.
+func mergePatch(target any, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
+
+// patchOperation is an operation of a JSON Patch. Value is nil if the operation has no value, and "null" if the value
+// is null.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ApplyJSONPatch applies a JSON Patch (RFC 6902) to a JSON document.
+//
+// # Description
+//
+// The patch is a list of operations, which are applied in order. Every operation has a JSON Pointer (RFC 6901) to the
+// value it applies to in 'path'. The operations are 'add', 'remove', 'replace', 'move', 'copy' and 'test'. If an
+// operation fails, the patch is not applied at all.
+//
+// # Example
+//
+// ApplyJSONPatch(`{"features": {"targetCurrencies": ["EUR"]}}`,
+// `[{"op": "add", "path": "/features/targetCurrencies/-", "value": "USD"}]`)
+//
+// Output: {"features": {"targetCurrencies": ["EUR", "USD"]}}
+//
+// Returns:
+// - ErrInvalidPatch if the patch is malformed.
+// - ErrPatchConflict if an operation can't be applied to the document.
+func ApplyJSONPatch(document []byte, patch []byte) ([]byte, error) {
+	var target any
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, err
+	}
+	var operations []patchOperation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, fmt.Errorf("%w: a JSON patch must be a list of operations", ErrInvalidPatch)
+	}
+
+	for i, operation := range operations {
+		var err error
+		target, err = applyOperation(target, operation)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%v): %w", i, operation.Op, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+// applyOperation applies an operation of a JSON Patch to a decoded JSON value, and returns the changed value.
+func applyOperation(target any, operation patchOperation) (any, error) {
+	if operation.Path == nil {
+		return nil, fmt.Errorf("%w: 'path' is required", ErrInvalidPatch)
+	}
+	path, err := parsePointer(*operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	switch operation.Op {
+	case "add", "replace", "test":
+		if operation.Value == nil {
+			return nil, fmt.Errorf("%w: 'value' is required", ErrInvalidPatch)
+		}
+		if err := json.Unmarshal(operation.Value, &value); err != nil {
+			return nil, fmt.Errorf("%w: 'value' is not JSON", ErrInvalidPatch)
+		}
+	case "move", "copy":
+		if operation.From == nil {
+			return nil, fmt.Errorf("%w: 'from' is required", ErrInvalidPatch)
+		}
+		from, err := parsePointer(*operation.From)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = pointerValue(target, from); err != nil {
+			return nil, err
+		}
+		if operation.Op == "copy" {
+			value = copyValue(value)
+			break
+		}
+		if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+			return nil, fmt.Errorf("%w: a value can't be moved into itself", ErrInvalidPatch)
+		}
+		if target, err = removeValue(target, from); err != nil {
+			return nil, err
+		}
+	case "remove":
+		// Has neither a value nor 'from'
+	default:
+		return nil, fmt.Errorf("%w: unknown operation '%v'", ErrInvalidPatch, operation.Op)
+	}
+
+	switch operation.Op {
+	case "remove":
+		return removeValue(target, path)
+	case "replace":
+		if _, err := pointerValue(target, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		if target, err = removeValue(target, path); err != nil {
+			return nil, err
+		}
+		return addValue(target, path, value)
+	case "test":
+		current, err := pointerValue(target, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, fmt.Errorf("%w: the value at '%v' is not %s", ErrPatchConflict, *operation.Path, operation.Value)
+		}
+		return target, nil
+	default:
+		return addValue(target, path, value)
+	}
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its reference tokens. The empty pointer refers to the whole
+// document.
+//
+// Example:
+// parsePointer("/features/targetCurrencies/0")
+//
+// Output: ["features", "targetCurrencies", "0"]
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: the path '%v' must start with '/'", ErrInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// pointerValue returns the value a JSON Pointer refers to.
+func pointerValue(target any, path []string) (any, error) {
+	for _, token := range path {
+		switch container := target.(type) {
+		case map[string]any:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: '%v' does not exist", ErrPatchConflict, token)
+			}
+			target = value
+		case []any:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			target = container[index]
+		default:
+			return nil, fmt.Errorf("%w: '%v' does not exist", ErrPatchConflict, token)
+		}
+	}
+	return target, nil
+}
+
+// addValue adds a value at a JSON Pointer, and returns the changed target. The parent of the value must exist. A value
+// added to an object replaces the member by the same name. A value added to a list is inserted at the index, or
+// appended if the index is '-'.
+func addValue(target any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return changeParent(target, path, func(container any, token string) (any, error) {
+		switch container := container.(type) {
+		case map[string]any:
+			container[token] = value
+			return container, nil
+		case []any:
+			if token == "-" {
+				return append(container, value), nil
+			}
+			index, err := arrayIndex(token, len(container))
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		default:
+			return nil, fmt.Errorf("%w: '%v' has no parent to be added to", ErrPatchConflict, token)
+		}
+	})
+}
+
+// removeValue removes the value at a JSON Pointer, and returns the changed target. The value must exist.
+func removeValue(target any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: the whole document can't be removed", ErrPatchConflict)
+	}
+	return changeParent(target, path, func(container any, token string) (any, error) {
+		switch container := container.(type) {
+		case map[string]any:
+			if _, ok := container[token]; !ok {
+				return nil, fmt.Errorf("%w: '%v' does not exist", ErrPatchConflict, token)
+			}
+			delete(container, token)
+			return container, nil
+		case []any:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(container[:index], container[index+1:]...), nil
+		default:
+			return nil, fmt.Errorf("%w: '%v' does not exist", ErrPatchConflict, token)
+		}
+	})
+}
+
+// changeParent changes the parent of the value at a JSON Pointer with change, and returns the changed target. Lists
+// may be replaced when they change length, so every container on the path is stored again in its own parent.
+func changeParent(target any, path []string, change func(container any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return change(target, path[0])
+	}
+
+	child, err := pointerValue(target, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = changeParent(child, path[1:], change)
+	if err != nil {
+		return nil, err
+	}
+
+	switch container := target.(type) {
+	case map[string]any:
+		container[path[0]] = child
+	case []any:
+		index, _ := arrayIndex(path[0], len(container)-1)
+		container[index] = child
+	}
+	return target, nil
+}
+
+// arrayIndex parses a reference token as an index of a list, from 0 up to max.
+func arrayIndex(token string, max int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: '%v' is not an index of a list", ErrPatchConflict, token)
+	}
+	if index > max {
+		return 0, fmt.Errorf("%w: the index %v is out of range", ErrPatchConflict, index)
+	}
+	return index, nil
+}
+
+// copyValue deeply copies a decoded JSON value, so a copied value does not change with the original.
+func copyValue(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(value))
+		for name, member := range value {
+			copied[name] = copyValue(member)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(value))
+		for i, element := range value {
+			copied[i] = copyValue(element)
+		}
+		return copied
+	default:
+		return value
+	}
+}
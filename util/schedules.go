@@ -0,0 +1,38 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedules are how often a registration's dashboard is stored as a snapshot
+const (
+	SCHEDULE_NONE   = ""
+	SCHEDULE_HOURLY = "hourly"
+	SCHEDULE_DAILY  = "daily"
+)
+
+// ValidateSchedule ensures that the snapshot schedule is valid.
+// To learn more about available schedules, please look at 'SCHEDULE_*' in assignment2.util.schedules
+func ValidateSchedule(schedule string) error {
+	s := strings.ToLower(schedule)
+	if s != SCHEDULE_NONE &&
+		s != SCHEDULE_HOURLY &&
+		s != SCHEDULE_DAILY {
+		return fmt.Errorf("the snapshots must be empty, 'hourly' or 'daily'")
+	}
+	return nil
+}
+
+// SchedulePeriod returns the time between two snapshots of a schedule. Zero is returned if there are no snapshots.
+func SchedulePeriod(schedule string) time.Duration {
+	switch strings.ToLower(schedule) {
+	case SCHEDULE_HOURLY:
+		return time.Hour
+	case SCHEDULE_DAILY:
+		return 24 * time.Hour
+	default:
+		return 0
+	}
+}
@@ -1,53 +1,180 @@
 package util
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // Diagnostics
 type Diagnostics struct {
 	Countriesapi    int    `json:"countriesapi"`
 	Meteoapi        int    `json:"meto_api"`
+	METapi          int    `json:"met_api"`
 	Currencyapi     int    `json:"currency_api"`
+	ECBapi          int    `json:"ecb_api"`
 	Notificationapi int    `json:"notification_db"`
 	NumWebhooks     int    `json:"webhooks"`
 	Version         string `json:"v1"`
 	Uptime          int    `json:"starttime"`
+
+	// Breakers holds the circuit breaker of each upstream service, by the same names as the status codes above
+	Breakers map[string]BreakerStatus `json:"breakers"`
+	// Metrics counts the calls to each upstream service, by the same names as the status codes above
+	Metrics map[string]UpstreamMetrics `json:"metrics"`
+}
+
+// UpstreamMetrics counts the calls to the client of an upstream service.
+type UpstreamMetrics struct {
+	Calls     int64 `json:"calls"`     // Calls is the number of calls to the client.
+	CacheHits int64 `json:"cacheHits"` // CacheHits is the number of calls that were served from the cache.
+	Coalesced int64 `json:"coalesced"` // Coalesced is the number of calls that shared an identical call's response.
+	Requests  int64 `json:"requests"`  // Requests is the number of requests sent, including retries.
+}
+
+// BreakerStatus is the state of the circuit breaker of an upstream service.
+type BreakerStatus struct {
+	State         string     `json:"state"`                 // State is "closed", "open" or "half-open".
+	Failures      int        `json:"failures"`              // Failures is the number of failures in a row.
+	TotalFailures int        `json:"totalFailures"`         // TotalFailures is the number of failures since start.
+	LastError     string     `json:"lastError,omitempty"`   // LastError is the error of the latest failure.
+	LastFailure   *time.Time `json:"lastFailure,omitempty"` // LastFailure is the time of the latest failure.
+	OpenUntil     *time.Time `json:"openUntil,omitempty"`   // OpenUntil is when an open breaker lets a request probe.
 }
 
 // Registrations
+//
+// A registration with IsoCodes is a comparison registration. Its dashboard compares all the countries in IsoCodes,
+// and Country is then only a name for the group of countries. Example: "Nordics".
 type Registration struct {
-	ID         string   `json:"id"`
-	Country    string   `json:"country"`
-	IsoCode    string   `json:"isoCode"`
+	ID          string            `json:"id"`
+	Name        string            `json:"name,omitempty"`        // Name is a human-readable name of the dashboard.
+	Description string            `json:"description,omitempty"` // Description tells what the dashboard is for.
+	Labels      map[string]string `json:"labels,omitempty"`      // Labels by key. Example: {"team": "finance"}
+	Country     string            `json:"country"`
+	IsoCode     string            `json:"isoCode"`
+	IsoCodes    []string          `json:"isoCodes,omitempty"`
+	Features    Features          `json:"features"`
+	Snapshots   string            `json:"snapshots,omitempty"` // Snapshots is how often the dashboard is stored. See 'SCHEDULE_*'.
+	LastChange  string            `json:"lastChange"`
+	// LastRefresh is when the upstream data of the dashboard was last refreshed in the background. It is not stored.
+	LastRefresh string `json:"lastRefresh,omitempty"`
+}
+
+// IsComparison tells whether the registration compares several countries.
+func (r Registration) IsComparison() bool {
+	return len(r.IsoCodes) > 0
+}
+
+// AllIsoCodes returns the ISO codes of every country the registration is about.
+func (r Registration) AllIsoCodes() []string {
+	if r.IsComparison() {
+		return r.IsoCodes
+	}
+	return []string{r.IsoCode}
+}
+
+// Template is a named set of features that registrations can be created from. Registrations created from the same
+// template only differ in their country.
+type Template struct {
+	Name       string   `json:"name"`
 	Features   Features `json:"features"`
 	LastChange string   `json:"lastChange"`
 }
 
+// Share is a public link to the dashboard of a registration. The link holds a signed token, and works until it
+// expires or the share is revoked. See the crypto package.
+type Share struct {
+	ID             string    `json:"id"`
+	RegistrationID string    `json:"registrationId"`
+	Created        time.Time `json:"created"`
+	Expires        time.Time `json:"expires"`
+	Token          string    `json:"token,omitempty" firestore:"-"`
+	URL            string    `json:"url,omitempty" firestore:"-"`
+}
+
 // List of features included in registrations
 type Features struct {
-	Temperature      bool     `json:"temperature"`
-	Precipitation    bool     `json:"precipitation"`
-	Capital          bool     `json:"capital"`
-	Coordinates      bool     `json:"coordinates"`
-	Population       bool     `json:"population"`
-	Area             bool     `json:"area"`
-	TargetCurrencies []string `json:"targetCurrencies"`
+	Temperature      bool              `json:"temperature"`
+	Precipitation    bool              `json:"precipitation"`
+	Capital          bool              `json:"capital"`
+	Coordinates      bool              `json:"coordinates"`
+	Population       bool              `json:"population"`
+	Area             bool              `json:"area"`
+	Languages        bool              `json:"languages"`
+	Timezones        bool              `json:"timezones"`
+	Region           bool              `json:"region"`
+	Borders          bool              `json:"borders"`
+	CallingCodes     bool              `json:"callingCodes"`
+	Flag             bool              `json:"flag"`
+	DrivingSide      bool              `json:"drivingSide"`
+	TopLevelDomains  bool              `json:"topLevelDomains"`
+	TargetCurrencies []string          `json:"targetCurrencies"`
+	Computed         map[string]string `json:"computed,omitempty"` // Computed features by name. Example: "population / area"
 }
 
 // Structs from the REST Countries API
 type Country struct {
-	CapitalCity          []string       `json:"capital"`
-	LatitudeAndLongitude []float64      `json:"latlng"`
-	Population           int            `json:"population"`
-	Area                 float64        `json:"area"`
-	Currencies           map[string]any `json:"currencies"`
+	Name                 CountryName            `json:"name"`
+	Cca2                 string                 `json:"cca2"`
+	Cca3                 string                 `json:"cca3"`
+	AltSpellings         []string               `json:"altSpellings"`
+	CapitalCity          []string               `json:"capital"`
+	LatitudeAndLongitude []float64              `json:"latlng"`
+	Population           int                    `json:"population"`
+	Area                 float64                `json:"area"`
+	Currencies           map[string]any         `json:"currencies"`
+	Languages            map[string]string      `json:"languages"`
+	Timezones            []string               `json:"timezones"`
+	Region               string                 `json:"region"`
+	Subregion            string                 `json:"subregion"`
+	Borders              []string               `json:"borders"`
+	CallingCode          CallingCode            `json:"idd"`
+	Flags                Flag                   `json:"flags"`
+	Car                  Car                    `json:"car"`
+	TopLevelDomains      []string               `json:"tld"`
+	Translations         map[string]CountryName `json:"translations"` // Names by ISO 639-3 language. See util.LanguageKey
+}
+
+type CountryName struct {
+	Common     string                 `json:"common"`
+	Official   string                 `json:"official"`
+	NativeName map[string]CountryName `json:"nativeName,omitempty"` // Names in the country's own languages
 }
 
-// Structs from the Open Meteo API
+// International direct dialing (IDD) codes. A country's calling codes are the root followed by each suffix.
+type CallingCode struct {
+	Root     string   `json:"root"`
+	Suffixes []string `json:"suffixes"`
+}
+
+type Flag struct {
+	Png string `json:"png"`
+	Svg string `json:"svg"`
+	Alt string `json:"alt,omitempty"`
+}
+
+type Car struct {
+	Signs []string `json:"signs"`
+	Side  string   `json:"side"`
+}
+
+// Weather is an hourly weather forecast. The forecasts of every weather provider are normalized into it.
 type Weather struct {
-	Hourly ForecastHourly `json:"hourly"`
+	HourlyUnits ForecastUnits
+	Hourly      ForecastHourly
 }
 
+// ForecastHourly has one value of each series per hour.
 type ForecastHourly struct {
-	Temperature   []float64 `json:"temperature_2m"`
-	Precipitation []float64 `json:"precipitation"`
+	Time          []string  // Time is ISO 8601 in UTC without seconds. Example: 2024-04-18T13:00
+	Temperature   []float64 // Temperature is the air temperature at the start of the hour.
+	Precipitation []float64 // Precipitation is the precipitation amount during the hour.
+}
+
+// ForecastUnits are the units of the series. Example: °C and mm
+type ForecastUnits struct {
+	Temperature   string
+	Precipitation string
 }
 
 // Structs from the Currencies API
@@ -64,13 +191,62 @@ type DashboardResponse struct {
 }
 
 type DashboardFeatures struct {
-	Temperature      float64            `json:"temperature,omitempty"`
-	Precipitation    float64            `json:"precipitation,omitempty"`
-	Capital          string             `json:"capital,omitempty"`
-	Coordinates      Coordinates        `json:"coordinates,omitempty"`
-	Population       int                `json:"population,omitempty"`
-	Area             float64            `json:"area,omitempty"`
-	TargetCurrencies map[string]float64 `json:"targetCurrencies"`
+	Temperature      float64             `json:"temperature,omitempty"`
+	Precipitation    float64             `json:"precipitation,omitempty"`
+	Capital          string              `json:"capital,omitempty"`
+	Coordinates      Coordinates         `json:"coordinates,omitempty"`
+	Population       int                 `json:"population,omitempty"`
+	Area             float64             `json:"area,omitempty"`
+	Languages        []string            `json:"languages,omitempty"`
+	Timezones        []string            `json:"timezones,omitempty"`
+	Region           string              `json:"region,omitempty"`
+	Subregion        string              `json:"subregion,omitempty"`
+	Borders          []string            `json:"borders,omitempty"`
+	CallingCodes     []string            `json:"callingCodes,omitempty"`
+	Flag             *Flag               `json:"flag,omitempty"`
+	DrivingSide      string              `json:"drivingSide,omitempty"`
+	TopLevelDomains  []string            `json:"topLevelDomains,omitempty"`
+	TargetCurrencies map[string]float64  `json:"targetCurrencies"`
+	CurrencyNames    map[string]string   `json:"currencyNames,omitempty"` // Names of the country's and the target currencies
+	Computed         map[string]*float64 `json:"computed,omitempty"`      // Computed features are null if they can't be computed
+}
+
+// Structs for comparison dashboards
+type ComparisonDashboardResponse struct {
+	Name          string               `json:"name,omitempty"`
+	IsoCodes      []string             `json:"isoCodes"`
+	Countries     []DashboardResponse  `json:"countries"`
+	Comparisons   DashboardComparisons `json:"comparisons"`
+	LastRetrieval string               `json:"lastRetrieval"`
+}
+
+type DashboardComparisons struct {
+	HighestPopulation       *CountryValue `json:"highestPopulation,omitempty"`
+	LowestPopulation        *CountryValue `json:"lowestPopulation,omitempty"`
+	LargestArea             *CountryValue `json:"largestArea,omitempty"`
+	SmallestArea            *CountryValue `json:"smallestArea,omitempty"`
+	HighestTemperature      *CountryValue `json:"highestTemperature,omitempty"`
+	LowestTemperature       *CountryValue `json:"lowestTemperature,omitempty"`
+	TemperatureDifference   *float64      `json:"temperatureDifference,omitempty"`
+	HighestPrecipitation    *CountryValue `json:"highestPrecipitation,omitempty"`
+	LowestPrecipitation     *CountryValue `json:"lowestPrecipitation,omitempty"`
+	PrecipitationDifference *float64      `json:"precipitationDifference,omitempty"`
+}
+
+// CountryValue is a feature's value for a single country in a comparison.
+type CountryValue struct {
+	IsoCode string  `json:"isoCode"`
+	Value   float64 `json:"value"`
+}
+
+// Structs for dashboard snapshots
+//
+// A snapshot is a dashboard stored at a point in time. Dashboard is the dashboard the way the Dashboard-endpoint
+// returned it at the time, either a DashboardResponse or a ComparisonDashboardResponse.
+type Snapshot struct {
+	RegistrationId string          `json:"registrationId"`
+	Time           time.Time       `json:"time"`
+	Dashboard      json.RawMessage `json:"dashboard"`
 }
 
 type Coordinates struct {
@@ -65,8 +65,10 @@ func TestMethod(client http.Client, endpoint string, method string, expectedStat
 // - Error is nil if everything was OK.
 func PopulateTestFile(filepath string, obj any) error {
 	// Ensure that the filepaths are valid
-	if filepath != STUB_DATABASE_REGISTRATIONS && filepath != STUB_DATABASE_NOTIFICATIONS {
-		return fmt.Errorf("invalid filepath. Must be util.STUB_DATABASE_REGISTRATIONS or util.STUB_DATABASE_NOTIFICATIONS")
+	if filepath != STUB_DATABASE_REGISTRATIONS && filepath != STUB_DATABASE_NOTIFICATIONS &&
+		filepath != STUB_DATABASE_SNAPSHOTS && filepath != STUB_DATABASE_TEMPLATES && filepath != STUB_DATABASE_SHARES {
+		return fmt.Errorf("invalid filepath. Must be util.STUB_DATABASE_REGISTRATIONS, util.STUB_DATABASE_NOTIFICATIONS, " +
+			"util.STUB_DATABASE_SNAPSHOTS, util.STUB_DATABASE_TEMPLATES or util.STUB_DATABASE_SHARES")
 	}
 
 	// Encode the object array to JSON
@@ -88,8 +90,13 @@ func PopulateTestFile(filepath string, obj any) error {
 func FixStubPaths() {
 	STUB_DATABASE_REGISTRATIONS = "../stubs/res/registrations.json"
 	STUB_DATABASE_NOTIFICATIONS = "../stubs/res/notifications.json"
+	STUB_DATABASE_SNAPSHOTS = "../stubs/res/snapshots.json"
+	STUB_DATABASE_TEMPLATES = "../stubs/res/templates.json"
+	STUB_DATABASE_SHARES = "../stubs/res/shares.json"
 
 	STUB_WEATHER_REPONSE = "../stubs/res/weather.json"
 	STUB_CURRENCIES_RESPONSE = "../stubs/res/currency.json"
 	STUB_COUNTRY_RESPONSE = "../stubs/res/country.json"
+	STUB_ECB_RESPONSE = "../stubs/res/ecb.xml"
+	STUB_MET_NORWAY_RESPONSE = "../stubs/res/metnorway.json"
 }
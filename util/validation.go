@@ -0,0 +1,250 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// FieldError is a field of a request body that is invalid, and why. Fields are named by their JSON path.
+//
+// Example:
+// FieldError{Field: "features.targetCurrencies[1]", Reason: "'euro' is not an ISO 4217 currency code"}
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError lists every invalid field of a request body.
+type ValidationError []FieldError
+
+// Error joins the invalid fields and their reasons.
+func (v ValidationError) Error() string {
+	reasons := make([]string, len(v))
+	for i, fieldErr := range v {
+		reasons[i] = fieldErr.Field + " " + fieldErr.Reason
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// add adds an invalid field. The reason is formatted as with fmt.Sprintf.
+func (v *ValidationError) add(field string, reason string, args ...any) {
+	*v = append(*v, FieldError{Field: field, Reason: fmt.Sprintf(reason, args...)})
+}
+
+// isoCodePattern is the format of two- and three-letter ISO 3166-1 country codes.
+var isoCodePattern = regexp.MustCompile(`^[A-Za-z]{2,3}$`)
+
+// DecodeRegistration strictly decodes a registration from a request body. See DecodeStrict.
+func DecodeRegistration(body io.Reader) (Registration, error) {
+	var registration Registration
+	if err := DecodeStrict(body, &registration); err != nil {
+		return Registration{}, err
+	}
+	return registration, nil
+}
+
+// DecodeStrict strictly decodes a JSON object from a request body into the struct that target points to.
+//
+// # Description
+//
+// Unlike json.Decoder, every field is checked, so all the invalid fields are found at once:
+// - Field names must match exactly. Unknown fields, and fields in the wrong case, are invalid.
+// - Every field must have the right JSON type.
+//
+// Returns:
+// - A ValidationError if fields are unknown or of the wrong type.
+// - Another error if the body is not a JSON object.
+func DecodeStrict(body io.Reader, target any) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil || object == nil {
+		return fmt.Errorf("the body must be a JSON object")
+	}
+
+	var errs ValidationError
+	decodeFields(object, reflect.ValueOf(target).Elem(), "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// decodeFields decodes the fields of a JSON object into a struct, by the names in their JSON tags. Objects are decoded
+// recursively into nested structs. Invalid fields are added to errs by their path below prefix.
+func decodeFields(object map[string]json.RawMessage, target reflect.Value, prefix string, errs *ValidationError) {
+	fields := jsonFields(target.Type())
+
+	// Sort the names, so the invalid fields are always listed in the same order
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := prefix + name
+		index, ok := fields[name]
+		if !ok {
+			errs.add(path, "is not a known field")
+			continue
+		}
+
+		field := target.Field(index)
+		if field.Kind() == reflect.Struct {
+			var nested map[string]json.RawMessage
+			if err := json.Unmarshal(object[name], &nested); err != nil || nested == nil {
+				errs.add(path, "must be an object")
+				continue
+			}
+			decodeFields(nested, field, path+".", errs)
+			continue
+		}
+
+		if err := json.Unmarshal(object[name], field.Addr().Interface()); err != nil {
+			errs.add(path, "must be %v", jsonTypeName(field.Type()))
+		}
+	}
+}
+
+// jsonFields maps the JSON names of a struct's fields to their index.
+func jsonFields(t reflect.Type) map[string]int {
+	fields := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+}
+
+// jsonTypeName describes the JSON type of a Go type, for error messages.
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "true or false"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice:
+		return "a list of " + strings.TrimPrefix(strings.TrimPrefix(jsonTypeName(t.Elem()), "a "), "an ") + "s"
+	case reflect.Map:
+		return "an object of " + strings.TrimPrefix(strings.TrimPrefix(jsonTypeName(t.Elem()), "a "), "an ") + "s"
+	default:
+		return "a " + t.Kind().String()
+	}
+}
+
+// ValidateRegistration ensures that the fields of a registration are valid, before the country is checked against
+// REST Countries. The target currencies are normalized to upper case, and the snapshot schedule to lower case.
+//
+// # Rules
+//
+// - 'id', 'lastChange' and 'lastRefresh' are set by the service, and cannot be given.
+// - Either 'country' or 'isoCode' is required, or 'isoCodes' for comparison registrations. 'isoCode' and 'isoCodes'
+// cannot both be given.
+// - ISO codes are two- or three-letter ISO 3166-1 codes.
+// - Names, descriptions and labels are within their limits. See 'MAX_*' in assignment2.util.labels
+// - Target currencies are ISO 4217 currency codes, and are listed once.
+// - 'snapshots' is a schedule. See ValidateSchedule.
+//
+// Returns:
+// - A ValidationError with every invalid field, or nil if the registration is valid.
+func ValidateRegistration(registration *Registration) ValidationError {
+	var errs ValidationError
+
+	if registration.ID != "" {
+		errs.add("id", "is assigned by the service, and cannot be given")
+	}
+	if registration.LastChange != "" {
+		errs.add("lastChange", "is set by the service, and cannot be given")
+	}
+	if registration.LastRefresh != "" {
+		errs.add("lastRefresh", "is set by the service, and cannot be given")
+	}
+
+	if registration.Country != "" && strings.TrimSpace(registration.Country) == "" {
+		errs.add("country", "must not be blank")
+	}
+	if registration.IsComparison() {
+		if registration.IsoCode != "" {
+			errs.add("isoCode", "cannot be given together with 'isoCodes'")
+		}
+		for i, isoCode := range registration.IsoCodes {
+			if !isoCodePattern.MatchString(strings.TrimSpace(isoCode)) {
+				errs.add(fmt.Sprintf("isoCodes[%d]", i), "'%v' is not a two- or three-letter ISO 3166-1 code", isoCode)
+			}
+		}
+	} else {
+		if registration.Country == "" && strings.TrimSpace(registration.IsoCode) == "" {
+			errs.add("country", "is required when 'isoCode' is not given")
+		}
+		if registration.IsoCode != "" && !isoCodePattern.MatchString(strings.TrimSpace(registration.IsoCode)) {
+			errs.add("isoCode", "'%v' is not a two- or three-letter ISO 3166-1 code", registration.IsoCode)
+		}
+	}
+
+	validateLabels(registration, &errs)
+	validateFeatures(&registration.Features, &errs)
+
+	registration.Snapshots = strings.ToLower(registration.Snapshots)
+	if err := ValidateSchedule(registration.Snapshots); err != nil {
+		errs.add("snapshots", "%v", err)
+	}
+
+	return errs
+}
+
+// templateNamePattern is the format of template names, which are used in URLs.
+var templateNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// ValidateTemplate ensures that the fields of a registration template are valid. The target currencies are
+// normalized to upper case.
+//
+// # Rules
+//
+// - Names are 1 to 64 lower case letters, digits or hyphens, and start with a letter or a digit.
+// Example: "nordic-default"
+// - 'lastChange' is set by the service, and cannot be given.
+// - Target currencies are ISO 4217 currency codes, and are listed once.
+//
+// Returns:
+// - A ValidationError with every invalid field, or nil if the template is valid.
+func ValidateTemplate(template *Template) ValidationError {
+	var errs ValidationError
+
+	if !templateNamePattern.MatchString(template.Name) {
+		errs.add("name", "must be 1 to 64 lower case letters, digits or hyphens, starting with a letter or a digit")
+	}
+	if template.LastChange != "" {
+		errs.add("lastChange", "is set by the service, and cannot be given")
+	}
+	validateFeatures(&template.Features, &errs)
+
+	return errs
+}
+
+// validateFeatures ensures that the target currencies of a feature set are ISO 4217 currency codes, listed once, and
+// normalizes them to upper case. Invalid currencies are added to errs.
+func validateFeatures(features *Features, errs *ValidationError) {
+	listed := map[string]bool{}
+	for i, currency := range features.TargetCurrencies {
+		code := strings.ToUpper(strings.TrimSpace(currency))
+		field := fmt.Sprintf("features.targetCurrencies[%d]", i)
+		if !IsCurrencyCode(code) {
+			errs.add(field, "'%v' is not an ISO 4217 currency code", currency)
+		} else if listed[code] {
+			errs.add(field, "'%v' is listed more than once", code)
+		}
+		listed[code] = true
+		features.TargetCurrencies[i] = code
+	}
+}
@@ -0,0 +1,166 @@
+package views
+
+import (
+	"assignment2/util"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Bounds of a chart's size in pixels. Sizes outside the bounds are clamped.
+const (
+	CHART_DEFAULT_WIDTH  = 800
+	CHART_DEFAULT_HEIGHT = 300
+	CHART_MIN_WIDTH      = 300
+	CHART_MAX_WIDTH      = 2000
+	CHART_MIN_HEIGHT     = 150
+	CHART_MAX_HEIGHT     = 1000
+)
+
+// Margins around the plot area. The left and right margins hold the axes' labels.
+const (
+	chartMarginTop    = 40
+	chartMarginRight  = 55
+	chartMarginBottom = 35
+	chartMarginLeft   = 55
+)
+
+// chartTicks is the number of intervals on the vertical axes.
+const chartTicks = 5
+
+// ForecastChart is the data a forecast chart is rendered from.
+type ForecastChart struct {
+	Title   string
+	Weather util.Weather
+	Width   int
+	Height  int
+}
+
+// RenderForecastChart renders an hourly weather forecast as a self-contained SVG image. Temperature is drawn as a
+// line on the left axis, and precipitation as bars on the right axis. Days are marked on the horizontal axis.
+//
+// Parameters:
+// - w: where the SVG is written to. Example: http.ResponseWriter
+// - chart: the forecast to render, and the size of the image. The size is clamped to the 'CHART_*' bounds.
+//
+// Returns:
+// An error is returned if the forecast has no hours, or if the image could not be written.
+func RenderForecastChart(w io.Writer, chart ForecastChart) error {
+	hourly := chart.Weather.Hourly
+	hours := max(len(hourly.Temperature), len(hourly.Precipitation))
+	if hours == 0 {
+		return fmt.Errorf("the forecast has no hours to draw")
+	}
+
+	width := clamp(chart.Width, CHART_MIN_WIDTH, CHART_MAX_WIDTH)
+	height := clamp(chart.Height, CHART_MIN_HEIGHT, CHART_MAX_HEIGHT)
+	plotWidth := float64(width - chartMarginLeft - chartMarginRight)
+	plotHeight := float64(height - chartMarginTop - chartMarginBottom)
+	bottom := float64(chartMarginTop) + plotHeight
+
+	temperatureUnit := unitOrDefault(chart.Weather.HourlyUnits.Temperature, "°C")
+	precipitationUnit := unitOrDefault(chart.Weather.HourlyUnits.Precipitation, "mm")
+
+	// Scales for both series. Temperature may be negative, precipitation starts at zero.
+	tempMin, tempMax := niceRange(hourly.Temperature, false)
+	precMin, precMax := niceRange(hourly.Precipitation, true)
+	x := func(hour float64) float64 { return float64(chartMarginLeft) + hour*plotWidth/float64(hours) }
+	y := func(value, min, max float64) float64 { return bottom - (value-min)/(max-min)*plotHeight }
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n", width, height, width, height)
+	fmt.Fprintf(&svg, `<rect width="%d" height="%d" fill="#ffffff"/>`+"\n", width, height)
+	fmt.Fprintf(&svg, `<text x="%d" y="20" font-size="14" font-weight="bold" fill="#1f2933">%s</text>`+"\n", chartMarginLeft, html.EscapeString(chart.Title))
+
+	// Legend
+	legendX := width - chartMarginRight
+	fmt.Fprintf(&svg, `<rect x="%d" y="11" width="10" height="10" fill="#5b9bd5"/><text x="%d" y="20" text-anchor="end" fill="#52606d">Precipitation (%s)</text>`+"\n", legendX-10, legendX-14, html.EscapeString(precipitationUnit))
+	fmt.Fprintf(&svg, `<line x1="%d" y1="16" x2="%d" y2="16" stroke="#d64545" stroke-width="2"/><text x="%d" y="20" text-anchor="end" fill="#52606d">Temperature (%s)</text>`+"\n", legendX-150, legendX-136, legendX-154, html.EscapeString(temperatureUnit))
+
+	// Horizontal grid lines with the temperature axis on the left and the precipitation axis on the right
+	for i := 0; i <= chartTicks; i++ {
+		ratio := float64(i) / chartTicks
+		lineY := bottom - ratio*plotHeight
+		fmt.Fprintf(&svg, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#e4e7eb"/>`+"\n", chartMarginLeft, lineY, float64(chartMarginLeft)+plotWidth, lineY)
+		fmt.Fprintf(&svg, `<text x="%d" y="%.1f" text-anchor="end" fill="#d64545">%s</text>`+"\n", chartMarginLeft-6, lineY+4, formatTick(tempMin+ratio*(tempMax-tempMin)))
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" fill="#5b9bd5">%s</text>`+"\n", float64(chartMarginLeft)+plotWidth+6, lineY+4, formatTick(precMin+ratio*(precMax-precMin)))
+	}
+
+	// Precipitation bars
+	barWidth := math.Max(plotWidth/float64(hours)*0.8, 0.5)
+	for i, value := range hourly.Precipitation {
+		if value <= 0 {
+			continue
+		}
+		top := y(value, precMin, precMax)
+		fmt.Fprintf(&svg, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="#5b9bd5"/>`+"\n", x(float64(i))+barWidth*0.125, top, barWidth, bottom-top)
+	}
+
+	// Temperature line, through the middle of each hour
+	if len(hourly.Temperature) > 0 {
+		points := make([]string, 0, len(hourly.Temperature))
+		for i, value := range hourly.Temperature {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x(float64(i)+0.5), y(value, tempMin, tempMax)))
+		}
+		fmt.Fprintf(&svg, `<polyline points="%s" fill="none" stroke="#d64545" stroke-width="1.5" stroke-linejoin="round"/>`+"\n", strings.Join(points, " "))
+	}
+
+	// Axes, and a mark with the date at the start of each day
+	fmt.Fprintf(&svg, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#7b8794"/>`+"\n", chartMarginLeft, bottom, float64(chartMarginLeft)+plotWidth, bottom)
+	for i, timestamp := range hourly.Time {
+		hour, err := time.Parse("2006-01-02T15:04", timestamp)
+		if err != nil || hour.Hour() != 0 {
+			continue
+		}
+		fmt.Fprintf(&svg, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%.1f" stroke="#e4e7eb"/>`+"\n", x(float64(i)), chartMarginTop, x(float64(i)), bottom+4)
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" fill="#52606d">%s</text>`+"\n", x(float64(i))+3, bottom+16, hour.Format("Jan 2"))
+	}
+
+	svg.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, svg.String())
+	return err
+}
+
+// niceRange finds the range of a vertical axis, rounded outwards to whole numbers so the ticks are readable.
+// If fromZero is true, the range always starts at zero.
+func niceRange(values []float64, fromZero bool) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 1
+	}
+
+	low, high := values[0], values[0]
+	for _, value := range values {
+		low, high = math.Min(low, value), math.Max(high, value)
+	}
+	if fromZero {
+		low = 0
+	}
+
+	low, high = math.Floor(low), math.Ceil(high)
+	if high-low < 1 {
+		high = low + 1
+	}
+	return low, high
+}
+
+// formatTick formats the value of a tick on a vertical axis with at most one decimal.
+func formatTick(value float64) string {
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", value), ".0")
+}
+
+// unitOrDefault returns the unit, or the default unit if the service did not return one.
+func unitOrDefault(unit string, defaultUnit string) string {
+	if unit == "" {
+		return defaultUnit
+	}
+	return unit
+}
+
+// clamp limits a value to a range. Zero and negative values return the lower bound.
+func clamp(value int, lower int, upper int) int {
+	return min(max(value, lower), upper)
+}
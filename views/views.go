@@ -0,0 +1,94 @@
+// views package renders dashboards as HTML pages, so they can be read in a browser by people who are not developers.
+// Templates and static assets (stylesheets) are embedded in the binary, so the service has no files to deploy
+// alongside it.
+package views
+
+import (
+	"assignment2/util"
+	"embed"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+//go:embed static
+var staticFiles embed.FS
+
+// templates are parsed once, when the package is initialized. A template that does not parse is a developer error.
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"decimal":   formatDecimal,
+	"thousands": formatThousands,
+	"join":      strings.Join,
+	"static":    func(file string) string { return util.STATIC_PATH + file },
+}).ParseFS(templateFiles, "templates/*.html"))
+
+// DashboardView is the data a dashboard page is rendered from. A single-country dashboard has one country and no
+// comparisons.
+type DashboardView struct {
+	Title         string
+	Enabled       util.Features // Enabled tells which features to show. Zero values are valid, e.g. 0 °C.
+	Countries     []util.DashboardResponse
+	Comparisons   *util.DashboardComparisons
+	LastRetrieval string
+}
+
+// RenderDashboard renders a dashboard page.
+//
+// Parameters:
+// - w: where the HTML is written to. Example: http.ResponseWriter
+// - view: the populated dashboard to render.
+//
+// Returns:
+// An error is returned if the page could not be rendered or written.
+func RenderDashboard(w io.Writer, view DashboardView) error {
+	return templates.ExecuteTemplate(w, "dashboard.html", view)
+}
+
+// StaticHandler serves the embedded static assets. It must be registered on util.STATIC_PATH.
+func StaticHandler() http.Handler {
+	static, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		// The directory is embedded at compile time, so this never happens
+		panic(err)
+	}
+	return http.StripPrefix(util.STATIC_PATH, http.FileServer(http.FS(static)))
+}
+
+// formatDecimal formats a float with two decimals. Example: 13.2767 returns "13.28".
+func formatDecimal(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
+
+// formatThousands formats a number with spaces between the thousands, as is common in Norway.
+// Example: 5379475 returns "5 379 475".
+func formatThousands(value any) string {
+	var digits string
+	switch v := value.(type) {
+	case int:
+		digits = strconv.Itoa(v)
+	case float64:
+		digits = strconv.FormatFloat(v, 'f', 0, 64)
+	default:
+		return ""
+	}
+
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+
+	var out strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out.WriteRune(' ')
+		}
+		out.WriteRune(digit)
+	}
+	return sign + out.String()
+}